@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A sync backend stores the collection as a snapshot, somewhere computers can
+// reach it, e.g. a gist or a git repository. Syncing pulls the snapshot,
+// merges it into the collection the same way as changes in a folder, and
+// pushes a snapshot of the merged collection if it's different. Snapshots are
+// canonical JSON, so the same collection always gives the same snapshot and
+// e.g. git diffs show only what changed.
+
+const snapshotVersion = 1
+
+// SyncBackend stores the snapshot of a collection.
+type SyncBackend interface {
+	// Pull returns the snapshot, or nil if there isn't one yet.
+	Pull() ([]byte, error)
+	Push(snapshot []byte) error
+}
+
+type snapshot struct {
+	Version int                `json:"version"`
+	Vocab   []snapshotVocab    `json:"vocab"`
+	Reviews []snapshotReview   `json:"reviews"`
+	Deleted []snapshotDeletion `json:"deleted"`
+	// Undone is the reviews of undone practice.
+	Undone []snapshotDeletion `json:"undone"`
+}
+
+type snapshotVocab struct {
+	SyncID         string     `json:"syncId"`
+	Term           string     `json:"term"`
+	Translation    string     `json:"translation"`
+	KnowledgeLevel uint       `json:"knowledgeLevel"`
+	PracticeAt     time.Time  `json:"practiceAt"`
+	EditedAt       time.Time  `json:"editedAt"`
+	ReviewedAt     *time.Time `json:"reviewedAt"`
+}
+
+type snapshotReview struct {
+	SyncID      string    `json:"syncId"`
+	VocabSyncID string    `json:"vocabSyncId"`
+	Passed      bool      `json:"passed"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type snapshotDeletion struct {
+	SyncID    string    `json:"syncId"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// syncBackend syncs the collection of the user with the given ID through the
+// backend.
+func syncBackend(db *gorm.DB, userID uint, backend SyncBackend) (*SyncResult, error) {
+	state, err := syncState(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &SyncResult{DeviceID: state.DeviceID}
+
+	pulled, err := backend.Pull()
+	if err != nil {
+		return nil, err
+	}
+	remote := &snapshot{Version: snapshotVersion}
+	if pulled != nil {
+		remote, err = parseSnapshot(pulled)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result.Merged, err = mergeChanges(tx, userID, remote.changes(), false)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	local, err := takeSnapshot(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := local.marshal()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(b, pulled) {
+		return result, nil
+	}
+	err = backend.Push(b)
+	if err != nil {
+		return nil, err
+	}
+	result.Sent = local.countNew(remote)
+	return result, nil
+}
+
+func parseSnapshot(b []byte) (*snapshot, error) {
+	s := &snapshot{}
+	err := json.Unmarshal(b, s)
+	if err != nil {
+		return nil, fmt.Errorf("bad snapshot: %w", err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d isn't supported, update vocab", s.Version)
+	}
+	return s, nil
+}
+
+// takeSnapshot returns the snapshot of the collection of the user with the
+// given ID.
+func takeSnapshot(db *gorm.DB, userID uint) (*snapshot, error) {
+	all := func(db *gorm.DB) *gorm.DB { return db }
+	changes, err := findChanges(db, userID, "", all, all, all)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snapshot{
+		Version: snapshotVersion,
+		Vocab:   make([]snapshotVocab, 0),
+		Reviews: make([]snapshotReview, 0),
+		Deleted: make([]snapshotDeletion, 0),
+		Undone:  make([]snapshotDeletion, 0),
+	}
+	deleted := make(map[string]int)
+	for _, c := range changes {
+		if c.Type == changeVocab {
+			s.Vocab = append(s.Vocab, snapshotVocab{
+				SyncID:         c.SyncID,
+				Term:           c.Term,
+				Translation:    c.Translation,
+				KnowledgeLevel: c.KnowledgeLevel,
+				PracticeAt:     snapshotTime(*c.PracticeAt),
+				EditedAt:       snapshotTime(*c.EditedAt),
+				ReviewedAt:     snapshotTimePtr(c.ReviewedAt),
+			})
+		} else if c.Type == changeReview {
+			s.Reviews = append(s.Reviews, snapshotReview{
+				SyncID:      c.SyncID,
+				VocabSyncID: c.VocabSyncID,
+				Passed:      c.Passed,
+				CreatedAt:   snapshotTime(*c.CreatedAt),
+			})
+		} else if c.Type == changeUndo {
+			s.Undone = append(s.Undone, snapshotDeletion{SyncID: c.SyncID, DeletedAt: snapshotTime(*c.DeletedAt)})
+		} else if idx, ok := deleted[c.SyncID]; ok {
+			// Only the last deletion matters.
+			if snapshotTime(*c.DeletedAt).After(s.Deleted[idx].DeletedAt) {
+				s.Deleted[idx].DeletedAt = snapshotTime(*c.DeletedAt)
+			}
+		} else {
+			deleted[c.SyncID] = len(s.Deleted)
+			s.Deleted = append(s.Deleted, snapshotDeletion{SyncID: c.SyncID, DeletedAt: snapshotTime(*c.DeletedAt)})
+		}
+	}
+
+	sort.Slice(s.Vocab, func(i, j int) bool {
+		return s.Vocab[i].SyncID < s.Vocab[j].SyncID
+	})
+	// In the order they were made, so new reviews are added at the end.
+	sort.Slice(s.Reviews, func(i, j int) bool {
+		if !s.Reviews[i].CreatedAt.Equal(s.Reviews[j].CreatedAt) {
+			return s.Reviews[i].CreatedAt.Before(s.Reviews[j].CreatedAt)
+		}
+		return s.Reviews[i].SyncID < s.Reviews[j].SyncID
+	})
+	sort.Slice(s.Deleted, func(i, j int) bool {
+		return s.Deleted[i].SyncID < s.Deleted[j].SyncID
+	})
+	sort.Slice(s.Undone, func(i, j int) bool {
+		return s.Undone[i].SyncID < s.Undone[j].SyncID
+	})
+	return s, nil
+}
+
+func (s *snapshot) marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// changes returns the snapshot as changes to merge.
+func (s *snapshot) changes() []change {
+	changes := make([]change, 0, len(s.Vocab)+len(s.Reviews)+len(s.Deleted)+len(s.Undone))
+	for idx := range s.Vocab {
+		v := &s.Vocab[idx]
+		changes = append(changes, change{
+			Type:           changeVocab,
+			SyncID:         v.SyncID,
+			Term:           v.Term,
+			Translation:    v.Translation,
+			KnowledgeLevel: v.KnowledgeLevel,
+			PracticeAt:     &v.PracticeAt,
+			EditedAt:       &v.EditedAt,
+			ReviewedAt:     v.ReviewedAt,
+		})
+	}
+	for idx := range s.Reviews {
+		r := &s.Reviews[idx]
+		changes = append(changes, change{
+			Type:        changeReview,
+			SyncID:      r.SyncID,
+			VocabSyncID: r.VocabSyncID,
+			Passed:      r.Passed,
+			CreatedAt:   &r.CreatedAt,
+		})
+	}
+	for idx := range s.Deleted {
+		d := &s.Deleted[idx]
+		changes = append(changes, change{
+			Type:      changeDelete,
+			SyncID:    d.SyncID,
+			DeletedAt: &d.DeletedAt,
+		})
+	}
+	for idx := range s.Undone {
+		u := &s.Undone[idx]
+		changes = append(changes, change{
+			Type:      changeUndo,
+			SyncID:    u.SyncID,
+			DeletedAt: &u.DeletedAt,
+		})
+	}
+	return changes
+}
+
+// countNew returns the number of vocab, reviews, deletions and undone reviews
+// of s that are new or changed since old.
+func (s *snapshot) countNew(old *snapshot) int {
+	seen := make(map[string]bool)
+	key := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	for _, v := range old.Vocab {
+		seen[key(v)] = true
+	}
+	for _, r := range old.Reviews {
+		seen[key(r)] = true
+	}
+	for _, d := range old.Deleted {
+		seen[key(d)] = true
+	}
+	for _, u := range old.Undone {
+		seen[key(u)] = true
+	}
+
+	count := 0
+	for _, v := range s.Vocab {
+		if !seen[key(v)] {
+			count++
+		}
+	}
+	for _, r := range s.Reviews {
+		if !seen[key(r)] {
+			count++
+		}
+	}
+	for _, d := range s.Deleted {
+		if !seen[key(d)] {
+			count++
+		}
+	}
+	for _, u := range s.Undone {
+		if !seen[key(u)] {
+			count++
+		}
+	}
+	return count
+}
+
+// snapshotTime returns the time in UTC to the microsecond, as PostgreSQL
+// keeps it, so a snapshot merged into PostgreSQL gives the same snapshot.
+func snapshotTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func snapshotTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := snapshotTime(*t)
+	return &u
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// memoryBackend is a SyncBackend in memory.
+type memoryBackend struct {
+	snapshot []byte
+	pushes   int
+}
+
+func (m *memoryBackend) Pull() ([]byte, error) {
+	return m.snapshot, nil
+}
+
+func (m *memoryBackend) Push(snapshot []byte) error {
+	m.snapshot = snapshot
+	m.pushes++
+	return nil
+}
+
+func requireSyncBackend(t *testing.T, db *gorm.DB, backend SyncBackend) *SyncResult {
+	result, err := syncBackend(db, noUser, backend)
+	require.Nil(t, err)
+	return result
+}
+
+func requireSameSnapshot(t *testing.T, db1, db2 *gorm.DB) {
+	s1, err := takeSnapshot(db1, noUser)
+	require.Nil(t, err)
+	b1, err := s1.marshal()
+	require.Nil(t, err)
+	s2, err := takeSnapshot(db2, noUser)
+	require.Nil(t, err)
+	b2, err := s2.marshal()
+	require.Nil(t, err)
+	require.Equal(t, string(b1), string(b2))
+}
+
+func Test_SyncBackend(t *testing.T) {
+	backend := &memoryBackend{}
+	laptop, desktop := memoryDb(t), memoryDb(t)
+	config := DefaultConfig()
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	result := requireSyncBackend(t, laptop, backend)
+	require.Equal(t, 0, result.Merged)
+	require.Equal(t, 1, result.Sent)
+	result = requireSyncBackend(t, desktop, backend)
+	require.Equal(t, 1, result.Merged)
+	require.Equal(t, 0, result.Sent)
+	require.Equal(t, 1, backend.pushes)
+
+	// The laptop edits hund, the desktop practises it and deletes katze.
+	_, err = NewGormStore(desktop).CreateVocab("katze", "cat")
+	require.Nil(t, err)
+	requireSyncBackend(t, desktop, backend)
+	requireSyncBackend(t, laptop, backend)
+	_, err = NewGormStore(laptop).UpdateVocab(findVocab(t, laptop, "hund").ID, "hund", "the dog")
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).RecordReview(config, findVocab(t, desktop, "hund").ID, true)
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).DeleteVocab(findVocab(t, desktop, "katze").ID)
+	require.Nil(t, err)
+
+	requireSyncBackend(t, laptop, backend)
+	result = requireSyncBackend(t, desktop, backend)
+	require.Equal(t, 1, result.Merged)
+	// The review, the deletion and hund.
+	require.Equal(t, 3, result.Sent)
+	requireSyncBackend(t, laptop, backend)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	requireSameSnapshot(t, laptop, desktop)
+	hund := findVocab(t, laptop, "hund")
+	require.Equal(t, "the dog", hund.Translation)
+	require.Equal(t, uint(1), hund.KnowledgeLevel)
+	require.Len(t, vocabState(t, laptop), 1)
+
+	// Nothing is pushed if nothing changed.
+	pushes := backend.pushes
+	requireSyncBackend(t, laptop, backend)
+	requireSyncBackend(t, desktop, backend)
+	require.Equal(t, pushes, backend.pushes)
+}
+
+// Undone practice isn't added back from a snapshot taken before the undo.
+func Test_SyncBackend_UndoPractice(t *testing.T) {
+	backend := &memoryBackend{}
+	laptop, desktop := memoryDb(t), memoryDb(t)
+
+	vocab, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	_, err = NewGormStore(laptop).RecordReview(DefaultConfig(), vocab.ID, true)
+	require.Nil(t, err)
+	requireSyncBackend(t, laptop, backend)
+	requireSyncBackend(t, desktop, backend)
+	require.Equal(t, int64(1), countReviews(t, desktop))
+
+	_, err = NewGormStore(laptop).UndoPractice()
+	require.Nil(t, err)
+	requireSyncBackend(t, laptop, backend)
+	requireSyncBackend(t, desktop, backend)
+	requireSyncBackend(t, laptop, backend)
+
+	require.Equal(t, int64(0), countReviews(t, laptop))
+	require.Equal(t, int64(0), countReviews(t, desktop))
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	requireSameSnapshot(t, laptop, desktop)
+	stats, err := NewGormStore(desktop).Stats()
+	require.Nil(t, err)
+	require.Equal(t, int64(0), stats.Last7Days.Reviews)
+}
+
+func Test_SyncBackend_BadSnapshot(t *testing.T) {
+	db := memoryDb(t)
+
+	_, err := syncBackend(db, noUser, &memoryBackend{snapshot: []byte("not json")})
+	require.NotNil(t, err)
+
+	_, err = syncBackend(db, noUser, &memoryBackend{snapshot: []byte(`{"version": 2}`)})
+	require.Equal(t, "snapshot version 2 isn't supported, update vocab", err.Error())
+}
+
+func Test_TakeSnapshot(t *testing.T) {
+	db := memoryDb(t)
+	store := NewGormStore(db)
+	for _, term := range []string{"hund", "katze"} {
+		_, err := store.CreateVocab(term, "bar")
+		require.Nil(t, err)
+	}
+	_, err := store.RecordReview(DefaultConfig(), 1, true)
+	require.Nil(t, err)
+	_, err = store.DeleteVocab(2)
+	require.Nil(t, err)
+
+	s, err := takeSnapshot(db, noUser)
+	require.Nil(t, err)
+	require.Equal(t, snapshotVersion, s.Version)
+	require.Len(t, s.Vocab, 1)
+	require.Len(t, s.Reviews, 1)
+	require.Len(t, s.Deleted, 1)
+	require.Equal(t, s.Vocab[0].SyncID, s.Reviews[0].VocabSyncID)
+	require.Equal(t, "UTC", s.Vocab[0].EditedAt.Location().String())
+
+	// The snapshot merges into an empty collection as it was.
+	other := memoryDb(t)
+	merged, err := mergeChanges(other, noUser, s.changes(), false)
+	require.Nil(t, err)
+	require.Equal(t, 2, merged)
+	requireSameSnapshot(t, db, other)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	backupTimeFormat = "20060102-150405"
+	dailyBackupDate  = "20060102"
+	dailyBackupGlob  = "daily-*.db"
+)
+
+// backupDb writes a consistent snapshot of the database to path, which must
+// not exist. The database can be in use while it's backed up.
+func backupDb(db *gorm.DB, path string) error {
+	if !isSqlite(db) {
+		return ErrNotSqlite
+	}
+	_, err := os.Stat(path)
+	if err == nil {
+		return fmt.Errorf("backup already exists: %s", path)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return db.Exec("vacuum into ?", path).Error
+}
+
+// backupName returns a file name for a backup taken at t, with an optional
+// suffix describing why it was taken.
+func backupName(t time.Time, suffix string) string {
+	if suffix != "" {
+		suffix = "-" + suffix
+	}
+	return fmt.Sprintf("vocab-%s%s.db", t.Format(backupTimeFormat), suffix)
+}
+
+// dailyBackup backs up the database into dir, unless it has already been
+// backed up today, and prunes the daily backups to the newest retention. It
+// returns the path of the new backup, or "" if none was taken. Other backups,
+// e.g. those taken before migrating, are kept. PostgreSQL databases aren't
+// backed up.
+func dailyBackup(db *gorm.DB, dir string, retention int, now time.Time) (string, error) {
+	if retention < 1 || !isSqlite(db) {
+		return "", nil
+	}
+
+	path := filepath.Join(dir, "daily-"+now.Format(dailyBackupDate)+".db")
+	_, err := os.Stat(path)
+	if err == nil {
+		return "", nil
+	}
+	err = backupDb(db, path)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = pruneDailyBackups(dir, retention)
+	return path, err
+}
+
+// pruneDailyBackups removes all but the newest retention daily backups,
+// returning the paths removed.
+func pruneDailyBackups(dir string, retention int) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, dailyBackupGlob))
+	if err != nil {
+		return nil, err
+	}
+	// The names sort by date.
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	removed := make([]string, 0)
+	for idx, path := range paths {
+		if idx < retention {
+			continue
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// BackupInfo describes a backup that passed the checks for restoring.
+type BackupInfo struct {
+	Version int
+	Vocabs  int64
+}
+
+// checkBackup checks that the file at path is an intact vocab database that
+// this version of the app can migrate.
+func checkBackup(path string) (*BackupInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("not a file: %s", path)
+	}
+
+	db, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("not a vocab database: %s: %w", path, err)
+	}
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDb.Close()
+
+	var result string
+	err = db.Raw("pragma integrity_check").Scan(&result).Error
+	if err != nil {
+		return nil, fmt.Errorf("not a vocab database: %s: %w", path, err)
+	}
+	if result != "ok" {
+		return nil, fmt.Errorf("backup is corrupt: %s: %s", path, result)
+	}
+
+	if !db.Migrator().HasTable("vocabs") {
+		return nil, fmt.Errorf("not a vocab database: %s", path)
+	}
+	info := &BackupInfo{}
+	if db.Migrator().HasTable(&SchemaVersion{}) {
+		err = db.Model(&SchemaVersion{}).Select("coalesce(max(version), 0)").Scan(&info.Version).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	if info.Version > latestVersion() {
+		return nil, fmt.Errorf("backup is from a newer version of vocab (schema version %d, supported up to %d)", info.Version, latestVersion())
+	}
+	err = db.Table("vocabs").Count(&info.Vocabs).Error
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// restoreDb replaces the database at dst with a copy of the backup at src.
+// The copy is written next to dst and renamed over it, so dst is never left
+// half written.
+func restoreDb(src, dst string) error {
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return errors.New("can't restore the database onto itself")
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+"-restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, in)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	// Leftovers from the replaced database would corrupt the restored one.
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		err = os.Remove(dst + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fileDb returns a migrated database in a file, with the given vocab.
+func fileDb(t *testing.T, path string, terms ...string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(path))
+	require.Nil(t, err)
+	_, err = migrateUp(db, latestVersion())
+	require.Nil(t, err)
+	for _, term := range terms {
+		_, err = NewGormStore(db).CreateVocab(term, term)
+		require.Nil(t, err)
+	}
+	t.Cleanup(func() {
+		sqlDb, _ := db.DB()
+		sqlDb.Close()
+	})
+	return db
+}
+
+func Test_BackupDb(t *testing.T) {
+	dir := t.TempDir()
+	db := fileDb(t, filepath.Join(dir, "vocab.db"), "foo", "bar")
+
+	path := filepath.Join(dir, "backups", backupName(time.Now(), ""))
+	err := backupDb(db, path)
+	require.Nil(t, err)
+
+	info, err := checkBackup(path)
+	require.Nil(t, err)
+	require.Equal(t, &BackupInfo{Version: latestVersion(), Vocabs: 2}, info)
+
+	err = backupDb(db, path)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "backup already exists")
+}
+
+func Test_DailyBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := fileDb(t, filepath.Join(dir, "vocab.db"), "foo")
+	backups := filepath.Join(dir, "backups")
+	day := time.Date(2021, 5, 1, 9, 0, 0, 0, time.Local)
+
+	path, err := dailyBackup(db, backups, 3, day)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(backups, "daily-20210501.db"), path)
+
+	// Only one backup a day.
+	path, err = dailyBackup(db, backups, 3, day.Add(time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, "", path)
+
+	// Other backups aren't pruned.
+	require.Nil(t, ioutil.WriteFile(filepath.Join(backups, "vocab-20210101-120000-v1.db"), nil, 0600))
+
+	for i := 1; i <= 4; i++ {
+		_, err = dailyBackup(db, backups, 3, day.AddDate(0, 0, i))
+		require.Nil(t, err)
+	}
+	paths, err := filepath.Glob(filepath.Join(backups, "*.db"))
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		filepath.Join(backups, "daily-20210503.db"),
+		filepath.Join(backups, "daily-20210504.db"),
+		filepath.Join(backups, "daily-20210505.db"),
+		filepath.Join(backups, "vocab-20210101-120000-v1.db"),
+	}, paths)
+
+	// Retention 0 turns daily backups off.
+	path, err = dailyBackup(db, backups, 0, day.AddDate(0, 0, 10))
+	require.Nil(t, err)
+	require.Equal(t, "", path)
+}
+
+func Test_CheckBackup(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := checkBackup(filepath.Join(dir, "missing.db"))
+	require.True(t, os.IsNotExist(err))
+
+	notDb := filepath.Join(dir, "notes.txt")
+	require.Nil(t, ioutil.WriteFile(notDb, []byte("definitely not a database, just some text long enough to have a header"), 0600))
+	_, err = checkBackup(notDb)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "not a vocab database")
+
+	otherDb := filepath.Join(dir, "other.db")
+	db, err := gorm.Open(sqlite.Open(otherDb))
+	require.Nil(t, err)
+	require.Nil(t, db.Exec("create table things (id integer)").Error)
+	_, err = checkBackup(otherDb)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "not a vocab database")
+
+	newerDb := filepath.Join(dir, "newer.db")
+	db = fileDb(t, newerDb)
+	require.Nil(t, db.Create(&SchemaVersion{Version: latestVersion() + 1, AppliedAt: time.Now()}).Error)
+	_, err = checkBackup(newerDb)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "newer version of vocab")
+}
+
+func Test_RestoreDb(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "backup.db")
+	fileDb(t, src, "foo", "bar", "baz")
+	dst := filepath.Join(dir, "vocab.db")
+	fileDb(t, dst, "qux")
+
+	err := restoreDb(src, dst)
+	require.Nil(t, err)
+
+	info, err := checkBackup(dst)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), info.Vocabs)
+
+	err = restoreDb(dst, dst)
+	require.NotNil(t, err)
+
+	// No temporary files are left behind.
+	entries, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+}
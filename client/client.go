@@ -0,0 +1,459 @@
+// Package client is a Go client of the vocab API, which is described in
+// openapi.json and served by vocab start at /api/openapi.json.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	// Field is the request field with a bad value, if any.
+	Field string `json:"field,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type Vocab struct {
+	ID             uint      `json:"id"`
+	Term           string    `json:"term"`
+	Translation    string    `json:"translation"`
+	KnowledgeLevel uint      `json:"knowledgeLevel"`
+	PracticeAt     time.Time `json:"practiceAt"`
+}
+
+// TrashedVocab is vocab in the trash, which can be restored until it's
+// purged.
+type TrashedVocab struct {
+	Vocab
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+type VocabPage struct {
+	// Count is the number of matches, on all pages.
+	Count int64   `json:"count"`
+	Items []Vocab `json:"items"`
+}
+
+// VocabQuery filters, orders and pages the vocab list. Empty fields are left
+// to the server's defaults.
+type VocabQuery struct {
+	Term        string
+	Translation string
+	// Mode is "or" to match either the term or the translation, otherwise
+	// both must match.
+	Mode string
+	// OrderBy is one of "", "knowledge_level", "knowledge_level_desc",
+	// "practice_at" or "practice_at_desc".
+	OrderBy string
+	Skip    int
+	Take    int
+}
+
+type PracticeResult struct {
+	ID     uint `json:"id"`
+	Passed bool `json:"passed"`
+}
+
+// TextImport is plain text vocab to import. Empty separators are left to the
+// server's defaults, a tab and a new line.
+type TextImport struct {
+	Text          string `json:"text"`
+	TermSeparator string `json:"termSeparator,omitempty"`
+	CardSeparator string `json:"cardSeparator,omitempty"`
+}
+
+type TextPair struct {
+	Term        string `json:"term"`
+	Translation string `json:"translation"`
+}
+
+type Stats struct {
+	Total       int64 `json:"total"`
+	DueToday    int64 `json:"dueToday"`
+	DueThisWeek int64 `json:"dueThisWeek"`
+	// KnowledgeLevels is the number of vocab at each knowledge level.
+	KnowledgeLevels []int64     `json:"knowledgeLevels"`
+	Last7Days       ReviewStats `json:"last7Days"`
+	Last30Days      ReviewStats `json:"last30Days"`
+	Streak          int         `json:"streak"`
+}
+
+type ReviewStats struct {
+	Reviews  int64   `json:"reviews"`
+	Passed   int64   `json:"passed"`
+	Accuracy float64 `json:"accuracy"`
+}
+
+type User struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+type Session struct {
+	Accounts bool `json:"accounts"`
+	// User is nil if no one is logged in.
+	User          *User `json:"user"`
+	TokenRequired bool  `json:"tokenRequired"`
+}
+
+// ExportQuery selects the format of an export and, except for CSV, the vocab
+// included and how it's arranged. Empty fields are left to the server's
+// defaults.
+type ExportQuery struct {
+	// Format is one of "csv", "md", "html" or "pdf".
+	Format       string
+	MinKnowledge *uint
+	MaxKnowledge *uint
+	GroupBy      string
+	OrderBy      string
+	// CardsPerPage, FontSize and FlipEdge are only for PDF.
+	CardsPerPage int
+	FontSize     int
+	FlipEdge     string
+}
+
+// Change is a change of the vocab of a server, sent between servers to sync
+// them.
+type Change struct {
+	// Type is one of "vocab", "review", "delete" or "undo".
+	Type   string `json:"type"`
+	Device string `json:"device"`
+	SyncID string `json:"syncId"`
+
+	// Vocab.
+	Term           string     `json:"term,omitempty"`
+	Translation    string     `json:"translation,omitempty"`
+	KnowledgeLevel uint       `json:"knowledgeLevel,omitempty"`
+	PracticeAt     *time.Time `json:"practiceAt,omitempty"`
+	EditedAt       *time.Time `json:"editedAt,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewedAt,omitempty"`
+
+	// Review.
+	VocabSyncID string     `json:"vocabSyncId,omitempty"`
+	Passed      bool       `json:"passed,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+
+	// Delete or undo.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// SyncRequest sends the changes of a device to a server, asking for the
+// changes of the server since Cursor, or all of them if Cursor is "".
+type SyncRequest struct {
+	Device  string   `json:"device"`
+	Cursor  string   `json:"cursor"`
+	Changes []Change `json:"changes"`
+}
+
+type SyncResponse struct {
+	Device string `json:"device"`
+	// Cursor is where to continue from at the next sync.
+	Cursor string `json:"cursor"`
+	// Merged is the number of the changes sent that changed the vocab of
+	// the server.
+	Merged  int      `json:"merged"`
+	Changes []Change `json:"changes"`
+}
+
+// Client makes requests to a vocab server. It keeps the session cookie, so
+// after Login the requests work on the vocab of the user.
+type Client struct {
+	// BaseURL is the URL of the server, e.g. "http://localhost:3000".
+	BaseURL string
+	// Token is the API token sent with each request, if not "".
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New(baseURL, token string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Jar: jar},
+	}
+}
+
+func (c *Client) Session() (*Session, error) {
+	session := &Session{}
+	err := c.do("GET", "/api/session", nil, nil, session)
+	return session, err
+}
+
+func (c *Client) Register(username, password string) (*User, error) {
+	user := &User{}
+	err := c.do("POST", "/api/register", nil, credentials{username, password}, user)
+	return user, err
+}
+
+func (c *Client) Login(username, password string) (*User, error) {
+	user := &User{}
+	err := c.do("POST", "/api/login", nil, credentials{username, password}, user)
+	return user, err
+}
+
+func (c *Client) Logout() error {
+	return c.do("POST", "/api/logout", nil, nil, nil)
+}
+
+// CheckToken checks the API token is valid on the server.
+func (c *Client) CheckToken(token string) error {
+	return c.do("POST", "/api/token", nil, struct {
+		Token string `json:"token"`
+	}{token}, nil)
+}
+
+func (c *Client) ListVocab(vq VocabQuery) (*VocabPage, error) {
+	query := url.Values{}
+	setStr(query, "term", vq.Term)
+	setStr(query, "translation", vq.Translation)
+	setStr(query, "mode", vq.Mode)
+	setStr(query, "order_by", vq.OrderBy)
+	setInt(query, "skip", vq.Skip)
+	setInt(query, "take", vq.Take)
+
+	page := &VocabPage{}
+	err := c.do("GET", "/api/vocab", query, nil, page)
+	return page, err
+}
+
+// CreateVocab adds vocab, due for practice today, returning its ID.
+func (c *Client) CreateVocab(term, translation string) (uint, error) {
+	var responseData struct {
+		ID uint `json:"id"`
+	}
+	err := c.do("POST", "/api/vocab", nil, TextPair{term, translation}, &responseData)
+	return responseData.ID, err
+}
+
+// UpdateVocab changes the term and translation of vocab, keeping its
+// knowledge level and practice schedule.
+func (c *Client) UpdateVocab(id uint, term, translation string) (*Vocab, error) {
+	vocab := &Vocab{}
+	err := c.do("PUT", fmt.Sprintf("/api/vocab/%d", id), nil, TextPair{term, translation}, vocab)
+	return vocab, err
+}
+
+// DeleteVocab moves vocab to the trash.
+func (c *Client) DeleteVocab(id uint) error {
+	return c.do("DELETE", fmt.Sprintf("/api/vocab/%d", id), nil, nil, nil)
+}
+
+// Trash returns the vocab in the trash, the last deleted first.
+func (c *Client) Trash() ([]TrashedVocab, error) {
+	vocabs := make([]TrashedVocab, 0)
+	err := c.do("GET", "/api/trash", nil, nil, &vocabs)
+	return vocabs, err
+}
+
+// RestoreVocab moves vocab out of the trash.
+func (c *Client) RestoreVocab(id uint) (*Vocab, error) {
+	vocab := &Vocab{}
+	err := c.do("POST", fmt.Sprintf("/api/vocab/%d/restore", id), nil, nil, vocab)
+	return vocab, err
+}
+
+// DueVocab returns the vocab due for practice, the most overdue first.
+func (c *Client) DueVocab() ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	err := c.do("GET", "/api/practice", nil, nil, &vocabs)
+	return vocabs, err
+}
+
+func (c *Client) CountDueVocab() (int64, error) {
+	var responseData struct {
+		Count int64 `json:"count"`
+	}
+	err := c.do("GET", "/api/practice/count", nil, nil, &responseData)
+	return responseData.Count, err
+}
+
+// Practice records the results of practice, returning the vocab as
+// scheduled. If any vocab isn't found, none of the results are recorded.
+func (c *Client) Practice(results []PracticeResult) ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	err := c.do("POST", "/api/practice", nil, results, &vocabs)
+	return vocabs, err
+}
+
+// UndoPractice undoes the results of practice recorded most recently,
+// returning the vocab as it was before.
+func (c *Client) UndoPractice() ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	err := c.do("POST", "/api/practice/undo", nil, nil, &vocabs)
+	return vocabs, err
+}
+
+// PreviewText returns the vocab that importing the text would add.
+func (c *Client) PreviewText(text TextImport) ([]TextPair, error) {
+	pairs := make([]TextPair, 0)
+	err := c.do("POST", "/api/import/text/preview", nil, text, &pairs)
+	return pairs, err
+}
+
+// ImportText adds the vocab in the text, returning the number added.
+func (c *Client) ImportText(text TextImport) (int, error) {
+	var responseData struct {
+		Count int `json:"count"`
+	}
+	err := c.do("POST", "/api/import/text", nil, text, &responseData)
+	return responseData.Count, err
+}
+
+// ImportCsv adds the vocab in the CSV, in the format of the CSV export,
+// returning the number added.
+func (c *Client) ImportCsv(r io.Reader) (int, error) {
+	var responseData struct {
+		Count int `json:"count"`
+	}
+	err := c.do("POST", "/api/import/csv", nil, rawBody{r, "text/csv"}, &responseData)
+	return responseData.Count, err
+}
+
+// Sync exchanges changes with the server.
+func (c *Client) Sync(req SyncRequest) (*SyncResponse, error) {
+	res := &SyncResponse{}
+	err := c.do("POST", "/api/sync", nil, req, res)
+	return res, err
+}
+
+func (c *Client) Stats() (*Stats, error) {
+	stats := &Stats{}
+	err := c.do("GET", "/api/stats", nil, nil, stats)
+	return stats, err
+}
+
+// Export writes the export to w.
+func (c *Client) Export(w io.Writer, eq ExportQuery) error {
+	query := url.Values{}
+	setStr(query, "format", eq.Format)
+	if eq.MinKnowledge != nil {
+		query.Set("min_knowledge", strconv.Itoa(int(*eq.MinKnowledge)))
+	}
+	if eq.MaxKnowledge != nil {
+		query.Set("max_knowledge", strconv.Itoa(int(*eq.MaxKnowledge)))
+	}
+	setStr(query, "group_by", eq.GroupBy)
+	setStr(query, "order_by", eq.OrderBy)
+	setInt(query, "cards_per_page", eq.CardsPerPage)
+	setInt(query, "font_size", eq.FontSize)
+	setStr(query, "flip_edge", eq.FlipEdge)
+
+	res, err := c.request("GET", "/api/export", query, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// rawBody is a request body sent as is, rather than as JSON.
+type rawBody struct {
+	r           io.Reader
+	contentType string
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// do makes a request with body, if not nil, as JSON unless it's a rawBody,
+// and decodes the JSON
+// response into out, if not nil.
+func (c *Client) do(method, path string, query url.Values, body, out interface{}) error {
+	res, err := c.request(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// request makes a request, returning an *Error if the response isn't a
+// success.
+func (c *Client) request(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	if raw, ok := body.(rawBody); ok {
+		reader = raw.r
+		contentType = raw.contentType
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	return nil, readError(res)
+}
+
+func readError(res *http.Response) error {
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	apiErr := &Error{StatusCode: res.StatusCode}
+	err = json.Unmarshal(b, apiErr)
+	if err != nil || apiErr.Message == "" {
+		// Not the API, e.g. a proxy in front of it.
+		return &Error{StatusCode: res.StatusCode, Message: fmt.Sprintf("%s: %s", res.Status, strings.TrimSpace(string(b)))}
+	}
+	return apiErr
+}
+
+func setStr(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func setInt(query url.Values, key string, value int) {
+	if value != 0 {
+		query.Set(key, strconv.Itoa(value))
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Request_Token(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"count": 3}`))
+	}))
+	defer ts.Close()
+
+	count, err := New(ts.URL+"/", "vocab_abc").CountDueVocab()
+	require.Nil(t, err)
+	require.Equal(t, int64(3), count)
+	require.Equal(t, "Bearer vocab_abc", auth)
+
+	_, err = New(ts.URL, "").CountDueVocab()
+	require.Nil(t, err)
+	require.Equal(t, "", auth)
+}
+
+func Test_Request_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/vocab" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"code": "invalid", "message": "term is required", "field": "term"}`))
+			return
+		}
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, "")
+
+	_, err := c.CreateVocab("", "dog")
+	require.Equal(t, &Error{StatusCode: 422, Code: "invalid", Message: "term is required", Field: "term"}, err)
+
+	_, err = c.Stats()
+	require.Equal(t, &Error{StatusCode: 502, Message: "502 Bad Gateway: bad gateway"}, err)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const configFileName = "config.json"
+
+// Config holds the settings of a profile, read from config.json in the
+// profile directory. Settings missing from the file take their defaults.
+type Config struct {
+	// Port on which to serve the web application.
+	Port string `json:"port"`
+	// OpenBrowser opens a web browser when the web application starts.
+	OpenBrowser bool `json:"open_browser"`
+	// SessionSize is the number of vocab in a practice session.
+	SessionSize int `json:"session_size"`
+	// MaxPageSize caps the number of vocab listed at once.
+	MaxPageSize int `json:"max_page_size"`
+	// Intervals are the days until vocab is next practised after reaching
+	// each knowledge level, from 1 to maxKnowledge.
+	Intervals []int `json:"intervals"`
+	// BackupRetention is the number of daily backups kept. 0 turns daily
+	// backups off.
+	BackupRetention int `json:"backup_retention"`
+	// TrashDays is the number of days deleted vocab stays in the trash,
+	// where it can be restored, before it's purged. 0 keeps it for good.
+	TrashDays int `json:"trash_days"`
+	// Accounts makes the web application ask users to register and log in,
+	// each having their own collection of vocab.
+	Accounts bool `json:"accounts"`
+	// RequireToken makes the API only accept requests with an API token,
+	// created with `vocab token create`. With accounts on, logging in is
+	// enough.
+	RequireToken bool `json:"require_token"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Port:            "3000",
+		OpenBrowser:     false,
+		SessionSize:     10,
+		MaxPageSize:     50,
+		Intervals:       []int{1, 2, 4, 8, 16, 32, 64},
+		BackupRetention: 7,
+		TrashDays:       30,
+		Accounts:        false,
+		RequireToken:    false,
+	}
+}
+
+// configKeys are the settings, in the order they are listed.
+var configKeys = []string{
+	"port",
+	"open_browser",
+	"session_size",
+	"max_page_size",
+	"intervals",
+	"backup_retention",
+	"trash_days",
+	"accounts",
+	"require_token",
+}
+
+type ErrConfig struct {
+	Key     string
+	Message string
+}
+
+func (e ErrConfig) Error() string {
+	return fmt.Sprintf("Bad config. key: %s, %s", e.Key, e.Message)
+}
+
+func (c *Config) Validate() error {
+	port, err := strconv.Atoi(c.Port)
+	if err != nil || port < 1 || port > 65535 {
+		return ErrConfig{Key: "port", Message: "must be a number between 1 and 65535"}
+	}
+	if c.SessionSize < 1 {
+		return ErrConfig{Key: "session_size", Message: "must be at least 1"}
+	}
+	if c.MaxPageSize < 1 {
+		return ErrConfig{Key: "max_page_size", Message: "must be at least 1"}
+	}
+	if len(c.Intervals) != int(maxKnowledge) {
+		return ErrConfig{Key: "intervals", Message: fmt.Sprintf("must have %d entries, one per knowledge level", maxKnowledge)}
+	}
+	for idx, days := range c.Intervals {
+		if days < 1 {
+			return ErrConfig{Key: "intervals", Message: "must all be at least 1 day"}
+		}
+		if idx > 0 && days < c.Intervals[idx-1] {
+			return ErrConfig{Key: "intervals", Message: "must not decrease"}
+		}
+	}
+	if c.BackupRetention < 0 {
+		return ErrConfig{Key: "backup_retention", Message: "must not be negative"}
+	}
+	if c.TrashDays < 0 {
+		return ErrConfig{Key: "trash_days", Message: "must not be negative"}
+	}
+	return nil
+}
+
+// interval returns the days until vocab at the knowledge level is next
+// practised.
+func (c *Config) interval(knowledgeLevel uint) int {
+	if knowledgeLevel == 0 {
+		return 1
+	}
+	return c.Intervals[knowledgeLevel-1]
+}
+
+func (c *Config) Get(key string) (string, error) {
+	switch key {
+	case "port":
+		return c.Port, nil
+	case "open_browser":
+		return strconv.FormatBool(c.OpenBrowser), nil
+	case "session_size":
+		return strconv.Itoa(c.SessionSize), nil
+	case "max_page_size":
+		return strconv.Itoa(c.MaxPageSize), nil
+	case "intervals":
+		days := make([]string, 0, len(c.Intervals))
+		for _, d := range c.Intervals {
+			days = append(days, strconv.Itoa(d))
+		}
+		return strings.Join(days, ","), nil
+	case "backup_retention":
+		return strconv.Itoa(c.BackupRetention), nil
+	case "trash_days":
+		return strconv.Itoa(c.TrashDays), nil
+	case "accounts":
+		return strconv.FormatBool(c.Accounts), nil
+	case "require_token":
+		return strconv.FormatBool(c.RequireToken), nil
+	}
+	return "", ErrConfig{Key: key, Message: "unknown key"}
+}
+
+// Set parses and sets the value of a setting, then validates the config.
+func (c *Config) Set(key, value string) error {
+	var err error
+	switch key {
+	case "port":
+		c.Port = value
+	case "open_browser":
+		c.OpenBrowser, err = strconv.ParseBool(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be true or false"}
+		}
+	case "session_size":
+		c.SessionSize, err = strconv.Atoi(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be a number"}
+		}
+	case "max_page_size":
+		c.MaxPageSize, err = strconv.Atoi(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be a number"}
+		}
+	case "intervals":
+		intervals := make([]int, 0)
+		for _, s := range strings.Split(value, ",") {
+			days, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return ErrConfig{Key: key, Message: "must be a comma separated list of days, e.g. 1,2,4,8,16,32,64"}
+			}
+			intervals = append(intervals, days)
+		}
+		c.Intervals = intervals
+	case "backup_retention":
+		c.BackupRetention, err = strconv.Atoi(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be a number"}
+		}
+	case "trash_days":
+		c.TrashDays, err = strconv.Atoi(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be a number"}
+		}
+	case "accounts":
+		c.Accounts, err = strconv.ParseBool(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be true or false"}
+		}
+	case "require_token":
+		c.RequireToken, err = strconv.ParseBool(value)
+		if err != nil {
+			return ErrConfig{Key: key, Message: "must be true or false"}
+		}
+	default:
+		return ErrConfig{Key: key, Message: "unknown key"}
+	}
+	return c.Validate()
+}
+
+// loadConfig reads the config file at path, returning the default config if
+// the file doesn't exist.
+func loadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("Bad config file. path: %s, %s", path, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s (in %s)", err, path)
+	}
+	return config, nil
+}
+
+func saveConfig(path string, config *Config) error {
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0600)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadConfig_Missing(t *testing.T) {
+	config, err := loadConfig(filepath.Join(t.TempDir(), configFileName))
+	require.Nil(t, err)
+	require.Equal(t, DefaultConfig(), config)
+}
+
+func Test_LoadConfig_Partial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), configFileName)
+	err := ioutil.WriteFile(path, []byte(`{"port": "8080", "session_size": 20}`), 0600)
+	require.Nil(t, err)
+
+	config, err := loadConfig(path)
+	require.Nil(t, err)
+	require.Equal(t, "8080", config.Port)
+	require.Equal(t, 20, config.SessionSize)
+	require.Equal(t, DefaultConfig().MaxPageSize, config.MaxPageSize)
+	require.Equal(t, DefaultConfig().Intervals, config.Intervals)
+}
+
+func Test_LoadConfig_Invalid(t *testing.T) {
+	cases := []struct {
+		json     string
+		contains string
+	}{
+		{`{"port": "eighty"}`, "key: port"},
+		{`{"session_size": 0}`, "key: session_size"},
+		{`{"intervals": [1, 2, 3]}`, "must have 7 entries"},
+		{`{"trash_days": -1}`, "key: trash_days"},
+		{`{"colour": "blue"}`, "unknown field"},
+		{`{"port": `, "Bad config file"},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), configFileName)
+		err := ioutil.WriteFile(path, []byte(c.json), 0600)
+		require.Nil(t, err)
+
+		_, err = loadConfig(path)
+		require.NotNil(t, err, c.json)
+		require.Contains(t, err.Error(), c.contains)
+	}
+}
+
+func Test_SaveConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), configFileName)
+	config := DefaultConfig()
+	require.Nil(t, config.Set("open_browser", "true"))
+	require.Nil(t, config.Set("intervals", "1, 3, 7, 14, 30, 60, 120"))
+	require.Nil(t, saveConfig(path, config))
+
+	loaded, err := loadConfig(path)
+	require.Nil(t, err)
+	require.Equal(t, config, loaded)
+}
+
+func Test_Config_GetSet(t *testing.T) {
+	config := DefaultConfig()
+
+	for _, key := range configKeys {
+		value, err := config.Get(key)
+		require.Nil(t, err)
+		require.Nil(t, config.Set(key, value), key)
+	}
+	require.Equal(t, DefaultConfig(), config)
+
+	require.Nil(t, config.Set("max_page_size", "100"))
+	value, err := config.Get("max_page_size")
+	require.Nil(t, err)
+	require.Equal(t, "100", value)
+
+	require.Equal(t, ErrConfig{Key: "nope", Message: "unknown key"}, config.Set("nope", "1"))
+	_, err = config.Get("nope")
+	require.Equal(t, ErrConfig{Key: "nope", Message: "unknown key"}, err)
+
+	require.Equal(t, ErrConfig{Key: "open_browser", Message: "must be true or false"}, config.Set("open_browser", "maybe"))
+	require.Equal(t, ErrConfig{Key: "intervals", Message: "must not decrease"}, config.Set("intervals", "1,2,4,8,16,64,32"))
+}
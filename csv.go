@@ -7,17 +7,24 @@ import (
 	"io"
 	"strconv"
 	"time"
-
-	"gorm.io/gorm"
 )
 
+const defaultImportBatchSize = 500
+
 type Csv struct {
-	db *gorm.DB
+	store Store
+	// BatchSize is the number of rows added to the store at a time when
+	// importing.
+	BatchSize int
+	// Progress, if set, is called after each batch is inserted with the
+	// total number of rows imported so far.
+	Progress func(rows int)
 }
 
-func NewCsv(db *gorm.DB) *Csv {
+func NewCsv(store Store) *Csv {
 	return &Csv{
-		db: db,
+		store:     store,
+		BatchSize: defaultImportBatchSize,
 	}
 }
 
@@ -29,10 +36,9 @@ func (c *Csv) Export(w io.Writer) error {
 		return err
 	}
 
-	vocabs := make([]Vocab, 0)
-	dbResult := c.db.Find(&vocabs)
-	if dbResult.Error != nil {
-		return dbResult.Error
+	vocabs, err := c.store.AllVocab()
+	if err != nil {
+		return err
 	}
 
 	for _, vocab := range vocabs {
@@ -51,22 +57,22 @@ func (c *Csv) Export(w io.Writer) error {
 }
 
 func (c *Csv) Import(r io.Reader) error {
-	return c.db.Transaction(func(tx *gorm.DB) error {
+	return c.store.Transaction(func(tx Store) error {
 		return c.doImport(tx, r)
 	})
 }
 
 func (c *Csv) ImportClean(r io.Reader) error {
-	return c.db.Transaction(func(tx *gorm.DB) error {
-		dbResult := tx.Where("1 = 1").Delete(&Vocab{})
-		if dbResult.Error != nil {
-			return dbResult.Error
+	return c.store.Transaction(func(tx Store) error {
+		err := tx.DeleteAllVocab()
+		if err != nil {
+			return err
 		}
 		return c.doImport(tx, r)
 	})
 }
 
-func (c *Csv) doImport(tx *gorm.DB, r io.Reader) error {
+func (c *Csv) doImport(tx Store, r io.Reader) error {
 	csvReader := csv.NewReader(r)
 
 	headings, err := csvReader.Read()
@@ -85,39 +91,66 @@ func (c *Csv) doImport(tx *gorm.DB, r io.Reader) error {
 		}
 	}
 
-	rows, err := csvReader.ReadAll()
-	if err != nil {
-		return err
+	batchSize := c.BatchSize
+	if batchSize < 1 {
+		batchSize = defaultImportBatchSize
 	}
+	batch := make([]Vocab, 0, batchSize)
+	imported := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := tx.AddVocab(batch)
+		if err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		if c.Progress != nil {
+			c.Progress(imported)
+		}
+		return nil
+	}
+
+	for number := 2; ; number++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ErrBadRow{Number: number}
+		}
 
-	for idx, row := range rows {
 		dRow, err := dictRow(row, headings)
 		if err != nil {
-			return ErrBadRow{Number: idx + 2}
+			return ErrBadRow{Number: number}
 		}
 
 		knowledgeLevel, err := strconv.Atoi(dRow["knowledge_level"])
 		if err != nil {
-			return ErrBadRow{Number: idx + 2, Field: "knowledge_level"}
+			return ErrBadRow{Number: number, Field: "knowledge_level"}
 		}
 
 		praticeAt, err := time.Parse(time.RFC3339, dRow["practice_at"])
 		if err != nil {
-			return ErrBadRow{Number: idx + 2, Field: "practice_at"}
+			return ErrBadRow{Number: number, Field: "practice_at"}
 		}
 
-		vocab := &Vocab{
+		batch = append(batch, Vocab{
 			Term:           dRow["term"],
 			Translation:    dRow["translation"],
 			KnowledgeLevel: uint(knowledgeLevel),
 			PracticeAt:     praticeAt,
-		}
-		dbResult := tx.Create(vocab)
-		if dbResult.Error != nil {
-			return dbResult.Error
+		})
+		if len(batch) == batchSize {
+			if err = flush(); err != nil {
+				return err
+			}
 		}
 	}
-	return nil
+	return flush()
 }
 
 type ErrMissingHeading struct {
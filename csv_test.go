@@ -8,40 +8,41 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func Test_Csv_Export(t *testing.T) {
-	db := memoryDb(t)
-
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 3,
-		PracticeAt:     inDays(2),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
-	})
-	require.Nil(t, dbResult.Error)
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(2),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
 
-	csv := NewCsv(db)
+		csv := NewCsv(NewGormStore(db))
 
-	var buf bytes.Buffer
-	err := csv.Export(&buf)
-	require.Nil(t, err)
+		var buf bytes.Buffer
+		err := csv.Export(&buf)
+		require.Nil(t, err)
 
-	data, err := ioutil.ReadAll(&buf)
-	require.Nil(t, err)
+		data, err := ioutil.ReadAll(&buf)
+		require.Nil(t, err)
 
-	expected := fmt.Sprintf(`term,translation,knowledge_level,practice_at
+		expected := fmt.Sprintf(`term,translation,knowledge_level,practice_at
 foo1,bar1,3,%s
 foo2,bar2,1,%s
 `, inDaysJSON(2), inDaysJSON(1))
-	require.Equal(t, expected, string(data))
+		require.Equal(t, expected, string(data))
+	})
 }
 
 func Test_Csv_Import(t *testing.T) {
@@ -57,8 +58,52 @@ foo2,bar2,1,%s
 	}
 
 	for _, data := range cases {
-		db := memoryDb(t)
+		forEachDb(t, func(t *testing.T, db *gorm.DB) {
+			dbResult := db.Create(&Vocab{
+				Term:           "hello",
+				Translation:    "world",
+				KnowledgeLevel: 1,
+				PracticeAt:     inDays(1),
+			})
+			require.Nil(t, dbResult.Error)
+
+			csv := NewCsv(NewGormStore(db))
+
+			err := csv.Import(strings.NewReader(data))
+			require.Nil(t, err)
+
+			var count int64
+			dbResult = db.Model(&Vocab{}).Count(&count)
+			require.Nil(t, dbResult.Error)
+			require.Equal(t, int64(3), count)
+
+			vocabs := make([]Vocab, 0)
+			dbResult = db.Order("id").Find(&vocabs)
+			require.Nil(t, dbResult.Error)
+
+			require.Equal(t, uint(1), vocabs[0].ID)
+			require.Equal(t, "hello", vocabs[0].Term)
+			require.Equal(t, "world", vocabs[0].Translation)
+			require.Equal(t, uint(1), vocabs[0].KnowledgeLevel)
+			require.True(t, vocabs[0].PracticeAt.Equal(inDays(1)))
+
+			require.Equal(t, uint(2), vocabs[1].ID)
+			require.Equal(t, "foo1", vocabs[1].Term)
+			require.Equal(t, "bar1", vocabs[1].Translation)
+			require.Equal(t, uint(3), vocabs[1].KnowledgeLevel)
+			require.True(t, vocabs[1].PracticeAt.Equal(inDays(2)))
+
+			require.Equal(t, uint(3), vocabs[2].ID)
+			require.Equal(t, "foo2", vocabs[2].Term)
+			require.Equal(t, "bar2", vocabs[2].Translation)
+			require.Equal(t, uint(1), vocabs[2].KnowledgeLevel)
+			require.True(t, vocabs[2].PracticeAt.Equal(inDays(1)))
+		})
+	}
+}
 
+func Test_Csv_Import_Clean(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
 		dbResult := db.Create(&Vocab{
 			Term:           "hello",
 			Translation:    "world",
@@ -66,147 +111,172 @@ foo2,bar2,1,%s
 			PracticeAt:     inDays(1),
 		})
 		require.Nil(t, dbResult.Error)
+		_, err := NewGormStore(db).RecordReview(DefaultConfig(), 1, true)
+		require.Nil(t, err)
 
-		csv := NewCsv(db)
+		data := strings.NewReader(fmt.Sprintf(`term,translation,knowledge_level,practice_at
+foo1,bar1,3,%s
+foo2,bar2,1,%s
+`, inDaysJSON(2), inDaysJSON(1)))
 
-		err := csv.Import(strings.NewReader(data))
+		csv := NewCsv(NewGormStore(db))
+
+		err = csv.ImportClean(data)
+		require.Nil(t, err)
+
+		// The reviews of the old vocab are gone.
+		stats, err := NewGormStore(db).Stats()
 		require.Nil(t, err)
+		require.Equal(t, ReviewStats{}, stats.Last7Days)
+		require.Equal(t, ReviewStats{}, stats.Last30Days)
+		require.Equal(t, 0, stats.Streak)
 
 		var count int64
 		dbResult = db.Model(&Vocab{}).Count(&count)
 		require.Nil(t, dbResult.Error)
-		require.Equal(t, int64(3), count)
+		require.Equal(t, int64(2), count)
 
 		vocabs := make([]Vocab, 0)
-		dbResult = db.Find(&vocabs)
+		dbResult = db.Order("id").Find(&vocabs)
 		require.Nil(t, dbResult.Error)
 
 		require.Equal(t, uint(1), vocabs[0].ID)
-		require.Equal(t, "hello", vocabs[0].Term)
-		require.Equal(t, "world", vocabs[0].Translation)
-		require.Equal(t, uint(1), vocabs[0].KnowledgeLevel)
-		require.True(t, vocabs[0].PracticeAt.Equal(inDays(1)))
+		require.Equal(t, "foo1", vocabs[0].Term)
+		require.Equal(t, "bar1", vocabs[0].Translation)
+		require.Equal(t, uint(3), vocabs[0].KnowledgeLevel)
+		require.True(t, vocabs[0].PracticeAt.Equal(inDays(2)))
 
 		require.Equal(t, uint(2), vocabs[1].ID)
-		require.Equal(t, "foo1", vocabs[1].Term)
-		require.Equal(t, "bar1", vocabs[1].Translation)
-		require.Equal(t, uint(3), vocabs[1].KnowledgeLevel)
-		require.True(t, vocabs[1].PracticeAt.Equal(inDays(2)))
-
-		require.Equal(t, uint(3), vocabs[2].ID)
-		require.Equal(t, "foo2", vocabs[2].Term)
-		require.Equal(t, "bar2", vocabs[2].Translation)
-		require.Equal(t, uint(1), vocabs[2].KnowledgeLevel)
-		require.True(t, vocabs[2].PracticeAt.Equal(inDays(1)))
-	}
-
+		require.Equal(t, "foo2", vocabs[1].Term)
+		require.Equal(t, "bar2", vocabs[1].Translation)
+		require.Equal(t, uint(1), vocabs[1].KnowledgeLevel)
+		require.True(t, vocabs[1].PracticeAt.Equal(inDays(1)))
+	})
 }
 
-func Test_Csv_Import_Clean(t *testing.T) {
-	db := memoryDb(t)
-
-	dbResult := db.Create(&Vocab{
-		Term:           "hello",
-		Translation:    "world",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
-	})
-	require.Nil(t, dbResult.Error)
+func Test_ExportImport(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(2),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
 
-	data := strings.NewReader(fmt.Sprintf(`term,translation,knowledge_level,practice_at
-foo1,bar1,3,%s
-foo2,bar2,1,%s
-`, inDaysJSON(2), inDaysJSON(1)))
+		csv := NewCsv(NewGormStore(db))
 
-	csv := NewCsv(db)
+		var buf bytes.Buffer
+		err := csv.Export(&buf)
+		require.Nil(t, err)
 
-	err := csv.ImportClean(data)
-	require.Nil(t, err)
+		err = csv.Import(&buf)
+		require.Nil(t, err)
 
-	var count int64
-	dbResult = db.Model(&Vocab{}).Count(&count)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, int64(2), count)
+		var count int64
+		dbResult = db.Model(&Vocab{}).Count(&count)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(4), count)
+	})
+}
 
-	vocabs := make([]Vocab, 0)
-	dbResult = db.Find(&vocabs)
-	require.Nil(t, dbResult.Error)
+func Test_Import_ErrMissingHeading(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		data := strings.NewReader(fmt.Sprintf(`term,knowledge_level,practice_at
+foo1,3,%s
+foo2,1,%s
+`, inDaysJSON(2), inDaysJSON(1)))
 
-	require.Equal(t, uint(1), vocabs[0].ID)
-	require.Equal(t, "foo1", vocabs[0].Term)
-	require.Equal(t, "bar1", vocabs[0].Translation)
-	require.Equal(t, uint(3), vocabs[0].KnowledgeLevel)
-	require.True(t, vocabs[0].PracticeAt.Equal(inDays(2)))
+		csv := NewCsv(NewGormStore(db))
 
-	require.Equal(t, uint(2), vocabs[1].ID)
-	require.Equal(t, "foo2", vocabs[1].Term)
-	require.Equal(t, "bar2", vocabs[1].Translation)
-	require.Equal(t, uint(1), vocabs[1].KnowledgeLevel)
-	require.True(t, vocabs[1].PracticeAt.Equal(inDays(1)))
+		err := csv.Import(data)
+		require.ErrorIs(t, err, ErrMissingHeading{Heading: "translation"})
+	})
 }
 
-func Test_ExportImport(t *testing.T) {
-	db := memoryDb(t)
+func Test_Import_ErrBadRow(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		data := strings.NewReader(fmt.Sprintf(`term,translation,knowledge_level,practice_at
+foo1,bar1,3,%s
+foo2,bar2,a,%s
+`, inDaysJSON(2), inDaysJSON(1)))
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 3,
-		PracticeAt:     inDays(2),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
+		csv := NewCsv(NewGormStore(db))
+
+		err := csv.Import(data)
+		require.ErrorIs(t, err, ErrBadRow{Number: 3, Field: "knowledge_level"})
+
+		var count int64
+		dbResult := db.Model(&Vocab{}).Count(&count)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(0), count)
 	})
-	require.Nil(t, dbResult.Error)
+}
 
-	csv := NewCsv(db)
+func Test_Import_Batches(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		data := strings.NewReader(csvRows(7))
 
-	var buf bytes.Buffer
-	err := csv.Export(&buf)
-	require.Nil(t, err)
+		csv := NewCsv(NewGormStore(db))
+		csv.BatchSize = 3
+		progress := make([]int, 0)
+		csv.Progress = func(rows int) {
+			progress = append(progress, rows)
+		}
 
-	err = csv.Import(&buf)
-	require.Nil(t, err)
+		err := csv.Import(data)
+		require.Nil(t, err)
+		require.Equal(t, []int{3, 6, 7}, progress)
 
-	var count int64
-	dbResult = db.Model(&Vocab{}).Count(&count)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, int64(4), count)
+		var count int64
+		dbResult := db.Model(&Vocab{}).Count(&count)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(7), count)
+	})
 }
 
-func Test_Import_ErrMissingHeading(t *testing.T) {
-	db := memoryDb(t)
+func Test_Import_Batches_ErrBadRow(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		data := strings.NewReader(csvRows(5) + "foo,bar,1,never\n")
 
-	data := strings.NewReader(fmt.Sprintf(`term,knowledge_level,practice_at
-foo1,3,%s
-foo2,1,%s
-`, inDaysJSON(2), inDaysJSON(1)))
+		csv := NewCsv(NewGormStore(db))
+		csv.BatchSize = 2
 
-	csv := NewCsv(db)
+		err := csv.Import(data)
+		require.ErrorIs(t, err, ErrBadRow{Number: 7, Field: "practice_at"})
 
-	err := csv.Import(data)
-	require.ErrorIs(t, err, ErrMissingHeading{Heading: "translation"})
+		var count int64
+		dbResult := db.Model(&Vocab{}).Count(&count)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(0), count)
+	})
 }
 
-func Test_Import_ErrBadRow(t *testing.T) {
-	db := memoryDb(t)
-
-	data := strings.NewReader(fmt.Sprintf(`term,translation,knowledge_level,practice_at
-foo1,bar1,3,%s
-foo2,bar2,a,%s
-`, inDaysJSON(2), inDaysJSON(1)))
+func Benchmark_Csv_Import(b *testing.B) {
+	data := csvRows(10000)
 
-	csv := NewCsv(db)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		csv := NewCsv(NewGormStore(memoryDb(b)))
+		b.StartTimer()
 
-	err := csv.Import(data)
-	require.ErrorIs(t, err, ErrBadRow{Number: 3, Field: "knowledge_level"})
+		err := csv.Import(strings.NewReader(data))
+		require.Nil(b, err)
+	}
+}
 
-	var count int64
-	dbResult := db.Model(&Vocab{}).Count(&count)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, int64(0), count)
+func csvRows(n int) string {
+	var sb strings.Builder
+	sb.WriteString("term,translation,knowledge_level,practice_at\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "foo%d,bar%d,%d,%s\n", i, i, i%8, inDaysJSON(i%30))
+	}
+	return sb.String()
 }
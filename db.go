@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var ErrNotSqlite = errors.New("backups are only supported for SQLite. for PostgreSQL, use pg_dump and pg_restore")
+
+// dialector returns the database driver for the location: PostgreSQL if a DSN
+// is set, otherwise SQLite.
+func (l *Location) dialector() gorm.Dialector {
+	if l.DSN != "" {
+		return postgres.Open(l.DSN)
+	}
+	return sqlite.Open(l.DB)
+}
+
+func isSqlite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
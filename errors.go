@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// Codes of ApiError, which clients can rely on, unlike the messages.
+const (
+	codeInvalidJSON  = "invalid_json"
+	codeBadRequest   = "bad_request"
+	codeInvalid      = "invalid"
+	codeNotFound     = "not_found"
+	codeConflict     = "conflict"
+	codeTooLarge     = "too_large"
+	codeUnauthorized = "unauthorized"
+	codeInternal     = "internal"
+)
+
+// ApiError is an error response of the API, written as JSON.
+type ApiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Field is the request field with a bad value, if any, e.g. "term" or
+	// "[0].id".
+	Field string `json:"field,omitempty"`
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+func badRequest(field, message string) *ApiError {
+	return &ApiError{Status: http.StatusBadRequest, Code: codeBadRequest, Message: message, Field: field}
+}
+
+// ErrInvalid is a field of a request with a value that isn't valid.
+type ErrInvalid struct {
+	Field   string
+	Message string
+}
+
+func (e ErrInvalid) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// toApiError returns the response for an error, or nil if the error is
+// unexpected.
+func toApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var invalid ErrInvalid
+	if errors.As(err, &invalid) {
+		return &ApiError{Status: http.StatusUnprocessableEntity, Code: codeInvalid, Message: invalid.Error(), Field: invalid.Field}
+	}
+	if errors.Is(err, ErrVocabNotFound) {
+		return &ApiError{Status: http.StatusNotFound, Code: codeNotFound, Message: err.Error()}
+	}
+	if errors.Is(err, ErrNothingToUndo) {
+		return &ApiError{Status: http.StatusConflict, Code: codeConflict, Message: err.Error()}
+	}
+	if errors.Is(err, ErrUsernameTaken) {
+		return &ApiError{Status: http.StatusConflict, Code: codeConflict, Message: err.Error(), Field: "username"}
+	}
+	if errors.Is(err, ErrBadLogin) || errors.Is(err, ErrNoSession) || errors.Is(err, ErrBadToken) {
+		return &ApiError{Status: http.StatusUnauthorized, Code: codeUnauthorized, Message: err.Error()}
+	}
+	return nil
+}
+
+// writeError writes the response for err. Unexpected errors are logged and
+// answered with a 500, without details.
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := toApiError(err)
+	if apiErr == nil {
+		log.Println(err)
+		apiErr = &ApiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "Oops, something went wrong..."}
+	}
+
+	b, _ := json.Marshal(apiErr)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	w.Write(b)
+}
+
+// maxRequestBytes caps the size of a JSON request body, which is read into
+// memory. It leaves room for syncing and importing large collections.
+const maxRequestBytes = 32 << 20
+
+// readJSON decodes the JSON request body into v.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	// MaxBytesReader fails once it has read up to the limit.
+	if err != nil && len(body) == maxRequestBytes {
+		return &ApiError{Status: http.StatusRequestEntityTooLarge, Code: codeTooLarge, Message: fmt.Sprintf("request body must be at most %d bytes", maxRequestBytes)}
+	}
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		name := typeErr.Field
+		if name == "" {
+			name = "request body"
+		}
+		return &ApiError{Status: http.StatusBadRequest, Code: codeInvalidJSON, Message: fmt.Sprintf("%s can't be a JSON %s", name, typeErr.Value), Field: typeErr.Field}
+	}
+	if err != nil {
+		return &ApiError{Status: http.StatusBadRequest, Code: codeInvalidJSON, Message: "request body must be valid JSON: " + err.Error()}
+	}
+	return nil
+}
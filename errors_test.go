@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ToApiError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+		field  string
+	}{
+		{ErrInvalid{Field: "term", Message: "is required"}, http.StatusUnprocessableEntity, codeInvalid, "term"},
+		{fmt.Errorf("creating vocab: %w", ErrVocabNotFound), http.StatusNotFound, codeNotFound, ""},
+		{ErrUsernameTaken, http.StatusConflict, codeConflict, "username"},
+		{ErrBadLogin, http.StatusUnauthorized, codeUnauthorized, ""},
+		{ErrBadToken, http.StatusUnauthorized, codeUnauthorized, ""},
+		{badRequest("format", "format must be one of csv, md"), http.StatusBadRequest, codeBadRequest, "format"},
+	}
+	for _, c := range cases {
+		apiErr := toApiError(c.err)
+		require.NotNil(t, apiErr, c.err.Error())
+		require.Equal(t, c.status, apiErr.Status, c.err.Error())
+		require.Equal(t, c.code, apiErr.Code, c.err.Error())
+		require.Equal(t, c.field, apiErr.Field, c.err.Error())
+	}
+
+	require.Nil(t, toApiError(errors.New("database is locked")))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ExportOptions selects and arranges the vocab included in a Markdown or HTML
+// export.
+type ExportOptions struct {
+	MinKnowledgeLevel uint
+	MaxKnowledgeLevel uint
+	// GroupBy is one of "", "knowledge_level" or "letter".
+	GroupBy string
+	// OrderBy is one of "term", "translation", "knowledge_level" or "practice_at".
+	OrderBy string
+}
+
+func DefaultExportOptions() ExportOptions {
+	return ExportOptions{
+		MinKnowledgeLevel: 0,
+		MaxKnowledgeLevel: maxKnowledge,
+		GroupBy:           "",
+		OrderBy:           "term",
+	}
+}
+
+func (o ExportOptions) Validate() error {
+	if o.MinKnowledgeLevel > o.MaxKnowledgeLevel {
+		return fmt.Errorf("min knowledge level %d is greater than max knowledge level %d", o.MinKnowledgeLevel, o.MaxKnowledgeLevel)
+	}
+	if o.GroupBy != "" && o.GroupBy != "knowledge_level" && o.GroupBy != "letter" {
+		return fmt.Errorf("group by must be one of knowledge_level, letter. got: %s", o.GroupBy)
+	}
+	if _, ok := exportLess[o.OrderBy]; !ok {
+		return fmt.Errorf("order by must be one of term, translation, knowledge_level, practice_at. got: %s", o.OrderBy)
+	}
+	return nil
+}
+
+// exportLess orders vocab by each OrderBy, then by term. Vocab that is
+// otherwise equal stays in the order it was added.
+var exportLess = map[string]func(a, b Vocab) bool{
+	"term": func(a, b Vocab) bool {
+		return a.Term < b.Term
+	},
+	"translation": func(a, b Vocab) bool {
+		if a.Translation != b.Translation {
+			return a.Translation < b.Translation
+		}
+		return a.Term < b.Term
+	},
+	"knowledge_level": func(a, b Vocab) bool {
+		if a.KnowledgeLevel != b.KnowledgeLevel {
+			return a.KnowledgeLevel < b.KnowledgeLevel
+		}
+		return a.Term < b.Term
+	},
+	"practice_at": func(a, b Vocab) bool {
+		if !a.PracticeAt.Equal(b.PracticeAt) {
+			return a.PracticeAt.Before(b.PracticeAt)
+		}
+		return a.Term < b.Term
+	},
+}
+
+type ExportGroup struct {
+	Name   string
+	Vocabs []Vocab
+}
+
+// Export renders the vocab as documents suitable for reading or printing.
+type Export struct {
+	store Store
+}
+
+func NewExport(store Store) *Export {
+	return &Export{
+		store: store,
+	}
+}
+
+func (e *Export) Markdown(w io.Writer, opts ExportOptions) error {
+	groups, err := e.groups(opts)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# vocab\n")
+	for _, group := range groups {
+		sb.WriteString("\n")
+		if group.Name != "" {
+			sb.WriteString("## " + group.Name + "\n\n")
+		}
+		sb.WriteString("| term | translation | knowledge | practice next |\n")
+		sb.WriteString("| --- | --- | --- | --- |\n")
+		for _, vocab := range group.Vocabs {
+			fmt.Fprintf(&sb, "| %s | %s | %d | %s |\n",
+				markdownCell(vocab.Term),
+				markdownCell(vocab.Translation),
+				vocab.KnowledgeLevel,
+				vocab.PracticeAt.Format("2006-01-02"))
+		}
+	}
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func (e *Export) HTML(w io.Writer, opts ExportOptions) error {
+	groups, err := e.groups(opts)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, group := range groups {
+		count += len(group.Vocabs)
+	}
+
+	return exportHTMLTemplate.Execute(w, map[string]interface{}{
+		"Groups": groups,
+		"Count":  count,
+	})
+}
+
+func (e *Export) vocabs(opts ExportOptions) ([]Vocab, error) {
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	vocabs, err := e.store.KnowledgeVocab(opts.MinKnowledgeLevel, opts.MaxKnowledgeLevel)
+	if err != nil {
+		return nil, err
+	}
+	less := exportLess[opts.OrderBy]
+	sort.SliceStable(vocabs, func(i, j int) bool {
+		return less(vocabs[i], vocabs[j])
+	})
+	return vocabs, nil
+}
+
+func (e *Export) groups(opts ExportOptions) ([]ExportGroup, error) {
+	vocabs, err := e.vocabs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.GroupBy == "" {
+		return []ExportGroup{{Vocabs: vocabs}}, nil
+	}
+
+	keyOf := func(vocab Vocab) string {
+		return fmt.Sprintf("knowledge level %d", vocab.KnowledgeLevel)
+	}
+	if opts.GroupBy == "letter" {
+		keyOf = func(vocab Vocab) string {
+			for _, r := range vocab.Term {
+				return string(unicode.ToUpper(r))
+			}
+			return ""
+		}
+	}
+
+	groupsByKey := make(map[string]*ExportGroup)
+	keys := make([]string, 0)
+	for _, vocab := range vocabs {
+		key := keyOf(vocab)
+		group, ok := groupsByKey[key]
+		if !ok {
+			group = &ExportGroup{Name: key}
+			groupsByKey[key] = group
+			keys = append(keys, key)
+		}
+		group.Vocabs = append(group.Vocabs, vocab)
+	}
+	sort.Strings(keys)
+
+	groups := make([]ExportGroup, 0, len(keys))
+	for _, key := range keys {
+		groups = append(groups, *groupsByKey[key])
+	}
+	return groups, nil
+}
+
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var exportHTMLTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8" />
+    <title>vocab</title>
+    <style>
+      body { font-family: sans-serif; margin: 2rem auto; width: 700px; max-width: 100%; }
+      h1 { font-weight: 400; font-size: 1.5rem; }
+      h2 { font-size: 1rem; margin-top: 1.5rem; }
+      table { width: 100%; border-collapse: collapse; }
+      th, td { text-align: left; padding: 0.25rem 0.5rem; border-bottom: 1px solid #aaa; }
+      td.translation { font-style: italic; }
+      td.meta, th.meta { font-size: 0.85rem; white-space: nowrap; }
+      footer { margin-top: 1rem; font-size: 0.85rem; }
+      @media print {
+        body { margin: 0; width: auto; }
+        h2 { break-after: avoid; }
+        tr { break-inside: avoid; }
+      }
+    </style>
+  </head>
+  <body>
+    <h1>vocab</h1>
+    {{- range .Groups }}
+    {{- if .Name }}
+    <h2>{{ .Name }}</h2>
+    {{- end }}
+    <table>
+      <thead>
+        <tr><th>term</th><th>translation</th><th class="meta">knowledge</th><th class="meta">practice next</th></tr>
+      </thead>
+      <tbody>
+        {{- range .Vocabs }}
+        <tr><td>{{ .Term }}</td><td class="translation">{{ .Translation }}</td><td class="meta">{{ .KnowledgeLevel }}</td><td class="meta">{{ .PracticeAt.Format "2006-01-02" }}</td></tr>
+        {{- end }}
+      </tbody>
+    </table>
+    {{- end }}
+    <footer>{{ .Count }} vocab</footer>
+  </body>
+</html>
+`))
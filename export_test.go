@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var exportVocabs = []Vocab{
+	{Term: "foo2", Translation: "bar2", KnowledgeLevel: 1, PracticeAt: inDays(1)},
+	{Term: "baz", Translation: "qux | quux", KnowledgeLevel: 5, PracticeAt: inDays(16)},
+	{Term: "foo1", Translation: "bar1", KnowledgeLevel: 1, PracticeAt: inDays(2)},
+}
+
+func exportDb(t *testing.T) *gorm.DB {
+	db := memoryDb(t)
+
+	for _, vocab := range exportVocabs {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+	return db
+}
+
+func Test_Export_Markdown(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		err := store.AddVocab(append([]Vocab{}, exportVocabs...))
+		require.Nil(t, err)
+
+		var buf bytes.Buffer
+		err = NewExport(store).Markdown(&buf, DefaultExportOptions())
+		require.Nil(t, err)
+
+		expected := fmt.Sprintf(`# vocab
+
+| term | translation | knowledge | practice next |
+| --- | --- | --- | --- |
+| baz | qux \| quux | 5 | %s |
+| foo1 | bar1 | 1 | %s |
+| foo2 | bar2 | 1 | %s |
+`, inDays(16).Format("2006-01-02"), inDays(2).Format("2006-01-02"), inDays(1).Format("2006-01-02"))
+		require.Equal(t, expected, buf.String())
+	})
+}
+
+func Test_Export_Markdown_GroupBy(t *testing.T) {
+	db := exportDb(t)
+
+	opts := DefaultExportOptions()
+	opts.GroupBy = "knowledge_level"
+	opts.OrderBy = "practice_at"
+
+	var buf bytes.Buffer
+	err := NewExport(NewGormStore(db)).Markdown(&buf, opts)
+	require.Nil(t, err)
+
+	expected := fmt.Sprintf(`# vocab
+
+## knowledge level 1
+
+| term | translation | knowledge | practice next |
+| --- | --- | --- | --- |
+| foo2 | bar2 | 1 | %s |
+| foo1 | bar1 | 1 | %s |
+
+## knowledge level 5
+
+| term | translation | knowledge | practice next |
+| --- | --- | --- | --- |
+| baz | qux \| quux | 5 | %s |
+`, inDays(1).Format("2006-01-02"), inDays(2).Format("2006-01-02"), inDays(16).Format("2006-01-02"))
+	require.Equal(t, expected, buf.String())
+}
+
+func Test_Export_Markdown_KnowledgeLevel(t *testing.T) {
+	db := exportDb(t)
+
+	opts := DefaultExportOptions()
+	opts.MinKnowledgeLevel = 2
+	opts.GroupBy = "letter"
+
+	var buf bytes.Buffer
+	err := NewExport(NewGormStore(db)).Markdown(&buf, opts)
+	require.Nil(t, err)
+
+	expected := fmt.Sprintf(`# vocab
+
+## B
+
+| term | translation | knowledge | practice next |
+| --- | --- | --- | --- |
+| baz | qux \| quux | 5 | %s |
+`, inDays(16).Format("2006-01-02"))
+	require.Equal(t, expected, buf.String())
+}
+
+func Test_Export_HTML(t *testing.T) {
+	db := exportDb(t)
+	db.Create(&Vocab{Term: "<script>", Translation: "x", PracticeAt: inDays(0)})
+
+	opts := DefaultExportOptions()
+	opts.GroupBy = "letter"
+
+	var buf bytes.Buffer
+	err := NewExport(NewGormStore(db)).HTML(&buf, opts)
+	require.Nil(t, err)
+
+	html := buf.String()
+	require.Contains(t, html, "<h2>B</h2>")
+	require.Contains(t, html, "<h2>F</h2>")
+	require.Contains(t, html, "<td>foo1</td><td class=\"translation\">bar1</td>")
+	require.Contains(t, html, "&lt;script&gt;")
+	require.NotContains(t, html, "<script>")
+	require.Contains(t, html, "<footer>4 vocab</footer>")
+}
+
+func Test_ExportOptions_Validate(t *testing.T) {
+	opts := DefaultExportOptions()
+	require.Nil(t, opts.Validate())
+
+	opts.MinKnowledgeLevel = 5
+	opts.MaxKnowledgeLevel = 4
+	require.NotNil(t, opts.Validate())
+
+	opts = DefaultExportOptions()
+	opts.GroupBy = "deck"
+	require.NotNil(t, opts.Validate())
+
+	opts = DefaultExportOptions()
+	opts.OrderBy = "id; drop table vocabs"
+	require.NotNil(t, opts.Validate())
+}
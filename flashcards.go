@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// A4 in points.
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+	pageMargin = 28.35
+	cardMargin = 12
+	minFont    = 6
+)
+
+// FlashcardLayout controls how flashcards are arranged on the printed page.
+type FlashcardLayout struct {
+	CardsPerPage int
+	FontSize     float64
+	// FlipEdge is the edge the printer flips the paper around when printing
+	// double-sided: "long" or "short".
+	FlipEdge string
+}
+
+func DefaultFlashcardLayout() FlashcardLayout {
+	return FlashcardLayout{
+		CardsPerPage: 8,
+		FontSize:     18,
+		FlipEdge:     "long",
+	}
+}
+
+func (l FlashcardLayout) Validate() error {
+	if l.CardsPerPage < 1 || l.CardsPerPage > 40 {
+		return fmt.Errorf("cards per page must be between 1 and 40. got: %d", l.CardsPerPage)
+	}
+	if l.FontSize < minFont || l.FontSize > 72 {
+		return fmt.Errorf("font size must be between %d and 72. got: %s", minFont, pdfNum(l.FontSize))
+	}
+	if l.FlipEdge != "long" && l.FlipEdge != "short" {
+		return fmt.Errorf("flip edge must be one of long, short. got: %s", l.FlipEdge)
+	}
+	return nil
+}
+
+// grid returns the number of columns and rows of cards on a page, choosing
+// the factorisation of CardsPerPage closest to square with any extra going to
+// the rows, since the page is portrait.
+func (l FlashcardLayout) grid() (int, int) {
+	cols, rows := 1, l.CardsPerPage
+	for c := 1; c*c <= l.CardsPerPage; c++ {
+		if l.CardsPerPage%c == 0 {
+			cols, rows = c, l.CardsPerPage/c
+		}
+	}
+	return cols, rows
+}
+
+// Flashcards writes a PDF of double-sided flashcards. Pages alternate between
+// fronts (terms) and backs (translations), with the backs mirrored so each
+// translation lands behind its term when printed double-sided.
+func (e *Export) Flashcards(w io.Writer, opts ExportOptions, layout FlashcardLayout) error {
+	err := layout.Validate()
+	if err != nil {
+		return err
+	}
+
+	vocabs, err := e.vocabs(opts)
+	if err != nil {
+		return err
+	}
+
+	cols, rows := layout.grid()
+	cardWidth := (pageWidth - 2*pageMargin) / float64(cols)
+	cardHeight := (pageHeight - 2*pageMargin) / float64(rows)
+
+	doc := newPdfDocument(pageWidth, pageHeight)
+	for start := 0; start < len(vocabs); start += layout.CardsPerPage {
+		end := start + layout.CardsPerPage
+		if end > len(vocabs) {
+			end = len(vocabs)
+		}
+		front := doc.addPage()
+		back := doc.addPage()
+		drawCutLines(front, cols, rows, cardWidth, cardHeight)
+		drawCutLines(back, cols, rows, cardWidth, cardHeight)
+
+		for idx, vocab := range vocabs[start:end] {
+			col, row := idx%cols, idx/cols
+			backCol, backRow := cols-1-col, row
+			if layout.FlipEdge == "short" {
+				backCol, backRow = col, rows-1-row
+			}
+			drawCard(front, vocab.Term, col, row, cardWidth, cardHeight, layout.FontSize)
+			drawCard(back, vocab.Translation, backCol, backRow, cardWidth, cardHeight, layout.FontSize)
+		}
+	}
+	if len(doc.pages) == 0 {
+		doc.addPage()
+	}
+
+	_, err = doc.WriteTo(w)
+	return err
+}
+
+func drawCutLines(page *pdfPage, cols, rows int, cardWidth, cardHeight float64) {
+	page.stroke(0.7, 0.5, 3)
+	for c := 0; c <= cols; c++ {
+		x := pageMargin + float64(c)*cardWidth
+		page.line(x, pageMargin, x, pageHeight-pageMargin)
+	}
+	for r := 0; r <= rows; r++ {
+		y := pageMargin + float64(r)*cardHeight
+		page.line(pageMargin, y, pageWidth-pageMargin, y)
+	}
+}
+
+// drawCard writes s centred in the card at (col, row), counting rows from the
+// top of the page. The font shrinks until the wrapped text fits.
+func drawCard(page *pdfPage, s string, col, row int, cardWidth, cardHeight, fontSize float64) {
+	maxWidth := cardWidth - 2*cardMargin
+	maxHeight := cardHeight - 2*cardMargin
+
+	size := fontSize
+	lines := wrapText(s, size, maxWidth)
+	for size > minFont && (float64(len(lines))*size*1.2 > maxHeight || widest(lines, size) > maxWidth) {
+		size = math.Max(size-1, minFont)
+		lines = wrapText(s, size, maxWidth)
+	}
+
+	left := pageMargin + float64(col)*cardWidth
+	top := pageHeight - pageMargin - float64(row)*cardHeight
+	leading := size * 1.2
+	blockHeight := float64(len(lines)) * leading
+	// Baseline of the first line, so that the block is vertically centred.
+	y := top - (cardHeight-blockHeight)/2 - size
+	for _, line := range lines {
+		x := left + (cardWidth-textWidth(line, size))/2
+		page.text(x, y, size, line)
+		y -= leading
+	}
+}
+
+func widest(lines []string, size float64) float64 {
+	width := 0.0
+	for _, line := range lines {
+		width = math.Max(width, textWidth(line, size))
+	}
+	return width
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FlashcardLayout_Grid(t *testing.T) {
+	cases := []struct {
+		cardsPerPage int
+		cols         int
+		rows         int
+	}{
+		{1, 1, 1},
+		{4, 2, 2},
+		{6, 2, 3},
+		{8, 2, 4},
+		{12, 3, 4},
+		{7, 1, 7},
+	}
+
+	for _, c := range cases {
+		layout := DefaultFlashcardLayout()
+		layout.CardsPerPage = c.cardsPerPage
+		cols, rows := layout.grid()
+		require.Equal(t, c.cols, cols, c.cardsPerPage)
+		require.Equal(t, c.rows, rows, c.cardsPerPage)
+	}
+}
+
+func Test_FlashcardLayout_Validate(t *testing.T) {
+	require.Nil(t, DefaultFlashcardLayout().Validate())
+
+	layout := DefaultFlashcardLayout()
+	layout.CardsPerPage = 0
+	require.NotNil(t, layout.Validate())
+
+	layout = DefaultFlashcardLayout()
+	layout.FontSize = 2
+	require.NotNil(t, layout.Validate())
+
+	layout = DefaultFlashcardLayout()
+	layout.FlipEdge = "top"
+	require.NotNil(t, layout.Validate())
+}
+
+func Test_Export_Flashcards(t *testing.T) {
+	db := memoryDb(t)
+	for i := 1; i <= 5; i++ {
+		dbResult := db.Create(&Vocab{
+			Term:           fmt.Sprintf("foo%d", i),
+			Translation:    fmt.Sprintf("bar%d", i),
+			KnowledgeLevel: uint(i),
+			PracticeAt:     inDays(i),
+		})
+		require.Nil(t, dbResult.Error)
+	}
+
+	opts := DefaultExportOptions()
+	opts.MaxKnowledgeLevel = 4
+	layout := DefaultFlashcardLayout()
+	layout.CardsPerPage = 2
+
+	var buf bytes.Buffer
+	err := NewExport(NewGormStore(db)).Flashcards(&buf, opts, layout)
+	require.Nil(t, err)
+
+	streams := pdfStreams(t, buf.String())
+	require.Len(t, streams, 4)
+
+	// 2 cards per page is a single column, so long edge flipping leaves the
+	// backs in the same position as the fronts.
+	require.Equal(t, []string{"foo1", "foo2"}, flashcardTexts(streams[0]))
+	require.Equal(t, []string{"bar1", "bar2"}, flashcardTexts(streams[1]))
+	require.Equal(t, []string{"foo3", "foo4"}, flashcardTexts(streams[2]))
+	require.Equal(t, []string{"bar3", "bar4"}, flashcardTexts(streams[3]))
+	front, back := flashcardPositions(streams[0]), flashcardPositions(streams[1])
+	require.InDelta(t, front[0][0], back[0][0], 5)
+	require.Equal(t, front[0][1], back[0][1])
+	require.Equal(t, front[1][1], back[1][1])
+}
+
+func Test_Export_Flashcards_FlipEdge(t *testing.T) {
+	db := memoryDb(t)
+	for i := 1; i <= 4; i++ {
+		dbResult := db.Create(&Vocab{
+			Term:           fmt.Sprintf("foo%d", i),
+			Translation:    fmt.Sprintf("bar%d", i),
+			KnowledgeLevel: 0,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+	}
+
+	layout := DefaultFlashcardLayout()
+	layout.CardsPerPage = 4
+
+	var buf bytes.Buffer
+	err := NewExport(NewGormStore(db)).Flashcards(&buf, DefaultExportOptions(), layout)
+	require.Nil(t, err)
+
+	// Long edge: the columns of the back are mirrored.
+	streams := pdfStreams(t, buf.String())
+	front, back := flashcardPositions(streams[0]), flashcardPositions(streams[1])
+	require.Less(t, front[0][0], front[1][0])
+	require.Greater(t, back[0][0], back[1][0])
+	require.Equal(t, front[0][1], back[0][1])
+
+	layout.FlipEdge = "short"
+	buf.Reset()
+	err = NewExport(NewGormStore(db)).Flashcards(&buf, DefaultExportOptions(), layout)
+	require.Nil(t, err)
+
+	// Short edge: the rows of the back are mirrored.
+	streams = pdfStreams(t, buf.String())
+	front, back = flashcardPositions(streams[0]), flashcardPositions(streams[1])
+	require.Greater(t, front[0][1], front[2][1])
+	require.Less(t, back[0][1], back[2][1])
+	require.InDelta(t, front[0][0], back[0][0], 5)
+}
+
+func Test_Export_Flashcards_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewExport(newMemoryStore()).Flashcards(&buf, DefaultExportOptions(), DefaultFlashcardLayout())
+	require.Nil(t, err)
+	require.Contains(t, buf.String(), "/Count 1")
+}
+
+var flashcardTextRe = regexp.MustCompile(`Tf ([\d.]+) ([\d.]+) Td \((.*?)\) Tj`)
+
+func flashcardTexts(stream string) []string {
+	texts := make([]string, 0)
+	for _, m := range flashcardTextRe.FindAllStringSubmatch(stream, -1) {
+		texts = append(texts, m[3])
+	}
+	return texts
+}
+
+func flashcardPositions(stream string) [][2]float64 {
+	positions := make([][2]float64, 0)
+	for _, m := range flashcardTextRe.FindAllStringSubmatch(stream, -1) {
+		x, _ := strconv.ParseFloat(m[1], 64)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		positions = append(positions, [2]float64{x, y})
+	}
+	return positions
+}
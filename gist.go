@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultGistAPI = "https://api.github.com"
+	// snapshotFile is the name of the snapshot in a gist or git repository.
+	snapshotFile = "vocab.json"
+)
+
+// gistBackend stores the snapshot as a file of a gist, through the GitHub
+// gist API or one like it.
+type gistBackend struct {
+	api    string
+	token  string
+	gistID string
+	client *http.Client
+}
+
+// NewGistBackend returns a SyncBackend of the gist with the given ID. The
+// gist must exist, e.g. created as a secret gist on gist.github.com, and the
+// token must be allowed to change it.
+func NewGistBackend(api, token, gistID string) SyncBackend {
+	return &gistBackend{
+		api:    strings.TrimSuffix(api, "/"),
+		token:  token,
+		gistID: gistID,
+		client: &http.Client{},
+	}
+}
+
+type gistFile struct {
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+	RawURL    string `json:"raw_url,omitempty"`
+}
+
+func (g *gistBackend) Pull() ([]byte, error) {
+	res, err := g.request("GET", g.api+"/gists/"+g.gistID, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var gist struct {
+		Files map[string]*gistFile `json:"files"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&gist)
+	if err != nil {
+		return nil, err
+	}
+	file := gist.Files[snapshotFile]
+	if file == nil {
+		return nil, nil
+	}
+	if !file.Truncated {
+		return []byte(file.Content), nil
+	}
+
+	// Large files are left out, to be fetched on their own, e.g. from
+	// gist.githubusercontent.com.
+	res, err = g.request("GET", file.RawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+func (g *gistBackend) Push(snapshot []byte) error {
+	body, err := json.Marshal(struct {
+		Files map[string]gistFile `json:"files"`
+	}{map[string]gistFile{snapshotFile: {Content: string(snapshot)}}})
+	if err != nil {
+		return err
+	}
+	res, err := g.request("PATCH", g.api+"/gists/"+g.gistID, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// request makes a request to the gist API, returning an error if the
+// response isn't a success. The token is only sent to the host of the API.
+func (g *gistBackend) request(method, urlS string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, urlS, body)
+	if err != nil {
+		return nil, err
+	}
+	api, err := url.Parse(g.api)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.token != "" && req.URL.Scheme == api.Scheme && req.URL.Host == api.Host {
+		req.Header.Set("Authorization", "token "+g.token)
+	}
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	var responseData struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(res.Body).Decode(&responseData)
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("gist %s not found. check the ID, and that the token can see it", g.gistID)
+	}
+	return nil, fmt.Errorf("gist: %s: %s", res.Status, responseData.Message)
+}
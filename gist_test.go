@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gistStandIn serves the parts of the gist API that sync uses, for a gist
+// with the ID "abc" that only the token "secret" can see. Like on GitHub,
+// anyone with the raw_url of a file can fetch it.
+type gistStandIn struct {
+	files map[string]string
+	// truncate leaves the content of files out, to be fetched from raw_url.
+	truncate bool
+	// rawHost serves the raw files, or the API itself if it's "".
+	rawHost string
+	// rawAuth is the Authorization header of each request for a raw file.
+	rawAuth []string
+}
+
+func (g *gistStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/raw/") {
+		g.rawAuth = append(g.rawAuth, r.Header.Get("Authorization"))
+		w.Write([]byte(g.files[strings.TrimPrefix(r.URL.Path, "/raw/")]))
+		return
+	}
+	if r.Header.Get("Authorization") != "token secret" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+		return
+	}
+	if r.URL.Path != "/gists/abc" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+		return
+	}
+
+	if r.Method == "PATCH" {
+		var requestData struct {
+			Files map[string]gistFile `json:"files"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestData)
+		if err != nil || len(requestData.Files) == 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "Validation Failed"}`))
+			return
+		}
+		for name, file := range requestData.Files {
+			g.files[name] = file.Content
+		}
+	}
+
+	rawHost := g.rawHost
+	if rawHost == "" {
+		rawHost = r.Host
+	}
+	files := make(map[string]gistFile)
+	for name, content := range g.files {
+		if g.truncate {
+			files[name] = gistFile{Truncated: true, RawURL: "http://" + rawHost + "/raw/" + name}
+		} else {
+			files[name] = gistFile{Content: content}
+		}
+	}
+	json.NewEncoder(w).Encode(struct {
+		ID    string              `json:"id"`
+		Files map[string]gistFile `json:"files"`
+	}{"abc", files})
+}
+
+func Test_GistBackend(t *testing.T) {
+	for _, truncate := range []bool{false, true} {
+		gist := &gistStandIn{files: map[string]string{"README.md": "vocab"}, truncate: truncate}
+		ts := httptest.NewServer(gist)
+		defer ts.Close()
+		laptop, desktop := memoryDb(t), memoryDb(t)
+
+		_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+		require.Nil(t, err)
+		requireSyncBackend(t, laptop, NewGistBackend(ts.URL, "secret", "abc"))
+		require.Contains(t, gist.files[snapshotFile], `"term": "hund"`)
+		require.Equal(t, "vocab", gist.files["README.md"])
+
+		_, err = NewGormStore(desktop).CreateVocab("katze", "cat")
+		require.Nil(t, err)
+		result := requireSyncBackend(t, desktop, NewGistBackend(ts.URL+"/", "secret", "abc"))
+		require.Equal(t, 1, result.Merged)
+		require.Equal(t, 1, result.Sent)
+		requireSyncBackend(t, laptop, NewGistBackend(ts.URL, "secret", "abc"))
+
+		require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+		require.Len(t, vocabState(t, laptop), 2)
+	}
+}
+
+func Test_GistBackend_RawURL(t *testing.T) {
+	gist := &gistStandIn{files: map[string]string{snapshotFile: "{}"}, truncate: true}
+	ts := httptest.NewServer(gist)
+	defer ts.Close()
+	raw := httptest.NewServer(gist)
+	defer raw.Close()
+
+	snapshot, err := NewGistBackend(ts.URL, "secret", "abc").Pull()
+	require.Nil(t, err)
+	require.Equal(t, "{}", string(snapshot))
+
+	// The token isn't sent to another host.
+	gist.rawHost = strings.TrimPrefix(raw.URL, "http://")
+	snapshot, err = NewGistBackend(ts.URL, "secret", "abc").Pull()
+	require.Nil(t, err)
+	require.Equal(t, "{}", string(snapshot))
+	require.Equal(t, []string{"token secret", ""}, gist.rawAuth)
+}
+
+func Test_GistBackend_Errors(t *testing.T) {
+	ts := httptest.NewServer(&gistStandIn{files: map[string]string{}})
+	defer ts.Close()
+
+	snapshot, err := NewGistBackend(ts.URL, "secret", "abc").Pull()
+	require.Nil(t, err)
+	require.Nil(t, snapshot)
+
+	_, err = NewGistBackend(ts.URL, "wrong", "abc").Pull()
+	require.Equal(t, "gist abc not found. check the ID, and that the token can see it", err.Error())
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+	})
+	err = NewGistBackend(ts.URL, "secret", "abc").Push([]byte("{}"))
+	require.Equal(t, "gist: 403 Forbidden: Resource not accessible by integration", err.Error())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitBackend stores the snapshot as a file of a git repository, committing
+// each change. If the repository has a remote, e.g. a private repository on
+// GitHub, it pulls before reading the snapshot and pushes after committing.
+type gitBackend struct {
+	dir string
+}
+
+func NewGitBackend(dir string) SyncBackend {
+	return &gitBackend{dir: dir}
+}
+
+func (g *gitBackend) Pull() ([]byte, error) {
+	_, err := g.git("rev-parse", "--git-dir")
+	if err != nil {
+		return nil, err
+	}
+	remote, err := g.remote()
+	if err != nil {
+		return nil, err
+	}
+	if remote != "" {
+		err = g.pullRemote(remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(g.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (g *gitBackend) pullRemote(remote string) error {
+	_, err := g.git("fetch", remote)
+	if err != nil {
+		return err
+	}
+	if !g.hasUpstream() {
+		// E.g. a clone of an empty repository, which another computer
+		// may have pushed to since.
+		branch, err := g.git("symbolic-ref", "--short", "HEAD")
+		if err != nil {
+			return err
+		}
+		_, err = g.git("rev-parse", "--verify", "--quiet", remote+"/"+branch)
+		if err != nil {
+			return nil
+		}
+		_, err = g.git("branch", "--set-upstream-to", remote+"/"+branch)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = g.git("merge", "--ff-only", "@{u}")
+	if err == nil {
+		return nil
+	}
+	// Both have commits, e.g. another computer pushed between pulling and
+	// pushing. The collection has the local snapshot, so take the other
+	// snapshot to merge into it.
+	_, err = g.git("merge", "--no-ff", "--no-commit", "-X", "ours", "@{u}")
+	if err != nil {
+		return err
+	}
+	_, err = g.git("checkout", "@{u}", "--", snapshotFile)
+	if err != nil {
+		return err
+	}
+	_, err = g.git("commit", "--no-edit")
+	return err
+}
+
+func (g *gitBackend) Push(snapshot []byte) error {
+	err := ioutil.WriteFile(filepath.Join(g.dir, snapshotFile), snapshot, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = g.git("add", snapshotFile)
+	if err != nil {
+		return err
+	}
+	_, err = g.git("commit", "-m", "Sync vocab", "--", snapshotFile)
+	if err != nil {
+		return err
+	}
+
+	remote, err := g.remote()
+	if err != nil || remote == "" {
+		return err
+	}
+	if g.hasUpstream() {
+		_, err = g.git("push")
+	} else {
+		_, err = g.git("push", "--set-upstream", remote, "HEAD")
+	}
+	return err
+}
+
+// remote returns the first remote of the repository, or "" if it has none.
+func (g *gitBackend) remote() (string, error) {
+	out, err := g.git("remote")
+	if err != nil {
+		return "", err
+	}
+	return strings.SplitN(out, "\n", 2)[0], nil
+}
+
+func (g *gitBackend) hasUpstream() bool {
+	_, err := g.git("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	return err == nil
+}
+
+// git runs git in the repository, returning its output.
+func (g *gitBackend) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
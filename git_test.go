@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gitRepo runs git in dir, failing the test if it fails.
+func gitRepo(t *testing.T, dir string, args ...string) string {
+	out, err := NewGitBackend(dir).(*gitBackend).git(args...)
+	require.Nil(t, err)
+	return out
+}
+
+// gitClones returns two clones of an empty repository, skipping the test
+// without git.
+func gitClones(t *testing.T) (string, string) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	gitRepo(t, dir, "init", "--bare", remote)
+	clones := []string{filepath.Join(dir, "laptop"), filepath.Join(dir, "desktop")}
+	for _, clone := range clones {
+		gitRepo(t, dir, "clone", remote, clone)
+		gitRepo(t, clone, "config", "user.name", "vocab")
+		gitRepo(t, clone, "config", "user.email", "vocab@example.com")
+	}
+	return clones[0], clones[1]
+}
+
+func Test_GitBackend(t *testing.T) {
+	laptopRepo, desktopRepo := gitClones(t)
+	laptop, desktop := memoryDb(t), memoryDb(t)
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSyncBackend(t, laptop, NewGitBackend(laptopRepo))
+	_, err = NewGormStore(desktop).CreateVocab("katze", "cat")
+	require.Nil(t, err)
+	result := requireSyncBackend(t, desktop, NewGitBackend(desktopRepo))
+	require.Equal(t, 1, result.Merged)
+	requireSyncBackend(t, laptop, NewGitBackend(laptopRepo))
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Len(t, vocabState(t, laptop), 2)
+	require.Equal(t, "2", gitRepo(t, laptopRepo, "rev-list", "--count", "HEAD"))
+
+	// Nothing is committed if nothing changed.
+	requireSyncBackend(t, laptop, NewGitBackend(laptopRepo))
+	requireSyncBackend(t, desktop, NewGitBackend(desktopRepo))
+	require.Equal(t, "2", gitRepo(t, desktopRepo, "rev-list", "--count", "HEAD"))
+}
+
+// pushHook is a SyncBackend that runs a function before pushing.
+type pushHook struct {
+	SyncBackend
+	beforePush func()
+}
+
+func (p *pushHook) Push(snapshot []byte) error {
+	p.beforePush()
+	return p.SyncBackend.Push(snapshot)
+}
+
+func Test_GitBackend_Diverged(t *testing.T) {
+	laptopRepo, desktopRepo := gitClones(t)
+	laptop, desktop := memoryDb(t), memoryDb(t)
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSyncBackend(t, laptop, NewGitBackend(laptopRepo))
+	requireSyncBackend(t, desktop, NewGitBackend(desktopRepo))
+
+	// The desktop pushes while the laptop syncs, so the laptop's push fails.
+	_, err = NewGormStore(laptop).CreateVocab("katze", "cat")
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).CreateVocab("maus", "mouse")
+	require.Nil(t, err)
+	_, err = syncBackend(laptop, noUser, &pushHook{NewGitBackend(laptopRepo), func() {
+		requireSyncBackend(t, desktop, NewGitBackend(desktopRepo))
+	}})
+	require.NotNil(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "git push:"), err.Error())
+
+	requireSyncBackend(t, laptop, NewGitBackend(laptopRepo))
+	requireSyncBackend(t, desktop, NewGitBackend(desktopRepo))
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Len(t, vocabState(t, laptop), 3)
+}
+
+func Test_GitBackend_NoRemote(t *testing.T) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	db := memoryDb(t)
+
+	_, err = syncBackend(db, noUser, NewGitBackend(dir))
+	require.NotNil(t, err)
+
+	gitRepo(t, dir, "init")
+	gitRepo(t, dir, "config", "user.name", "vocab")
+	gitRepo(t, dir, "config", "user.email", "vocab@example.com")
+	_, err = NewGormStore(db).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSyncBackend(t, db, NewGitBackend(dir))
+	require.Contains(t, gitRepo(t, dir, "show", "HEAD:"+snapshotFile), `"term": "hund"`)
+}
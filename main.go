@@ -1,37 +1,133 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/peter554/vocab/client"
 	"github.com/pkg/browser"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var (
-	cmdStartHeadline  = "Starts the vocab web application."
-	cmdExportHeadline = "Export vocab to a CSV."
-	cmdImportHeadline = "Import vocab from a CSV."
+	cmdStartHeadline    = "Starts the vocab web application."
+	cmdExportHeadline   = "Export vocab to a CSV, Markdown, HTML or flashcard PDF file."
+	cmdImportHeadline   = "Import vocab from a CSV or text file."
+	cmdPracticeHeadline = "Practice vocab in the terminal."
+	cmdAddHeadline      = "Add vocab."
+	cmdListHeadline     = "List vocab."
+	cmdSearchHeadline   = "Search vocab by term or translation."
+	cmdRmHeadline       = "Remove vocab."
+	cmdTuiHeadline      = "Starts the interactive terminal UI."
+	cmdStatsHeadline    = "Show a summary of vocab and practice."
+	cmdProfilesHeadline = "List profiles."
+	cmdConfigHeadline   = "Show or change the settings of the profile."
+	cmdMigrateHeadline  = "Show, apply or roll back database migrations."
+	cmdBackupHeadline   = "Back up the database."
+	cmdRestoreHeadline  = "Restore the database from a backup."
+	cmdTokenHeadline    = "Create, list or revoke API tokens."
+	cmdSyncHeadline     = "Sync vocab with other computers."
+	cmdTrashHeadline    = "List or restore removed vocab."
 )
 
+// location is resolved from the global flags before running the command.
+var location *Location
+
+// username is the user whose collection the command works on, or "" for the
+// local collection.
+var username string
+
+// remote is the client of the server given by -server, or nil to work on the
+// database.
+var remote *client.Client
+
 func main() {
-	if len(os.Args) < 2 {
+	globalFlg := flag.NewFlagSet("", flag.ExitOnError)
+	globalFlg.Usage = cmdNotRecognized
+	var dbFlag string
+	globalFlg.StringVar(&dbFlag, "db", "", "Path of the database (overrides $VOCAB_DB)")
+	var profileFlag string
+	globalFlg.StringVar(&profileFlag, "profile", "", "Profile to use (overrides $VOCAB_PROFILE)")
+	var dsnFlag string
+	globalFlg.StringVar(&dsnFlag, "dsn", "", "PostgreSQL connection string to use instead of a database file (overrides $VOCAB_DSN)")
+	globalFlg.StringVar(&username, "user", os.Getenv("VOCAB_USER"), "User whose vocab to work on, when accounts are on (overrides $VOCAB_USER)")
+	var serverFlag string
+	globalFlg.StringVar(&serverFlag, "server", os.Getenv("VOCAB_SERVER"), "URL of a vocab server to work on through its API instead of a database (overrides $VOCAB_SERVER)")
+	var tokenFlag string
+	globalFlg.StringVar(&tokenFlag, "token", os.Getenv("VOCAB_TOKEN"), "API token to send to the server given by -server (overrides $VOCAB_TOKEN)")
+
+	err := globalFlg.Parse(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	location, err = resolveLocation(dbFlag, profileFlag, dsnFlag, os.Getenv, homedir.Dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if serverFlag != "" {
+		if dbFlag != "" || dsnFlag != "" {
+			log.Fatal("-server can't be combined with -db or -dsn")
+		}
+		if username != "" {
+			log.Fatal("-server can't be combined with -user. the token decides whose vocab to work on")
+		}
+		remote = client.New(serverFlag, tokenFlag)
+	}
+
+	args := globalFlg.Args()
+	if len(args) < 1 {
 		cmdNotRecognized()
 	}
-	cmd := os.Args[1]
+	cmd := args[0]
 	if cmd == "start" {
-		cmdStart(os.Args[2:])
+		cmdStart(args[1:])
 	} else if cmd == "export" {
-		cmdExport(os.Args[2:])
+		cmdExport(args[1:])
 	} else if cmd == "import" {
-		cmdImport(os.Args[2:])
+		cmdImport(args[1:])
+	} else if cmd == "practice" {
+		cmdPractice(args[1:])
+	} else if cmd == "add" {
+		cmdAdd(args[1:])
+	} else if cmd == "list" {
+		cmdList(args[1:])
+	} else if cmd == "search" {
+		cmdSearch(args[1:])
+	} else if cmd == "rm" {
+		cmdRm(args[1:])
+	} else if cmd == "tui" {
+		cmdTui(args[1:])
+	} else if cmd == "stats" {
+		cmdStats(args[1:])
+	} else if cmd == "profiles" {
+		cmdProfiles(args[1:])
+	} else if cmd == "config" {
+		cmdConfig(args[1:])
+	} else if cmd == "migrate" {
+		cmdMigrate(args[1:])
+	} else if cmd == "backup" {
+		cmdBackup(args[1:])
+	} else if cmd == "restore" {
+		cmdRestore(args[1:])
+	} else if cmd == "token" {
+		cmdToken(args[1:])
+	} else if cmd == "sync" {
+		cmdSync(args[1:])
+	} else if cmd == "trash" {
+		cmdTrash(args[1:])
 	} else {
 		cmdNotRecognized()
 	}
@@ -39,11 +135,33 @@ func main() {
 }
 
 func cmdNotRecognized() {
-	fmt.Fprintf(os.Stderr, "\nUsage: vocab <command>\n\n")
+	fmt.Fprintf(os.Stderr, "\nUsage: vocab [global flags] <command>\n\n")
+	fmt.Fprintf(os.Stderr, "Global flags:\n")
+	fmt.Fprintf(os.Stderr, "  -db       Path of the database (overrides $VOCAB_DB)\n")
+	fmt.Fprintf(os.Stderr, "  -profile  Profile to use (overrides $VOCAB_PROFILE)\n")
+	fmt.Fprintf(os.Stderr, "  -dsn      PostgreSQL connection string to use instead of a database file (overrides $VOCAB_DSN)\n")
+	fmt.Fprintf(os.Stderr, "  -user     User whose vocab to work on, when accounts are on (overrides $VOCAB_USER)\n")
+	fmt.Fprintf(os.Stderr, "  -server   URL of a vocab server to work on through its API instead of a database (overrides $VOCAB_SERVER)\n")
+	fmt.Fprintf(os.Stderr, "  -token    API token to send to the server given by -server (overrides $VOCAB_TOKEN)\n\n")
 	fmt.Fprintf(os.Stderr, "Commands:\n")
 	fmt.Fprintf(os.Stderr, "  start     "+cmdStartHeadline+"\n")
 	fmt.Fprintf(os.Stderr, "  export    "+cmdExportHeadline+"\n")
-	fmt.Fprintf(os.Stderr, "  import    "+cmdImportHeadline+"\n\n")
+	fmt.Fprintf(os.Stderr, "  import    "+cmdImportHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  practice  "+cmdPracticeHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  add       "+cmdAddHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  list      "+cmdListHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  search    "+cmdSearchHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  rm        "+cmdRmHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  tui       "+cmdTuiHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  stats     "+cmdStatsHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  profiles  "+cmdProfilesHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  config    "+cmdConfigHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  migrate   "+cmdMigrateHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  backup    "+cmdBackupHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  restore   "+cmdRestoreHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  token     "+cmdTokenHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  sync      "+cmdSyncHeadline+"\n")
+	fmt.Fprintf(os.Stderr, "  trash     "+cmdTrashHeadline+"\n\n")
 	fmt.Fprintf(os.Stderr, "Run 'vocab <command> -help' for more information about a command.\n\n")
 	os.Exit(1)
 }
@@ -57,12 +175,21 @@ func cmdStart(args []string) {
 		flg.PrintDefaults()
 	}
 
-	var port string
-	flg.StringVar(&port, "port", "3000", "Port on which to serve the application")
-	var openBrowser bool
-	flg.BoolVar(&openBrowser, "open", false, "Automatically open a web browser")
+	config, err := getConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	err := flg.Parse(args)
+	flg.StringVar(&config.Port, "port", config.Port, "Port on which to serve the application")
+	flg.BoolVar(&config.OpenBrowser, "open", config.OpenBrowser, "Automatically open a web browser")
+	flg.BoolVar(&config.Accounts, "accounts", config.Accounts, "Ask users to register and log in, each having their own vocab")
+	flg.BoolVar(&config.RequireToken, "require-token", config.RequireToken, "Only accept API requests with a token (see 'vocab token')")
+
+	err = flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = config.Validate()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -72,17 +199,60 @@ func cmdStart(args []string) {
 		log.Fatal(err)
 	}
 
-	server := NewServer(db)
+	if config.RequireToken && !config.Accounts {
+		apiTokens, err := listApiTokens(db, noUser)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(apiTokens) == 0 {
+			log.Println("An API token is required, but there are none. Create one with 'vocab token create'")
+		}
+	}
+
+	server := NewServer(db, config)
 
-	if openBrowser {
+	go runDailyBackups(db, config)
+	go runTrashPurge(db, config)
+
+	if config.OpenBrowser {
 		go func() {
 			time.Sleep(time.Millisecond * 500)
-			browser.OpenURL("http://localhost:" + port)
+			browser.OpenURL("http://localhost:" + config.Port)
 		}()
 	}
 
-	log.Println("Serving at http://localhost:" + port)
-	log.Fatal(http.ListenAndServe(":"+port, server))
+	log.Println("Serving at http://localhost:" + config.Port)
+	log.Fatal(http.ListenAndServe(":"+config.Port, server))
+}
+
+// runDailyBackups backs up the database once a day while the web application
+// runs.
+func runDailyBackups(db *gorm.DB, config *Config) {
+	for {
+		path, err := dailyBackup(db, location.backupDir(), config.BackupRetention, time.Now())
+		if err != nil {
+			log.Printf("Daily backup failed: %s", err)
+		} else if path != "" {
+			log.Printf("Backed up the database to %s", path)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// runTrashPurge purges vocab that has been in the trash for longer than
+// trash_days, once an hour while the web application runs.
+func runTrashPurge(db *gorm.DB, config *Config) {
+	for {
+		if config.TrashDays > 0 {
+			count, err := purgeTrash(db, config.TrashDays, time.Now())
+			if err != nil {
+				log.Printf("Purging the trash failed: %s", err)
+			} else if count > 0 {
+				log.Printf("Purged %d vocab from the trash", count)
+			}
+		}
+		time.Sleep(time.Hour)
+	}
 }
 
 func cmdExport(args []string) {
@@ -95,26 +265,60 @@ func cmdExport(args []string) {
 	}
 
 	var fileS string
-	flg.StringVar(&fileS, "file", "vocab.csv", "File path to export the CSV")
+	flg.StringVar(&fileS, "file", "", "File path to export to (default \"vocab.<format>\")")
+	var format string
+	flg.StringVar(&format, "format", "csv", "Format of the export: csv, md, html or pdf")
+	opts := DefaultExportOptions()
+	flg.UintVar(&opts.MinKnowledgeLevel, "min-knowledge", opts.MinKnowledgeLevel, "Only export vocab with at least this knowledge level (md, html, pdf)")
+	flg.UintVar(&opts.MaxKnowledgeLevel, "max-knowledge", opts.MaxKnowledgeLevel, "Only export vocab with at most this knowledge level (md, html, pdf)")
+	flg.StringVar(&opts.GroupBy, "group-by", opts.GroupBy, "Group vocab by knowledge_level or letter (md, html)")
+	flg.StringVar(&opts.OrderBy, "order-by", opts.OrderBy, "Order vocab by term, translation, knowledge_level or practice_at (md, html, pdf)")
+	layout := DefaultFlashcardLayout()
+	flg.IntVar(&layout.CardsPerPage, "cards-per-page", layout.CardsPerPage, "Number of flashcards per page (pdf)")
+	flg.Float64Var(&layout.FontSize, "font-size", layout.FontSize, "Font size of the flashcards, shrunk to fit long text (pdf)")
+	flg.StringVar(&layout.FlipEdge, "flip-edge", layout.FlipEdge, "Edge the printer flips on when printing double-sided: long or short (pdf)")
 
 	err := flg.Parse(args)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if format != "csv" && format != "md" && format != "html" && format != "pdf" {
+		log.Fatal("flag -format must be one of csv, md, html, pdf")
+	}
+	err = opts.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = layout.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if fileS == "" {
+		fileS = "vocab." + format
+	}
+
 	file, err := os.Create(fileS)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer file.Close()
 
-	db, err := getDb()
+	store, err := getStore()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	csv := NewCsv(db)
-	err = csv.Export(file)
+	if format == "md" {
+		err = NewExport(store).Markdown(file, opts)
+	} else if format == "html" {
+		err = NewExport(store).HTML(file, opts)
+	} else if format == "pdf" {
+		err = NewExport(store).Flashcards(file, opts, layout)
+	} else {
+		err = NewCsv(store).Export(file)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -130,9 +334,19 @@ func cmdImport(args []string) {
 	}
 
 	var fileS string
-	flg.StringVar(&fileS, "file", "", "File path to the import CSV")
+	flg.StringVar(&fileS, "file", "", "File path to the import file")
+	var format string
+	flg.StringVar(&format, "format", "csv", "Format of the import file: csv or text")
+	var termSep string
+	flg.StringVar(&termSep, "term-sep", `\t`, "Separator between term and translation (text format)")
+	var cardSep string
+	flg.StringVar(&cardSep, "card-sep", `\n`, "Separator between cards (text format)")
 	var clean bool
 	flg.BoolVar(&clean, "clean", false, "Clean import will delete all existing vocab")
+	var batchSize int
+	flg.IntVar(&batchSize, "batch-size", defaultImportBatchSize, "Number of rows to insert per batch")
+	var quiet bool
+	flg.BoolVar(&quiet, "quiet", false, "Do not show a progress bar")
 
 	err := flg.Parse(args)
 	if err != nil {
@@ -143,74 +357,1022 @@ func cmdImport(args []string) {
 		log.Fatal("flag -file is required")
 	}
 
+	if format != "csv" && format != "text" {
+		log.Fatal("flag -format must be one of csv, text")
+	}
+
 	file, err := os.Open(fileS)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer file.Close()
 
-	db, err := getDb()
+	if remote != nil {
+		if clean {
+			log.Fatal("flag -clean can't be used with -server")
+		}
+		importRemote(file, format, termSep, cardSep)
+		return
+	}
+
+	store, err := getStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if format == "text" {
+		text := NewText(store)
+		text.TermSeparator = unescapeSeparator(termSep)
+		text.CardSeparator = unescapeSeparator(cardSep)
+		if clean {
+			err = text.ImportClean(file)
+		} else {
+			err = text.Import(file)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	info, err := file.Stat()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	csv := NewCsv(db)
+	reader := &countingReader{r: file}
+	bar := &progressBar{w: os.Stderr, total: info.Size()}
+
+	csv := NewCsv(store)
+	csv.BatchSize = batchSize
+	if !quiet {
+		csv.Progress = func(rows int) {
+			bar.update(reader.n, rows)
+		}
+	}
 
 	if clean {
-		err = csv.ImportClean(file)
+		err = csv.ImportClean(reader)
+	} else {
+		err = csv.Import(reader)
+	}
+	if !quiet {
+		bar.done()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// importRemote imports the file on the server given by -server, in one
+// request, so that either all of it or none of it is imported.
+func importRemote(file *os.File, format, termSep, cardSep string) {
+	var count int
+	if format == "text" {
+		b, err := io.ReadAll(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		count, err = remote.ImportText(client.TextImport{
+			Text:          string(b),
+			TermSeparator: unescapeSeparator(termSep),
+			CardSeparator: unescapeSeparator(cardSep),
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
 	} else {
-		err = csv.Import(file)
+		var err error
+		count, err = remote.ImportCsv(file)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
+	fmt.Printf("imported %d vocab\n", count)
 }
 
-func getDb() (*gorm.DB, error) {
-	dir, err := appdir()
+func cmdPractice(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdPracticeHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab practice [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	config, err := getConfig()
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
 
-	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "vocab.db")))
+	var limit int
+	flg.IntVar(&limit, "limit", config.SessionSize, "Maximum number of vocab to practice")
+
+	err = flg.Parse(args)
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
-	err = db.AutoMigrate(&Vocab{})
+
+	store, err := getStore()
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
 
-	return db, nil
+	_, err = newPracticeSession(store, config, os.Stdin, os.Stdout).run(limit)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-func appdir() (string, error) {
-	hd, err := homedir.Dir()
+func cmdAdd(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdAddHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab add [flags] <term> <translation>\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	var asJSON bool
+	flg.BoolVar(&asJSON, "json", false, "Output JSON")
+
+	err := flg.Parse(args)
 	if err != nil {
-		return "", err
+		log.Fatal(err)
+	}
+
+	if flg.NArg() != 2 || strings.TrimSpace(flg.Arg(0)) == "" || strings.TrimSpace(flg.Arg(1)) == "" {
+		flg.Usage()
+		os.Exit(2)
 	}
-	dir := filepath.Join(hd, ".vocab")
-	_, err = os.Stat(dir)
+
+	store, err := getStore()
 	if err != nil {
-		if os.IsNotExist(err) {
-			if err = os.Mkdir(dir, 0700); err != nil {
-				return "", err
-			}
-		} else {
-			return "", err
+		log.Fatal(err)
+	}
+
+	vocab, err := store.CreateVocab(strings.TrimSpace(flg.Arg(0)), strings.TrimSpace(flg.Arg(1)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if asJSON {
+		err = json.NewEncoder(os.Stdout).Encode(map[string]uint{"id": vocab.ID})
+		if err != nil {
+			log.Fatal(err)
 		}
+	} else {
+		fmt.Printf("added %d: %s -> %s\n", vocab.ID, vocab.Term, vocab.Translation)
 	}
-	return dir, nil
 }
 
-type Vocab struct {
-	ID             uint      `gorm:"primarykey" json:"id"`
-	CreatedAt      time.Time `json:"-"`
-	Term           string    `json:"term"`
-	Translation    string    `json:"translation"`
-	KnowledgeLevel uint      `json:"knowledgeLevel"`
-	PracticeAt     time.Time `json:"practiceAt"`
+func cmdList(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdListHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab list [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	vq := NewVocabQuery()
+	flg.StringVar(&vq.Term, "term", "", "Only list vocab with a term containing this")
+	flg.StringVar(&vq.Translation, "translation", "", "Only list vocab with a translation containing this")
+	flg.StringVar(&vq.Mode, "mode", "and", "How to combine -term and -translation: and or or")
+	flg.StringVar(&vq.OrderBy, "order-by", "", "Order by knowledge_level, knowledge_level_desc, practice_at or practice_at_desc (default term)")
+	flg.IntVar(&vq.Skip, "skip", vq.Skip, "Number of vocab to skip")
+	flg.IntVar(&vq.Take, "take", vq.Take, "Number of vocab to list, at most the max_page_size setting")
+	var asJSON bool
+	flg.BoolVar(&asJSON, "json", false, "Output JSON")
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listVocab(vq, asJSON)
+}
+
+func cmdSearch(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdSearchHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab search [flags] <text>\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	vq := NewVocabQuery()
+	flg.StringVar(&vq.OrderBy, "order-by", "", "Order by knowledge_level, knowledge_level_desc, practice_at or practice_at_desc (default term)")
+	flg.IntVar(&vq.Skip, "skip", vq.Skip, "Number of vocab to skip")
+	flg.IntVar(&vq.Take, "take", vq.Take, "Number of vocab to list, at most the max_page_size setting")
+	var asJSON bool
+	flg.BoolVar(&asJSON, "json", false, "Output JSON")
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	text := strings.TrimSpace(strings.Join(flg.Args(), " "))
+	if text == "" {
+		flg.Usage()
+		os.Exit(2)
+	}
+	vq.Term = text
+	vq.Translation = text
+	vq.Mode = "or"
+
+	listVocab(vq, asJSON)
+}
+
+func listVocab(vq VocabQuery, asJSON bool) {
+	config, err := getConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := getStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	vocabs, count, err := store.FindVocab(vq, config.MaxPageSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = printVocab(os.Stdout, vocabs, count, vq.Skip, asJSON)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cmdRm(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdRmHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab rm <id>...\n\n")
+		fmt.Fprintf(os.Stderr, "Removed vocab is moved to the trash, see 'vocab trash'.\n\n")
+	}
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flg.NArg() == 0 {
+		flg.Usage()
+		os.Exit(2)
+	}
+
+	ids := make([]uint, 0, flg.NArg())
+	for _, arg := range flg.Args() {
+		id, err := strconv.ParseUint(arg, 10, 0)
+		if err != nil {
+			log.Fatalf("invalid id: %s", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+
+	store, err := getStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, id := range ids {
+		found, err := store.DeleteVocab(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !found {
+			log.Fatalf("vocab not found: %d", id)
+		}
+		fmt.Printf("removed %d\n", id)
+	}
+}
+
+func cmdTui(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdTuiHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab tui\n\n")
+	}
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config, err := getConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := getStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = runTui(store, config, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cmdStats(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdStatsHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab stats [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	var asJSON bool
+	flg.BoolVar(&asJSON, "json", false, "Output JSON")
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := getStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if asJSON {
+		err = json.NewEncoder(os.Stdout).Encode(stats)
+	} else {
+		err = printStats(os.Stdout, stats)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cmdProfiles(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdProfilesHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab profiles\n\n")
+		fmt.Fprintf(os.Stderr, "Create a profile by using it, e.g. vocab -profile work start\n\n")
+	}
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	profiles, err := location.profiles()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, profile := range append([]string{"default"}, profiles...) {
+		marker := " "
+		if profile == location.Profile || (profile == "default" && location.Profile == "") {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, profile)
+	}
+}
+
+func cmdConfig(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdConfigHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab config list\n")
+		fmt.Fprintf(os.Stderr, "       vocab config get <key>\n")
+		fmt.Fprintf(os.Stderr, "       vocab config set <key> <value>\n\n")
+		fmt.Fprintf(os.Stderr, "Keys:\n")
+		fmt.Fprintf(os.Stderr, "  port              Port on which to serve the web application\n")
+		fmt.Fprintf(os.Stderr, "  open_browser      Open a web browser when the web application starts: true or false\n")
+		fmt.Fprintf(os.Stderr, "  session_size      Number of vocab in a practice session\n")
+		fmt.Fprintf(os.Stderr, "  max_page_size     Maximum number of vocab listed at once\n")
+		fmt.Fprintf(os.Stderr, "  intervals         Days until the next practice at each knowledge level, e.g. 1,2,4,8,16,32,64\n")
+		fmt.Fprintf(os.Stderr, "  backup_retention  Number of daily backups to keep, 0 to turn them off\n")
+		fmt.Fprintf(os.Stderr, "  trash_days        Days deleted vocab stays in the trash before it's purged, 0 to keep it\n")
+		fmt.Fprintf(os.Stderr, "  accounts          Ask users of the web application to register and log in: true or false\n")
+		fmt.Fprintf(os.Stderr, "  require_token     Only accept API requests with a token, see 'vocab token': true or false\n\n")
+		fmt.Fprintf(os.Stderr, "Settings are kept in %s\n\n", location.configPath())
+	}
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sub := flg.Arg(0)
+	if !(sub == "list" && flg.NArg() == 1) && !(sub == "get" && flg.NArg() == 2) && !(sub == "set" && flg.NArg() == 3) {
+		flg.Usage()
+		os.Exit(2)
+	}
+
+	config, err := getConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if sub == "list" {
+		for _, key := range configKeys {
+			value, err := config.Get(key)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s=%s\n", key, value)
+		}
+	} else if sub == "get" {
+		value, err := config.Get(flg.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(value)
+	} else {
+		err = config.Set(flg.Arg(1), flg.Arg(2))
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = location.ensure()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = saveConfig(location.configPath(), config)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func cmdToken(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdTokenHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab token create [flags]\n")
+		fmt.Fprintf(os.Stderr, "       vocab token list\n")
+		fmt.Fprintf(os.Stderr, "       vocab token revoke <id>\n\n")
+		fmt.Fprintf(os.Stderr, "Send the token with API requests in the header 'Authorization: Bearer <token>'.\n")
+		fmt.Fprintf(os.Stderr, "With -user, the token is for that user's vocab.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+	var name string
+	flg.StringVar(&name, "name", "", "Name of the token, to tell it apart from others, e.g. the script using it (create)")
+
+	if len(args) < 1 {
+		flg.Usage()
+		os.Exit(2)
+	}
+	sub := args[0]
+	err := flg.Parse(args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !(sub == "create" && flg.NArg() == 0) && !(sub == "list" && flg.NArg() == 0 && name == "") && !(sub == "revoke" && flg.NArg() == 1 && name == "") {
+		flg.Usage()
+		os.Exit(2)
+	}
+
+	db, userID, err := getUserDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if sub == "create" {
+		token, apiToken, err := createApiToken(db, userID, name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("created token %d. copy it now, it won't be shown again:\n\n%s\n", apiToken.ID, token)
+	} else if sub == "list" {
+		apiTokens, err := listApiTokens(db, userID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = printApiTokens(os.Stdout, apiTokens)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		id, err := strconv.Atoi(flg.Arg(0))
+		if err != nil || id < 1 {
+			log.Fatal("token id must be a positive number")
+		}
+		revoked, err := revokeApiToken(db, userID, uint(id))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !revoked {
+			log.Fatalf("no token with id %d", id)
+		}
+		fmt.Printf("revoked token %d\n", id)
+	}
+}
+
+func cmdTrash(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdTrashHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab trash list\n")
+		fmt.Fprintf(os.Stderr, "       vocab trash restore <id>\n\n")
+		fmt.Fprintf(os.Stderr, "Removed vocab stays in the trash for trash_days, see 'vocab config'.\n\n")
+	}
+
+	if len(args) < 1 {
+		flg.Usage()
+		os.Exit(2)
+	}
+	sub := args[0]
+	err := flg.Parse(args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !(sub == "list" && flg.NArg() == 0) && !(sub == "restore" && flg.NArg() == 1) {
+		flg.Usage()
+		os.Exit(2)
+	}
+
+	store, err := getStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if sub == "list" {
+		vocabs, err := store.TrashedVocab()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = printTrash(os.Stdout, vocabs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		id, err := strconv.ParseUint(flg.Arg(0), 10, 0)
+		if err != nil {
+			log.Fatalf("invalid id: %s", flg.Arg(0))
+		}
+		vocab, err := store.RestoreVocab(uint(id))
+		if err == ErrVocabNotFound {
+			log.Fatalf("vocab not in the trash: %d", id)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("restored %d: %s -> %s\n", vocab.ID, vocab.Term, vocab.Translation)
+	}
+}
+
+func cmdSync(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdSyncHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab sync <dir>\n")
+		fmt.Fprintf(os.Stderr, "       vocab sync -peer <url> [flags]\n")
+		fmt.Fprintf(os.Stderr, "       vocab sync -gist <id> [flags]\n")
+		fmt.Fprintf(os.Stderr, "       vocab sync -git <dir>\n\n")
+		fmt.Fprintf(os.Stderr, "Each computer appends its changes to its own log in the folder, e.g. a\n")
+		fmt.Fprintf(os.Stderr, "Dropbox or Syncthing folder, and merges the changes in the logs of the\n")
+		fmt.Fprintf(os.Stderr, "others. Run it on each computer, before and after practice.\n\n")
+		fmt.Fprintf(os.Stderr, "With -peer, the changes are exchanged with another vocab server instead.\n")
+		fmt.Fprintf(os.Stderr, "With -gist or -git, the collection is kept as %s in a gist or a git\n", snapshotFile)
+		fmt.Fprintf(os.Stderr, "repository, which each computer merges and updates.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+	var peerURL string
+	flg.StringVar(&peerURL, "peer", "", "URL of a vocab server to sync with, e.g. http://vocab.home:3000")
+	var peerToken string
+	flg.StringVar(&peerToken, "peer-token", os.Getenv("VOCAB_PEER_TOKEN"), "API token to send to the peer (overrides $VOCAB_PEER_TOKEN)")
+	var gistID string
+	flg.StringVar(&gistID, "gist", "", "ID of a gist to sync through")
+	var gistToken string
+	flg.StringVar(&gistToken, "gist-token", os.Getenv("VOCAB_GIST_TOKEN"), "GitHub token allowed to change the gist (overrides $VOCAB_GIST_TOKEN)")
+	var gistAPI string
+	flg.StringVar(&gistAPI, "gist-api", defaultGistAPI, "URL of the gist API")
+	var gitDir string
+	flg.StringVar(&gitDir, "git", "", "Directory of a git repository to sync through, pulling and pushing if it has a remote")
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	given := 0
+	for _, value := range []string{peerURL, gistID, gitDir} {
+		if value != "" {
+			given++
+		}
+	}
+	if given > 1 || (given == 0 && flg.NArg() != 1) || (given == 1 && flg.NArg() != 0) {
+		flg.Usage()
+		os.Exit(2)
+	}
+
+	db, userID, err := getUserDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var result *SyncResult
+	if peerURL != "" {
+		result, err = syncPeer(db, userID, client.New(peerURL, peerToken))
+	} else if gistID != "" {
+		result, err = syncBackend(db, userID, NewGistBackend(gistAPI, gistToken, gistID))
+	} else if gitDir != "" {
+		result, err = syncBackend(db, userID, NewGitBackend(gitDir))
+	} else {
+		result, err = syncDir(db, userID, flg.Arg(0))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if gistID != "" || gitDir != "" {
+		fmt.Printf("synced: merged %d changes, sent %d changes\n", result.Merged, result.Sent)
+	} else {
+		fmt.Printf("synced as device %s with %d other devices: merged %d changes, sent %d changes\n", result.DeviceID, result.Peers, result.Merged, result.Sent)
+	}
+}
+
+func cmdMigrate(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdMigrateHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab migrate status\n")
+		fmt.Fprintf(os.Stderr, "       vocab migrate up [flags]\n")
+		fmt.Fprintf(os.Stderr, "       vocab migrate down [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Pending migrations are applied automatically when the database is opened.\n")
+		fmt.Fprintf(os.Stderr, "The database is backed up to %s before migrating.\n\n", location.backupDir())
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	var to int
+	flg.IntVar(&to, "to", -1, "Version to migrate up or down to (default latest for up, previous for down)")
+
+	if len(args) < 1 {
+		flg.Usage()
+		os.Exit(2)
+	}
+	sub := args[0]
+	err := flg.Parse(args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if (sub != "status" && sub != "up" && sub != "down") || flg.NArg() != 0 || (sub == "status" && to != -1) {
+		flg.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if sub == "status" {
+		states, err := migrationStatus(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%3d  %-24s %s\n", state.Version, state.Description, applied)
+		}
+		return
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var done []migration
+	if sub == "up" {
+		if to == -1 {
+			to = latestVersion()
+		}
+		if to < version || to > latestVersion() {
+			log.Fatalf("flag -to must be between %d and %d", version, latestVersion())
+		}
+		backupIfChanging(db, version, to)
+		done, err = migrateUp(db, to)
+		for _, m := range done {
+			fmt.Printf("applied %d: %s\n", m.Version, m.Description)
+		}
+	} else {
+		if to == -1 {
+			to = max(version-1, 0)
+		}
+		if to < 0 || to > version {
+			log.Fatalf("flag -to must be between 0 and %d", version)
+		}
+		backupIfChanging(db, version, to)
+		done, err = migrateDown(db, to)
+		for _, m := range done {
+			fmt.Printf("rolled back %d: %s\n", m.Version, m.Description)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(done) == 0 {
+		fmt.Printf("nothing to do, at version %d\n", version)
+	}
+}
+
+func cmdBackup(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdBackupHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab backup [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "The backup is a consistent snapshot, even while vocab is running.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	var fileS string
+	flg.StringVar(&fileS, "file", "", fmt.Sprintf("File path to back up to (default \"%s\")", filepath.Join(location.backupDir(), "vocab-<time>.db")))
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if fileS == "" {
+		fileS = filepath.Join(location.backupDir(), backupName(time.Now(), ""))
+	}
+
+	db, err := getDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = backupDb(db, fileS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("backed up to %s\n", fileS)
+}
+
+func cmdRestore(args []string) {
+	flg := flag.NewFlagSet("", flag.ExitOnError)
+	flg.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n"+cmdRestoreHeadline+"\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: vocab restore [flags] <file>\n\n")
+		fmt.Fprintf(os.Stderr, "The backup is checked before restoring and the current database backed up\n")
+		fmt.Fprintf(os.Stderr, "to %s first. Stop vocab start before restoring.\n\n", location.backupDir())
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		flg.PrintDefaults()
+	}
+
+	var yes bool
+	flg.BoolVar(&yes, "yes", false, "Don't ask for confirmation")
+
+	err := flg.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flg.NArg() != 1 {
+		flg.Usage()
+		os.Exit(2)
+	}
+	src := flg.Arg(0)
+
+	if location.DSN != "" {
+		log.Fatal(ErrNotSqlite)
+	}
+
+	info, err := checkBackup(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := getDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var count int64
+	err = db.Model(&Vocab{}).Count(&count).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !yes {
+		fmt.Printf("replace %s (%d vocab) with %s (%d vocab)? [y/N] ", location.DB, count, src, info.Vocabs)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("not restored")
+			os.Exit(1)
+		}
+	}
+
+	backup := filepath.Join(location.backupDir(), backupName(time.Now(), "before-restore"))
+	err = backupDb(db, backup)
+	if err != nil {
+		log.Fatalf("backing up before restoring: %s", err)
+	}
+	fmt.Printf("backed up to %s\n", backup)
+
+	sqlDb, err := db.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = sqlDb.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = restoreDb(src, location.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Bring an older backup up to date.
+	_, err = getDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("restored %d vocab from %s\n", info.Vocabs, src)
+}
+
+func backupIfChanging(db *gorm.DB, version, to int) {
+	if version == to {
+		return
+	}
+	backup, err := backupBeforeMigrate(db, location.backupDir())
+	if err != nil {
+		log.Fatalf("backing up before migrating: %s", err)
+	}
+	if backup != "" {
+		fmt.Printf("backed up to %s\n", backup)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// progressBar renders progress through a file of known size on a single line.
+type progressBar struct {
+	w     io.Writer
+	total int64
+	rows  int
+}
+
+func (p *progressBar) update(read int64, rows int) {
+	p.rows = rows
+	ratio := 1.0
+	if p.total > 0 && read < p.total {
+		ratio = float64(read) / float64(p.total)
+	}
+	width := 40
+	filled := int(ratio * float64(width))
+	fmt.Fprintf(p.w, "\r[%s%s] %3d%% %d rows",
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", width-filled),
+		int(ratio*100),
+		rows)
+}
+
+func (p *progressBar) done() {
+	if p.rows > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// getStore opens the database as a Store of the collection given by -user,
+// or returns a Store of the server given by -server.
+func getStore() (Store, error) {
+	if remote != nil {
+		return NewRemoteStore(remote), nil
+	}
+	db, userID, err := getUserDb()
+	if err != nil {
+		return nil, err
+	}
+	return NewUserStore(db, userID), nil
+}
+
+// getUserDb opens the database, returning it with the ID of the user given by
+// -user, or noUser for the local collection.
+func getUserDb() (*gorm.DB, uint, error) {
+	db, err := getDb()
+	if err != nil {
+		return nil, 0, err
+	}
+	if username == "" {
+		return db, noUser, nil
+	}
+	user, err := findUser(db, username)
+	if err != nil {
+		return nil, 0, err
+	}
+	if user == nil {
+		return nil, 0, fmt.Errorf("no such user: %s", username)
+	}
+	return db, user.ID, nil
+}
+
+func getConfig() (*Config, error) {
+	return loadConfig(location.configPath())
+}
+
+// openDb opens the database without migrating it.
+func openDb() (*gorm.DB, error) {
+	err := location.ensure()
+	if err != nil {
+		return nil, err
+	}
+
+	return gorm.Open(location.dialector())
+}
+
+// getDb opens the database, backing it up and applying any pending
+// migrations first.
+func getDb() (*gorm.DB, error) {
+	if remote != nil {
+		return nil, ErrLocalOnly
+	}
+	db, err := openDb()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version < latestVersion() {
+		backup, err := backupBeforeMigrate(db, location.backupDir())
+		if err != nil {
+			return nil, fmt.Errorf("backing up before migrating: %w", err)
+		}
+		if backup != "" {
+			log.Printf("Backed up the database to %s before migrating", backup)
+		}
+		_, err = migrateUp(db, latestVersion())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+type Vocab struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"-"`
+	UserID         uint      `gorm:"index" json:"-"`
+	Term           string    `json:"term"`
+	Translation    string    `json:"translation"`
+	KnowledgeLevel uint      `json:"knowledgeLevel"`
+	PracticeAt     time.Time `json:"practiceAt"`
+	// SyncID identifies the vocab on every device it's synced to.
+	SyncID string `gorm:"uniqueIndex" json:"-"`
+	// UpdatedAt is when the vocab was last changed on this device.
+	UpdatedAt time.Time `json:"-"`
+	// EditedAt is when the term or translation was last changed, on any
+	// device.
+	EditedAt time.Time `json:"-"`
+	// ReviewedAt is when the vocab was last practised, on any device, or nil
+	// if it hasn't been.
+	ReviewedAt *time.Time `json:"-"`
+	// DeletedAt is when the vocab was moved to the trash. Queries leave out
+	// vocab in the trash unless they're Unscoped.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Review records the outcome of practising a vocab.
+type Review struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserID    uint      `gorm:"index" json:"-"`
+	VocabID   uint      `gorm:"index" json:"vocabId"`
+	Passed    bool      `json:"passed"`
+	SyncID    string    `gorm:"uniqueIndex" json:"-"`
+	// Batch identifies the reviews recorded together, e.g. the results of a
+	// practice session, to undo them together. It's "" for reviews synced
+	// from other devices, which can't be undone.
+	Batch string `gorm:"index;not null;default:''" json:"-"`
+	// PreviousKnowledgeLevel and PreviousPracticeAt are those of the vocab
+	// before the review, to which undoing it goes back.
+	PreviousKnowledgeLevel uint       `gorm:"not null;default:0" json:"-"`
+	PreviousPracticeAt     *time.Time `json:"-"`
 }
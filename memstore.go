@@ -0,0 +1,320 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryStore is a Store that keeps vocab in memory, for fast tests of code
+// that doesn't care how the vocab is kept. It isn't safe for concurrent use.
+type memoryStore struct {
+	vocabs  []Vocab
+	reviews []Review
+	// trash is the deleted vocab, the last deleted at the end.
+	trash  []Vocab
+	lastID uint
+	// batch is the batch of the reviews recorded in a transaction, or 0
+	// outside one.
+	batch     int
+	lastBatch int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		vocabs:  make([]Vocab, 0),
+		reviews: make([]Review, 0),
+		trash:   make([]Vocab, 0),
+	}
+}
+
+func (s *memoryStore) FindVocab(vq VocabQuery, maxTake int) ([]Vocab, int64, error) {
+	contains := func(s, substr string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+
+	matches := make([]Vocab, 0)
+	for _, vocab := range s.vocabs {
+		term := vq.Term == "" || contains(vocab.Term, vq.Term)
+		translation := vq.Translation == "" || contains(vocab.Translation, vq.Translation)
+		if vq.Mode == "or" && vq.Term != "" && vq.Translation != "" {
+			if !(term || translation) {
+				continue
+			}
+		} else if !(term && translation) {
+			continue
+		}
+		matches = append(matches, vocab)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch vq.OrderBy {
+		case "knowledge_level":
+			if a.KnowledgeLevel != b.KnowledgeLevel {
+				return a.KnowledgeLevel < b.KnowledgeLevel
+			}
+		case "knowledge_level_desc":
+			if a.KnowledgeLevel != b.KnowledgeLevel {
+				return a.KnowledgeLevel > b.KnowledgeLevel
+			}
+		case "practice_at":
+			if !a.PracticeAt.Equal(b.PracticeAt) {
+				return a.PracticeAt.Before(b.PracticeAt)
+			}
+		case "practice_at_desc":
+			if !a.PracticeAt.Equal(b.PracticeAt) {
+				return a.PracticeAt.After(b.PracticeAt)
+			}
+		}
+		return a.Term < b.Term
+	})
+
+	count := int64(len(matches))
+	start := min(max(vq.Skip, 0), len(matches))
+	end := min(start+max(min(vq.Take, maxTake), 0), len(matches))
+	return matches[start:end], count, nil
+}
+
+func (s *memoryStore) AllVocab() ([]Vocab, error) {
+	return append([]Vocab{}, s.vocabs...), nil
+}
+
+func (s *memoryStore) KnowledgeVocab(minLevel, maxLevel uint) ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	for _, vocab := range s.vocabs {
+		if vocab.KnowledgeLevel >= minLevel && vocab.KnowledgeLevel <= maxLevel {
+			vocabs = append(vocabs, vocab)
+		}
+	}
+	return vocabs, nil
+}
+
+func (s *memoryStore) CreateVocab(term, translation string) (*Vocab, error) {
+	s.lastID++
+	vocab := Vocab{
+		ID:             s.lastID,
+		CreatedAt:      time.Now(),
+		Term:           term,
+		Translation:    translation,
+		KnowledgeLevel: 0,
+		PracticeAt:     inDays(0),
+	}
+	s.vocabs = append(s.vocabs, vocab)
+	return &vocab, nil
+}
+
+func (s *memoryStore) AddVocab(vocabs []Vocab) error {
+	for _, vocab := range vocabs {
+		s.lastID++
+		vocab.ID = s.lastID
+		vocab.CreatedAt = time.Now()
+		s.vocabs = append(s.vocabs, vocab)
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateVocab(id uint, term, translation string) (*Vocab, error) {
+	idx := s.indexOf(id)
+	if idx < 0 {
+		return nil, ErrVocabNotFound
+	}
+	s.vocabs[idx].Term = term
+	s.vocabs[idx].Translation = translation
+	vocab := s.vocabs[idx]
+	return &vocab, nil
+}
+
+func (s *memoryStore) DeleteVocab(id uint) (bool, error) {
+	idx := s.indexOf(id)
+	if idx < 0 {
+		return false, nil
+	}
+	vocab := s.vocabs[idx]
+	vocab.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.trash = append(s.trash, vocab)
+	s.vocabs = append(s.vocabs[:idx], s.vocabs[idx+1:]...)
+	return true, nil
+}
+
+func (s *memoryStore) DeleteAllVocab() error {
+	s.vocabs = make([]Vocab, 0)
+	s.reviews = make([]Review, 0)
+	s.trash = make([]Vocab, 0)
+	return nil
+}
+
+func (s *memoryStore) TrashedVocab() ([]Vocab, error) {
+	trashed := make([]Vocab, 0, len(s.trash))
+	for idx := len(s.trash) - 1; idx >= 0; idx-- {
+		trashed = append(trashed, s.trash[idx])
+	}
+	return trashed, nil
+}
+
+func (s *memoryStore) RestoreVocab(id uint) (*Vocab, error) {
+	for idx, vocab := range s.trash {
+		if vocab.ID == id {
+			vocab.DeletedAt = gorm.DeletedAt{}
+			s.trash = append(s.trash[:idx], s.trash[idx+1:]...)
+			s.vocabs = append(s.vocabs, vocab)
+			return &vocab, nil
+		}
+	}
+	return nil, ErrVocabNotFound
+}
+
+func (s *memoryStore) DueVocab(limit int) ([]Vocab, error) {
+	due := s.due()
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].PracticeAt.Before(due[j].PracticeAt)
+	})
+	return due[:min(limit, len(due))], nil
+}
+
+func (s *memoryStore) CountDueVocab() (int64, error) {
+	return int64(len(s.due())), nil
+}
+
+func (s *memoryStore) RecordReview(config *Config, id uint, passed bool) (*Vocab, error) {
+	idx := s.indexOf(id)
+	if idx < 0 {
+		return nil, ErrVocabNotFound
+	}
+	batch := s.batch
+	if batch == 0 {
+		s.lastBatch++
+		batch = s.lastBatch
+	}
+	previousPracticeAt := s.vocabs[idx].PracticeAt
+	review := Review{
+		ID:                     uint(len(s.reviews) + 1),
+		CreatedAt:              time.Now(),
+		VocabID:                id,
+		Passed:                 passed,
+		Batch:                  strconv.Itoa(batch),
+		PreviousKnowledgeLevel: s.vocabs[idx].KnowledgeLevel,
+		PreviousPracticeAt:     &previousPracticeAt,
+	}
+	schedule(config, &s.vocabs[idx], passed)
+	s.reviews = append(s.reviews, review)
+	vocab := s.vocabs[idx]
+	return &vocab, nil
+}
+
+func (s *memoryStore) RecordReviews(config *Config, answers []Answer) ([]Vocab, error) {
+	return recordReviews(s, config, answers)
+}
+
+func (s *memoryStore) UndoPractice() ([]Vocab, error) {
+	if len(s.reviews) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	batch := s.reviews[len(s.reviews)-1].Batch
+	undone := make(map[uint]bool)
+	for len(s.reviews) > 0 && s.reviews[len(s.reviews)-1].Batch == batch {
+		review := s.reviews[len(s.reviews)-1]
+		s.reviews = s.reviews[:len(s.reviews)-1]
+		idx := s.indexOf(review.VocabID)
+		if idx < 0 {
+			continue
+		}
+		s.vocabs[idx].KnowledgeLevel = review.PreviousKnowledgeLevel
+		s.vocabs[idx].PracticeAt = *review.PreviousPracticeAt
+		undone[review.VocabID] = true
+	}
+
+	vocabs := make([]Vocab, 0, len(undone))
+	for _, vocab := range s.vocabs {
+		if undone[vocab.ID] {
+			vocabs = append(vocabs, vocab)
+		}
+	}
+	sort.Slice(vocabs, func(i, j int) bool {
+		return vocabs[i].ID < vocabs[j].ID
+	})
+	return vocabs, nil
+}
+
+func (s *memoryStore) Stats() (*Stats, error) {
+	stats := &Stats{
+		Total:           int64(len(s.vocabs)),
+		KnowledgeLevels: make([]int64, maxKnowledge+1),
+		Last7Days:       s.reviewStats(inDays(-6)),
+		Last30Days:      s.reviewStats(inDays(-29)),
+	}
+	for _, vocab := range s.vocabs {
+		if vocab.PracticeAt.Before(inDays(1)) {
+			stats.DueToday++
+		}
+		if vocab.PracticeAt.Before(inDays(7)) {
+			stats.DueThisWeek++
+		}
+		if vocab.KnowledgeLevel <= maxKnowledge {
+			stats.KnowledgeLevels[vocab.KnowledgeLevel]++
+		}
+	}
+	times := make([]time.Time, 0, len(s.reviews))
+	for idx := len(s.reviews) - 1; idx >= 0; idx-- {
+		times = append(times, s.reviews[idx].CreatedAt)
+	}
+	stats.Streak = streak(times)
+	return stats, nil
+}
+
+func (s *memoryStore) Transaction(fn func(tx Store) error) error {
+	vocabs := append([]Vocab{}, s.vocabs...)
+	reviews := append([]Review{}, s.reviews...)
+	trash := append([]Vocab{}, s.trash...)
+	lastID := s.lastID
+	s.lastBatch++
+	s.batch = s.lastBatch
+	defer func() { s.batch = 0 }()
+
+	err := fn(s)
+	if err != nil {
+		s.vocabs, s.reviews, s.trash, s.lastID = vocabs, reviews, trash, lastID
+	}
+	return err
+}
+
+// reviewStats summarises the reviews made since the given time.
+func (s *memoryStore) reviewStats(since time.Time) ReviewStats {
+	var rs ReviewStats
+	for _, review := range s.reviews {
+		if review.CreatedAt.Before(since) {
+			continue
+		}
+		rs.Reviews++
+		if review.Passed {
+			rs.Passed++
+		}
+	}
+	if rs.Reviews > 0 {
+		rs.Accuracy = float64(rs.Passed) / float64(rs.Reviews)
+	}
+	return rs
+}
+
+func (s *memoryStore) indexOf(id uint) int {
+	for idx, vocab := range s.vocabs {
+		if vocab.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (s *memoryStore) due() []Vocab {
+	now := time.Now()
+	due := make([]Vocab, 0)
+	for _, vocab := range s.vocabs {
+		if vocab.PracticeAt.Before(now) {
+			due = append(due, vocab)
+		}
+	}
+	return due
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is a versioned change to the schema. Migrations are applied in
+// order and each is recorded in the schema_version table, so a database can be
+// brought up to date, or rolled back, one version at a time.
+//
+// Migrations must not use the current models, which change over time. They
+// declare the tables as they were at that version instead.
+type migration struct {
+	Version     int
+	Description string
+	Up          func(tx *gorm.DB) error
+	Down        func(tx *gorm.DB) error
+}
+
+// SchemaVersion records an applied migration.
+type SchemaVersion struct {
+	Version   int `gorm:"primarykey;autoIncrement:false"`
+	AppliedAt time.Time
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+type vocabV1 struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	Term           string
+	Translation    string
+	KnowledgeLevel uint
+	PracticeAt     time.Time
+}
+
+func (vocabV1) TableName() string {
+	return "vocabs"
+}
+
+type reviewV2 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	VocabID   uint `gorm:"index"`
+	Passed    bool
+}
+
+func (reviewV2) TableName() string {
+	return "reviews"
+}
+
+// vocabV3 and reviewV3 only declare the columns added in version 3.
+type vocabV3 struct {
+	UserID uint `gorm:"index;not null;default:0"`
+}
+
+func (vocabV3) TableName() string {
+	return "vocabs"
+}
+
+type reviewV3 struct {
+	UserID uint `gorm:"index;not null;default:0"`
+}
+
+func (reviewV3) TableName() string {
+	return "reviews"
+}
+
+type userV3 struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	Username     string `gorm:"uniqueIndex"`
+	PasswordHash string
+}
+
+func (userV3) TableName() string {
+	return "users"
+}
+
+type sessionV3 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex"`
+	UserID    uint   `gorm:"index"`
+	ExpiresAt time.Time
+}
+
+func (sessionV3) TableName() string {
+	return "sessions"
+}
+
+type apiTokenV4 struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"uniqueIndex"`
+	LastUsedAt *time.Time
+}
+
+func (apiTokenV4) TableName() string {
+	return "api_tokens"
+}
+
+// vocabV5 and reviewV5 only declare the columns added in version 5.
+type vocabV5 struct {
+	SyncID     string `gorm:"uniqueIndex"`
+	UpdatedAt  time.Time
+	EditedAt   time.Time
+	ReviewedAt *time.Time
+}
+
+func (vocabV5) TableName() string {
+	return "vocabs"
+}
+
+type reviewV5 struct {
+	SyncID string `gorm:"uniqueIndex"`
+}
+
+func (reviewV5) TableName() string {
+	return "reviews"
+}
+
+type tombstoneV5 struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index"`
+	SyncID    string `gorm:"index"`
+	DeletedAt time.Time
+}
+
+func (tombstoneV5) TableName() string {
+	return "tombstones"
+}
+
+type syncStateV5 struct {
+	ID         uint `gorm:"primarykey"`
+	UserID     uint `gorm:"uniqueIndex"`
+	DeviceID   string
+	ExportedAt time.Time
+}
+
+func (syncStateV5) TableName() string {
+	return "sync_states"
+}
+
+type syncPeerV5 struct {
+	ID       uint   `gorm:"primarykey"`
+	UserID   uint   `gorm:"index"`
+	DeviceID string `gorm:"index"`
+	Lines    int
+}
+
+func (syncPeerV5) TableName() string {
+	return "sync_peers"
+}
+
+type syncPeerV6 struct {
+	URL      string `gorm:"index"`
+	Received string
+	Sent     string
+}
+
+func (syncPeerV6) TableName() string {
+	return "sync_peers"
+}
+
+type vocabV7 struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (vocabV7) TableName() string {
+	return "vocabs"
+}
+
+type reviewV8 struct {
+	Batch                  string `gorm:"index;not null;default:''"`
+	PreviousKnowledgeLevel uint   `gorm:"not null;default:0"`
+	PreviousPracticeAt     *time.Time
+}
+
+func (reviewV8) TableName() string {
+	return "reviews"
+}
+
+type tombstoneV9 struct {
+	Type string `gorm:"not null;default:'delete'"`
+}
+
+func (tombstoneV9) TableName() string {
+	return "tombstones"
+}
+
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create vocabs",
+		Up: func(tx *gorm.DB) error {
+			// Databases from before versioned migrations already have the table.
+			if tx.Migrator().HasTable(&vocabV1{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&vocabV1{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&vocabV1{})
+		},
+	},
+	{
+		Version:     2,
+		Description: "create reviews",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasTable(&reviewV2{}) {
+				return nil
+			}
+			return tx.Migrator().CreateTable(&reviewV2{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&reviewV2{})
+		},
+	},
+	{
+		Version:     3,
+		Description: "add users and sessions, and the owner of vocab and reviews",
+		Up: func(tx *gorm.DB) error {
+			err := tx.Migrator().CreateTable(&userV3{}, &sessionV3{})
+			if err != nil {
+				return err
+			}
+			// Existing vocab and reviews belong to no user, i.e. the local
+			// collection.
+			for _, model := range []interface{}{&vocabV3{}, &reviewV3{}} {
+				if tx.Migrator().HasColumn(model, "UserID") {
+					continue
+				}
+				err = tx.Migrator().AddColumn(model, "UserID")
+				if err != nil {
+					return err
+				}
+				err = tx.Migrator().CreateIndex(model, "UserID")
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, model := range []interface{}{&vocabV3{}, &reviewV3{}} {
+				err := tx.Migrator().DropIndex(model, "UserID")
+				if err != nil {
+					return err
+				}
+				err = tx.Migrator().DropColumn(model, "UserID")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&sessionV3{}, &userV3{})
+		},
+	},
+	{
+		Version:     4,
+		Description: "create api_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&apiTokenV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&apiTokenV4{})
+		},
+	},
+	{
+		Version:     5,
+		Description: "add sync IDs and change times of vocab and reviews, tombstones and sync state",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []struct {
+				model interface{}
+				field string
+			}{
+				{&vocabV5{}, "SyncID"},
+				{&vocabV5{}, "UpdatedAt"},
+				{&vocabV5{}, "EditedAt"},
+				{&vocabV5{}, "ReviewedAt"},
+				{&reviewV5{}, "SyncID"},
+			} {
+				if tx.Migrator().HasColumn(column.model, column.field) {
+					continue
+				}
+				err := tx.Migrator().AddColumn(column.model, column.field)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Existing vocab was last changed when it was added, and last
+			// reviewed at its latest review.
+			randomID := "md5(random()::text || clock_timestamp()::text)"
+			if isSqlite(tx) {
+				randomID = "lower(hex(randomblob(16)))"
+			}
+			for _, sql := range []string{
+				"update vocabs set sync_id = " + randomID + " where sync_id is null or sync_id = ''",
+				"update vocabs set updated_at = created_at where updated_at is null",
+				"update vocabs set edited_at = created_at where edited_at is null",
+				"update vocabs set reviewed_at = (select max(created_at) from reviews where reviews.vocab_id = vocabs.id) where reviewed_at is null",
+				"update reviews set sync_id = " + randomID + " where sync_id is null or sync_id = ''",
+			} {
+				err := tx.Exec(sql).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, model := range []interface{}{&vocabV5{}, &reviewV5{}} {
+				if tx.Migrator().HasIndex(model, "SyncID") {
+					continue
+				}
+				err := tx.Migrator().CreateIndex(model, "SyncID")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().CreateTable(&tombstoneV5{}, &syncStateV5{}, &syncPeerV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropTable(&syncPeerV5{}, &syncStateV5{}, &tombstoneV5{})
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropIndex(&reviewV5{}, "SyncID")
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropColumn(&reviewV5{}, "SyncID")
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropIndex(&vocabV5{}, "SyncID")
+			if err != nil {
+				return err
+			}
+			for _, field := range []string{"SyncID", "UpdatedAt", "EditedAt", "ReviewedAt"} {
+				err = tx.Migrator().DropColumn(&vocabV5{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			// SQLite drops columns by copying the table, without its
+			// indexes.
+			for _, index := range []struct {
+				model interface{}
+				field string
+			}{
+				{&vocabV3{}, "UserID"},
+				{&reviewV2{}, "VocabID"},
+				{&reviewV3{}, "UserID"},
+			} {
+				if tx.Migrator().HasIndex(index.model, index.field) {
+					continue
+				}
+				err = tx.Migrator().CreateIndex(index.model, index.field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     6,
+		Description: "add URL and cursors of sync peers",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"URL", "Received", "Sent"} {
+				if tx.Migrator().HasColumn(&syncPeerV6{}, field) {
+					continue
+				}
+				err := tx.Migrator().AddColumn(&syncPeerV6{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&syncPeerV6{}, "URL") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&syncPeerV6{}, "URL")
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropIndex(&syncPeerV6{}, "URL")
+			if err != nil {
+				return err
+			}
+			for _, field := range []string{"URL", "Received", "Sent"} {
+				err = tx.Migrator().DropColumn(&syncPeerV6{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			// SQLite drops columns by copying the table, without its
+			// indexes.
+			for _, field := range []string{"UserID", "DeviceID"} {
+				if tx.Migrator().HasIndex(&syncPeerV5{}, field) {
+					continue
+				}
+				err = tx.Migrator().CreateIndex(&syncPeerV5{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     7,
+		Description: "add deleted_at to vocabs, for the trash",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&vocabV7{}, "DeletedAt") {
+				err := tx.Migrator().AddColumn(&vocabV7{}, "DeletedAt")
+				if err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&vocabV7{}, "DeletedAt") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&vocabV7{}, "DeletedAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			// Vocab in the trash would come back.
+			err := tx.Exec("delete from vocabs where deleted_at is not null").Error
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropIndex(&vocabV7{}, "DeletedAt")
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropColumn(&vocabV7{}, "DeletedAt")
+			if err != nil {
+				return err
+			}
+			// SQLite drops columns by copying the table, without its
+			// indexes.
+			for _, index := range []struct {
+				model interface{}
+				field string
+			}{
+				{&vocabV3{}, "UserID"},
+				{&vocabV5{}, "SyncID"},
+			} {
+				if tx.Migrator().HasIndex(index.model, index.field) {
+					continue
+				}
+				err = tx.Migrator().CreateIndex(index.model, index.field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     8,
+		Description: "add batches and previous schedules to reviews, to undo practice",
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"Batch", "PreviousKnowledgeLevel", "PreviousPracticeAt"} {
+				if tx.Migrator().HasColumn(&reviewV8{}, field) {
+					continue
+				}
+				err := tx.Migrator().AddColumn(&reviewV8{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&reviewV8{}, "Batch") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&reviewV8{}, "Batch")
+		},
+		Down: func(tx *gorm.DB) error {
+			err := tx.Migrator().DropIndex(&reviewV8{}, "Batch")
+			if err != nil {
+				return err
+			}
+			for _, field := range []string{"Batch", "PreviousKnowledgeLevel", "PreviousPracticeAt"} {
+				err = tx.Migrator().DropColumn(&reviewV8{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			// SQLite drops columns by copying the table, without its
+			// indexes.
+			for _, index := range []struct {
+				model interface{}
+				field string
+			}{
+				{&reviewV2{}, "VocabID"},
+				{&reviewV3{}, "UserID"},
+				{&reviewV5{}, "SyncID"},
+			} {
+				if tx.Migrator().HasIndex(index.model, index.field) {
+					continue
+				}
+				err = tx.Migrator().CreateIndex(index.model, index.field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     9,
+		Description: "add types to tombstones, to sync undone practice",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&tombstoneV9{}, "Type") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&tombstoneV9{}, "Type")
+		},
+		Down: func(tx *gorm.DB) error {
+			// Undone reviews would be taken for deleted vocab.
+			err := tx.Exec("delete from tombstones where type <> 'delete'").Error
+			if err != nil {
+				return err
+			}
+			err = tx.Migrator().DropColumn(&tombstoneV9{}, "Type")
+			if err != nil {
+				return err
+			}
+			// SQLite drops columns by copying the table, without its
+			// indexes.
+			for _, field := range []string{"UserID", "SyncID"} {
+				if tx.Migrator().HasIndex(&tombstoneV5{}, field) {
+					continue
+				}
+				err = tx.Migrator().CreateIndex(&tombstoneV5{}, field)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+func latestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func createSchemaVersionTable(db *gorm.DB) error {
+	if db.Migrator().HasTable(&SchemaVersion{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&SchemaVersion{})
+}
+
+// schemaVersion returns the version of the latest applied migration, or 0 if
+// none have been applied.
+func schemaVersion(db *gorm.DB) (int, error) {
+	err := createSchemaVersionTable(db)
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	dbResult := db.Model(&SchemaVersion{}).Select("coalesce(max(version), 0)").Scan(&version)
+	return version, dbResult.Error
+}
+
+type migrationState struct {
+	migration
+	// AppliedAt is nil if the migration hasn't been applied.
+	AppliedAt *time.Time
+}
+
+func migrationStatus(db *gorm.DB) ([]migrationState, error) {
+	err := createSchemaVersionTable(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]SchemaVersion, 0)
+	dbResult := db.Find(&applied)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	appliedAt := make(map[int]time.Time)
+	for _, sv := range applied {
+		appliedAt[sv.Version] = sv.AppliedAt
+	}
+
+	states := make([]migrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := migrationState{migration: m}
+		if t, ok := appliedAt[m.Version]; ok {
+			state.AppliedAt = &t
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// migrateUp applies the pending migrations up to and including the target
+// version, each in its own transaction. It returns the migrations applied.
+func migrateUp(db *gorm.DB, target int) ([]migration, error) {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]migration, 0)
+	for _, m := range migrations {
+		if m.Version <= version || m.Version > target {
+			continue
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := m.Up(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{Version: m.Version, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// migrateDown rolls back the applied migrations above the target version,
+// latest first. It returns the migrations rolled back.
+func migrateDown(db *gorm.DB, target int) ([]migration, error) {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	rolledBack := make([]migration, 0)
+	for idx := len(migrations) - 1; idx >= 0; idx-- {
+		m := migrations[idx]
+		if m.Version > version || m.Version <= target {
+			continue
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := m.Down(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaVersion{Version: m.Version}).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("rolling back migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+		rolledBack = append(rolledBack, m)
+	}
+	return rolledBack, nil
+}
+
+// backupBeforeMigrate copies the database into dir before migrations are
+// applied, returning the path of the copy, or "" if the database is empty.
+// PostgreSQL databases aren't backed up.
+func backupBeforeMigrate(db *gorm.DB, dir string) (string, error) {
+	if !isSqlite(db) || !db.Migrator().HasTable("vocabs") {
+		return "", nil
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backupName(time.Now(), fmt.Sprintf("v%d", version)))
+	err = backupDb(db, path)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
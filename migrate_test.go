@@ -0,0 +1,323 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func emptyDb(t testing.TB) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	require.Nil(t, err)
+	return db
+}
+
+func requireVersion(t *testing.T, db *gorm.DB, expected int) {
+	version, err := schemaVersion(db)
+	require.Nil(t, err)
+	require.Equal(t, expected, version)
+}
+
+func Test_Migrations_Ordered(t *testing.T) {
+	for idx, m := range migrations {
+		require.Equal(t, idx+1, m.Version)
+		require.NotEmpty(t, m.Description)
+		require.NotNil(t, m.Up)
+		require.NotNil(t, m.Down)
+	}
+}
+
+func Test_Migrations_UpDown(t *testing.T) {
+	db := emptyDb(t)
+	requireVersion(t, db, 0)
+
+	// Each migration can be applied, rolled back and applied again.
+	for _, m := range migrations {
+		applied, err := migrateUp(db, m.Version)
+		require.Nil(t, err)
+		require.Len(t, applied, 1)
+		requireVersion(t, db, m.Version)
+
+		rolledBack, err := migrateDown(db, m.Version-1)
+		require.Nil(t, err)
+		require.Len(t, rolledBack, 1)
+		requireVersion(t, db, m.Version-1)
+
+		_, err = migrateUp(db, m.Version)
+		require.Nil(t, err)
+		requireVersion(t, db, m.Version)
+	}
+
+	applied, err := migrateUp(db, latestVersion())
+	require.Nil(t, err)
+	require.Len(t, applied, 0)
+
+	rolledBack, err := migrateDown(db, 0)
+	require.Nil(t, err)
+	require.Len(t, rolledBack, len(migrations))
+	requireVersion(t, db, 0)
+	require.False(t, db.Migrator().HasTable("vocabs"))
+}
+
+// The models must match the schema the migrations build.
+func Test_Migrations_MatchModels(t *testing.T) {
+	db := memoryDb(t)
+
+	for _, model := range []interface{}{&Vocab{}, &Review{}, &User{}, &Session{}, &ApiToken{}, &Tombstone{}, &SyncState{}, &SyncPeer{}} {
+		stmt := &gorm.Statement{DB: db}
+		require.Nil(t, stmt.Parse(model))
+		require.True(t, db.Migrator().HasTable(model), stmt.Schema.Table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			require.True(t, db.Migrator().HasColumn(model, field.DBName), "%s.%s", stmt.Schema.Table, field.DBName)
+		}
+	}
+}
+
+func Test_Migration1_CreateVocabs(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 1)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasTable("vocabs"))
+	require.False(t, db.Migrator().HasTable("reviews"))
+	require.Nil(t, db.Create(&vocabV1{Term: "foo", Translation: "bar"}).Error)
+}
+
+func Test_Migration2_CreateReviews(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 2)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasTable("reviews"))
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_vocab_id"))
+}
+
+func Test_Migration3_AddUsers(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 2)
+	require.Nil(t, err)
+	require.Nil(t, db.Create(&vocabV1{Term: "foo", Translation: "bar"}).Error)
+
+	_, err = migrateUp(db, 3)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasTable("users"))
+	require.True(t, db.Migrator().HasTable("sessions"))
+	require.True(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_user_id"))
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_user_id"))
+
+	// Existing vocab is in the local collection.
+	var userID uint
+	require.Nil(t, db.Table("vocabs").Select("user_id").Scan(&userID).Error)
+	require.Equal(t, uint(noUser), userID)
+
+	_, err = migrateDown(db, 2)
+	require.Nil(t, err)
+	require.False(t, db.Migrator().HasColumn(&vocabV3{}, "user_id"))
+	vocab := vocabV1{}
+	require.Nil(t, db.First(&vocab).Error)
+	require.Equal(t, "foo", vocab.Term)
+}
+
+func Test_Migration4_CreateApiTokens(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 4)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasTable("api_tokens"))
+	require.True(t, db.Migrator().HasIndex("api_tokens", "idx_api_tokens_token_hash"))
+}
+
+func Test_Migration5_AddSync(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 4)
+	require.Nil(t, err)
+	for _, term := range []string{"foo1", "foo2"} {
+		require.Nil(t, db.Create(&vocabV1{Term: term, Translation: "bar"}).Error)
+	}
+	review := reviewV2{VocabID: 1, Passed: true}
+	require.Nil(t, db.Create(&review).Error)
+
+	_, err = migrateUp(db, 5)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasTable("tombstones"))
+	require.True(t, db.Migrator().HasTable("sync_states"))
+	require.True(t, db.Migrator().HasTable("sync_peers"))
+	require.True(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_sync_id"))
+
+	// Existing vocab and reviews get sync IDs, and vocab its change times.
+	vocabs := make([]Vocab, 0)
+	require.Nil(t, db.Unscoped().Order("id").Find(&vocabs).Error)
+	require.Len(t, vocabs[0].SyncID, 32)
+	require.NotEqual(t, vocabs[0].SyncID, vocabs[1].SyncID)
+	require.True(t, vocabs[0].EditedAt.Equal(vocabs[0].CreatedAt))
+	require.True(t, vocabs[0].UpdatedAt.Equal(vocabs[0].CreatedAt))
+	require.True(t, vocabs[0].ReviewedAt.Equal(review.CreatedAt))
+	require.Nil(t, vocabs[1].ReviewedAt)
+	var reviewSyncID string
+	require.Nil(t, db.Table("reviews").Select("sync_id").Scan(&reviewSyncID).Error)
+	require.Len(t, reviewSyncID, 32)
+
+	_, err = migrateDown(db, 4)
+	require.Nil(t, err)
+	require.False(t, db.Migrator().HasTable("tombstones"))
+	require.False(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_sync_id"))
+	require.True(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_user_id"))
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_vocab_id"))
+}
+
+func Test_Migration6_AddSyncPeerCursors(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 5)
+	require.Nil(t, err)
+	require.Nil(t, db.Create(&syncPeerV5{DeviceID: "laptop", Lines: 3}).Error)
+
+	_, err = migrateUp(db, 6)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasIndex("sync_peers", "idx_sync_peers_url"))
+	peer := SyncPeer{}
+	require.Nil(t, db.First(&peer).Error)
+	require.Equal(t, "laptop", peer.DeviceID)
+	require.Equal(t, "", peer.URL)
+
+	_, err = migrateDown(db, 5)
+	require.Nil(t, err)
+	require.False(t, db.Migrator().HasColumn(&syncPeerV6{}, "URL"))
+	require.True(t, db.Migrator().HasIndex("sync_peers", "idx_sync_peers_device_id"))
+}
+
+func Test_Migration7_AddTrash(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 7)
+	require.Nil(t, err)
+	require.True(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_deleted_at"))
+	store := NewGormStore(db)
+	for _, term := range []string{"foo1", "foo2"} {
+		_, err = store.CreateVocab(term, "bar")
+		require.Nil(t, err)
+	}
+	require.Nil(t, db.Exec("update vocabs set deleted_at = ? where id = 1", time.Now()).Error)
+
+	// Vocab in the trash is deleted for good.
+	_, err = migrateDown(db, 6)
+	require.Nil(t, err)
+	require.False(t, db.Migrator().HasColumn(&vocabV7{}, "DeletedAt"))
+	require.True(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_user_id"))
+	require.True(t, db.Migrator().HasIndex("vocabs", "idx_vocabs_sync_id"))
+	var terms []string
+	require.Nil(t, db.Table("vocabs").Pluck("term", &terms).Error)
+	require.Equal(t, []string{"foo2"}, terms)
+}
+
+func Test_Migration8_AddReviewBatches(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 7)
+	require.Nil(t, err)
+	require.Nil(t, db.Create(&reviewV2{VocabID: 1, Passed: true}).Error)
+
+	_, err = migrateUp(db, 8)
+	require.Nil(t, err)
+
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_batch"))
+	// Existing reviews can't be undone.
+	review := Review{}
+	require.Nil(t, db.First(&review).Error)
+	require.Equal(t, "", review.Batch)
+	require.Nil(t, review.PreviousPracticeAt)
+
+	_, err = migrateDown(db, 7)
+	require.Nil(t, err)
+	require.False(t, db.Migrator().HasColumn(&reviewV8{}, "Batch"))
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_vocab_id"))
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_user_id"))
+	require.True(t, db.Migrator().HasIndex("reviews", "idx_reviews_sync_id"))
+}
+
+func Test_Migration9_AddTombstoneTypes(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 8)
+	require.Nil(t, err)
+	require.Nil(t, db.Create(&tombstoneV5{SyncID: "abc", DeletedAt: time.Now()}).Error)
+
+	_, err = migrateUp(db, 9)
+	require.Nil(t, err)
+
+	// Existing tombstones are of deleted vocab.
+	tombstone := Tombstone{}
+	require.Nil(t, db.First(&tombstone).Error)
+	require.Equal(t, changeDelete, tombstone.Type)
+
+	// Undone reviews are forgotten.
+	require.Nil(t, db.Create(&Tombstone{SyncID: "def", Type: changeUndo, DeletedAt: time.Now()}).Error)
+	_, err = migrateDown(db, 8)
+	require.Nil(t, err)
+	require.False(t, db.Migrator().HasColumn(&tombstoneV9{}, "Type"))
+	var count int64
+	require.Nil(t, db.Model(&tombstoneV5{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+	require.True(t, db.Migrator().HasIndex("tombstones", "idx_tombstones_user_id"))
+	require.True(t, db.Migrator().HasIndex("tombstones", "idx_tombstones_sync_id"))
+}
+
+// Databases created with AutoMigrate, before versioned migrations, are adopted
+// without losing data.
+func Test_Migrate_AutoMigratedDb(t *testing.T) {
+	db := emptyDb(t)
+	require.Nil(t, db.AutoMigrate(&Vocab{}, &Review{}))
+	_, err := NewGormStore(db).CreateVocab("foo", "bar")
+	require.Nil(t, err)
+
+	_, err = migrateUp(db, latestVersion())
+	require.Nil(t, err)
+	requireVersion(t, db, latestVersion())
+
+	var count int64
+	require.Nil(t, db.Model(&Vocab{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+func Test_MigrationStatus(t *testing.T) {
+	db := emptyDb(t)
+	_, err := migrateUp(db, 1)
+	require.Nil(t, err)
+
+	states, err := migrationStatus(db)
+	require.Nil(t, err)
+	require.Len(t, states, len(migrations))
+	require.NotNil(t, states[0].AppliedAt)
+	require.Nil(t, states[1].AppliedAt)
+}
+
+func Test_BackupBeforeMigrate(t *testing.T) {
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "vocab.db")))
+	require.Nil(t, err)
+
+	path, err := backupBeforeMigrate(db, filepath.Join(dir, "backups"))
+	require.Nil(t, err)
+	require.Equal(t, "", path)
+
+	_, err = migrateUp(db, 1)
+	require.Nil(t, err)
+	require.Nil(t, db.Create(&vocabV1{Term: "foo", Translation: "bar"}).Error)
+
+	path, err = backupBeforeMigrate(db, filepath.Join(dir, "backups"))
+	require.Nil(t, err)
+	require.Regexp(t, `vocab-\d{8}-\d{6}-v1\.db$`, path)
+
+	backup, err := gorm.Open(sqlite.Open(path))
+	require.Nil(t, err)
+	requireVersion(t, backup, 1)
+	vocab := vocabV1{}
+	require.Nil(t, backup.First(&vocab).Error)
+	require.Equal(t, "foo", vocab.Term)
+}
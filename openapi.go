@@ -0,0 +1,18 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openApiSpec describes the API. Test_OpenApi_MatchesRouter checks it has
+// the same routes as the router, so update it along with NewServer.
+//
+//go:embed openapi.json
+var openApiSpec []byte
+
+func getOpenApi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(openApiSpec)
+	check(err)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/peter554/vocab/client"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var pathVariableRe = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+func Test_OpenApi_MatchesRouter(t *testing.T) {
+	config := DefaultConfig()
+	// All routes are registered with accounts on.
+	config.Accounts = true
+	server := NewServer(memoryDb(t), config)
+
+	routes := make([]string, 0)
+	err := server.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Not an endpoint, e.g. a subrouter or a fallback.
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		require.Nil(t, err)
+		path = strings.TrimPrefix(pathVariableRe.ReplaceAllString(path, "{$1}"), "/api")
+		for _, method := range methods {
+			routes = append(routes, strings.ToLower(method)+" "+path)
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	sort.Strings(routes)
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err = json.Unmarshal(openApiSpec, &spec)
+	require.Nil(t, err)
+	specRoutes := make([]string, 0)
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			specRoutes = append(specRoutes, method+" "+path)
+		}
+	}
+	sort.Strings(specRoutes)
+
+	require.Equal(t, routes, specRoutes)
+}
+
+func Test_OpenApi_Refs(t *testing.T) {
+	var spec map[string]interface{}
+	err := json.Unmarshal(openApiSpec, &spec)
+	require.Nil(t, err)
+
+	refRe := regexp.MustCompile(`"\$ref":\s*"#/components/(\w+)/(\w+)"`)
+	components := spec["components"].(map[string]interface{})
+	for _, match := range refRe.FindAllStringSubmatch(string(openApiSpec), -1) {
+		kind, ok := components[match[1]].(map[string]interface{})
+		require.True(t, ok, match[0])
+		_, ok = kind[match[2]]
+		require.True(t, ok, match[0])
+	}
+}
+
+func Test_GetOpenApi(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireToken = true
+	server := NewServer(memoryDb(t), config)
+
+	req, _ := http.NewRequest("GET", "/api/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	require.Equal(t, openApiSpec, rr.Body.Bytes())
+}
+
+func Test_Client(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		ts := httptest.NewServer(NewServer(db, DefaultConfig()))
+		defer ts.Close()
+		c := client.New(ts.URL, "")
+
+		session, err := c.Session()
+		require.Nil(t, err)
+		require.Equal(t, &client.Session{}, session)
+
+		id, err := c.CreateVocab("hund", "dog")
+		require.Nil(t, err)
+		_, err = c.CreateVocab("katze", "cat")
+		require.Nil(t, err)
+
+		page, err := c.ListVocab(client.VocabQuery{Term: "hu"})
+		require.Nil(t, err)
+		require.Equal(t, int64(1), page.Count)
+		require.Equal(t, "hund", page.Items[0].Term)
+		require.Equal(t, id, page.Items[0].ID)
+
+		count, err := c.CountDueVocab()
+		require.Nil(t, err)
+		require.Equal(t, int64(2), count)
+
+		due, err := c.DueVocab()
+		require.Nil(t, err)
+		require.Len(t, due, 2)
+
+		practiced, err := c.Practice([]client.PracticeResult{{ID: id, Passed: true}})
+		require.Nil(t, err)
+		require.Equal(t, uint(1), practiced[0].KnowledgeLevel)
+
+		updated, err := c.UpdateVocab(id, "der hund", "the dog")
+		require.Nil(t, err)
+		require.Equal(t, "der hund", updated.Term)
+		require.Equal(t, uint(1), updated.KnowledgeLevel)
+
+		stats, err := c.Stats()
+		require.Nil(t, err)
+		require.Equal(t, int64(2), stats.Total)
+		require.Equal(t, int64(1), stats.Last7Days.Passed)
+
+		text := client.TextImport{Text: "maus,mouse;vogel,bird", TermSeparator: ",", CardSeparator: ";"}
+		pairs, err := c.PreviewText(text)
+		require.Nil(t, err)
+		require.Equal(t, []client.TextPair{{Term: "maus", Translation: "mouse"}, {Term: "vogel", Translation: "bird"}}, pairs)
+		imported, err := c.ImportText(text)
+		require.Nil(t, err)
+		require.Equal(t, 2, imported)
+
+		var b bytes.Buffer
+		err = c.Export(&b, client.ExportQuery{Format: "md", GroupBy: "letter"})
+		require.Nil(t, err)
+		require.Contains(t, b.String(), "| maus | mouse |")
+
+		b.Reset()
+		err = c.Export(&b, client.ExportQuery{})
+		require.Nil(t, err)
+		imported, err = c.ImportCsv(&b)
+		require.Nil(t, err)
+		require.Equal(t, 4, imported)
+
+		err = c.DeleteVocab(id)
+		require.Nil(t, err)
+		err = c.DeleteVocab(id)
+		require.Equal(t, &client.Error{StatusCode: 404, Code: "not_found", Message: "vocab not found"}, err)
+
+		_, err = c.CreateVocab("hund", "")
+		require.Equal(t, &client.Error{StatusCode: 422, Code: "invalid", Message: "translation is required", Field: "translation"}, err)
+	})
+}
+
+func Test_Client_Accounts(t *testing.T) {
+	config := DefaultConfig()
+	config.Accounts = true
+	db := memoryDb(t)
+	ts := httptest.NewServer(NewServer(db, config))
+	defer ts.Close()
+	c := client.New(ts.URL, "")
+
+	_, err := c.ListVocab(client.VocabQuery{})
+	require.Equal(t, &client.Error{StatusCode: 401, Code: "unauthorized", Message: "not logged in"}, err)
+
+	user, err := c.Register("alice", "password1")
+	require.Nil(t, err)
+	require.Equal(t, "alice", user.Username)
+	_, err = c.CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	err = c.Logout()
+	require.Nil(t, err)
+	session, err := c.Session()
+	require.Nil(t, err)
+	require.Nil(t, session.User)
+
+	_, err = c.Login("alice", "password1")
+	require.Nil(t, err)
+	page, err := c.ListVocab(client.VocabQuery{})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), page.Count)
+
+	token, _, err := createApiToken(db, user.ID, "")
+	require.Nil(t, err)
+	err = c.CheckToken(token)
+	require.Nil(t, err)
+	page, err = client.New(ts.URL, token).ListVocab(client.VocabQuery{})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), page.Count)
+}
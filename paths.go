@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Location is where the app keeps its files. Each profile has its own
+// directory, holding its database and settings, under the app home. The
+// default profile uses the app home itself.
+type Location struct {
+	// Home is $VOCAB_HOME, or ~/.vocab.
+	Home string
+	// Profile is the profile name, or "" for the default profile.
+	Profile string
+	// Dir is the directory of the profile's files.
+	Dir string
+	// DB is the path of the profile's database, unless overridden by the -db
+	// flag or, without the -profile flag, $VOCAB_DB.
+	DB string
+	// DSN, from the -dsn flag or, without the -profile flag, $VOCAB_DSN, is
+	// a PostgreSQL connection string. If set, it is used instead of DB.
+	DSN string
+}
+
+var profileNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// resolveLocation works out the location from the global flags and the
+// environment. Flags take precedence over the environment, so the -profile
+// flag opens the profile's database even if $VOCAB_DB or $VOCAB_DSN is set.
+func resolveLocation(dbFlag, profileFlag, dsnFlag string, getenv func(string) string, homeDir func() (string, error)) (*Location, error) {
+	home := getenv("VOCAB_HOME")
+	if home == "" {
+		hd, err := homeDir()
+		if err != nil {
+			return nil, err
+		}
+		home = filepath.Join(hd, ".vocab")
+	}
+
+	profile := profileFlag
+	if profile == "" {
+		profile = getenv("VOCAB_PROFILE")
+	}
+	if profile == "default" {
+		profile = ""
+	}
+	if profile != "" && !profileNameRe.MatchString(profile) {
+		return nil, fmt.Errorf("invalid profile name: %q. use letters, digits, - and _", profile)
+	}
+
+	dir := home
+	if profile != "" {
+		dir = filepath.Join(home, "profiles", profile)
+	}
+
+	db := dbFlag
+	if db == "" && profileFlag == "" {
+		db = getenv("VOCAB_DB")
+	}
+	if db == "" {
+		db = filepath.Join(dir, "vocab.db")
+	}
+
+	dsn := dsnFlag
+	if dsn == "" && profileFlag == "" {
+		dsn = getenv("VOCAB_DSN")
+	}
+	if dsn != "" && dbFlag != "" {
+		return nil, fmt.Errorf("use only one of -db and -dsn")
+	}
+
+	return &Location{
+		Home:    home,
+		Profile: profile,
+		Dir:     dir,
+		DB:      db,
+		DSN:     dsn,
+	}, nil
+}
+
+// ensure creates the profile directory and the directory of the database,
+// if they don't exist.
+func (l *Location) ensure() error {
+	err := os.MkdirAll(l.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Dir(l.DB), 0700)
+}
+
+// configPath returns the path of the profile's config file.
+func (l *Location) configPath() string {
+	return filepath.Join(l.Dir, configFileName)
+}
+
+// backupDir returns the directory of the profile's database backups.
+func (l *Location) backupDir() string {
+	return filepath.Join(l.Dir, "backups")
+}
+
+// profiles lists the named profiles under the app home.
+func (l *Location) profiles() ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(l.Home, "profiles"))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && profileNameRe.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func testHomeDir() (string, error) {
+	return "/home/me", nil
+}
+
+func Test_ResolveLocation(t *testing.T) {
+	cases := []struct {
+		dbFlag      string
+		profileFlag string
+		dsnFlag     string
+		env         map[string]string
+		expected    Location
+	}{
+		{
+			expected: Location{Home: "/home/me/.vocab", Dir: "/home/me/.vocab", DB: "/home/me/.vocab/vocab.db"},
+		},
+		{
+			profileFlag: "work",
+			expected:    Location{Home: "/home/me/.vocab", Profile: "work", Dir: "/home/me/.vocab/profiles/work", DB: "/home/me/.vocab/profiles/work/vocab.db"},
+		},
+		{
+			profileFlag: "default",
+			env:         map[string]string{"VOCAB_PROFILE": "work"},
+			expected:    Location{Home: "/home/me/.vocab", Dir: "/home/me/.vocab", DB: "/home/me/.vocab/vocab.db"},
+		},
+		{
+			env:      map[string]string{"VOCAB_HOME": "/data/vocab", "VOCAB_PROFILE": "work"},
+			expected: Location{Home: "/data/vocab", Profile: "work", Dir: "/data/vocab/profiles/work", DB: "/data/vocab/profiles/work/vocab.db"},
+		},
+		{
+			env:      map[string]string{"VOCAB_DB": "/shared/vocab.db"},
+			expected: Location{Home: "/home/me/.vocab", Dir: "/home/me/.vocab", DB: "/shared/vocab.db"},
+		},
+		{
+			dbFlag:      "/mnt/vocab.db",
+			profileFlag: "home",
+			env:         map[string]string{"VOCAB_DB": "/shared/vocab.db"},
+			expected:    Location{Home: "/home/me/.vocab", Profile: "home", Dir: "/home/me/.vocab/profiles/home", DB: "/mnt/vocab.db"},
+		},
+		// -profile takes precedence over the database of the environment.
+		{
+			profileFlag: "work",
+			env:         map[string]string{"VOCAB_DB": "/shared/vocab.db", "VOCAB_DSN": "postgres://localhost/vocab"},
+			expected:    Location{Home: "/home/me/.vocab", Profile: "work", Dir: "/home/me/.vocab/profiles/work", DB: "/home/me/.vocab/profiles/work/vocab.db"},
+		},
+		{
+			env:      map[string]string{"VOCAB_DSN": "postgres://localhost/vocab"},
+			expected: Location{Home: "/home/me/.vocab", Dir: "/home/me/.vocab", DB: "/home/me/.vocab/vocab.db", DSN: "postgres://localhost/vocab"},
+		},
+		{
+			dsnFlag:  "postgres://db.example.com/team",
+			env:      map[string]string{"VOCAB_DSN": "postgres://localhost/vocab"},
+			expected: Location{Home: "/home/me/.vocab", Dir: "/home/me/.vocab", DB: "/home/me/.vocab/vocab.db", DSN: "postgres://db.example.com/team"},
+		},
+	}
+
+	for _, c := range cases {
+		location, err := resolveLocation(c.dbFlag, c.profileFlag, c.dsnFlag, testEnv(c.env), testHomeDir)
+		require.Nil(t, err)
+		require.Equal(t, c.expected, *location)
+	}
+}
+
+func Test_ResolveLocation_Errors(t *testing.T) {
+	_, err := resolveLocation("", "../work", "", testEnv(nil), testHomeDir)
+	require.NotNil(t, err)
+
+	_, err = resolveLocation("/mnt/vocab.db", "", "postgres://localhost/vocab", testEnv(nil), testHomeDir)
+	require.NotNil(t, err)
+
+	_, err = resolveLocation("", "", "", testEnv(nil), func() (string, error) {
+		return "", errors.New("no home")
+	})
+	require.NotNil(t, err)
+
+	// The home directory isn't needed when $VOCAB_HOME is set.
+	_, err = resolveLocation("", "", "", testEnv(map[string]string{"VOCAB_HOME": "/data"}), func() (string, error) {
+		return "", errors.New("no home")
+	})
+	require.Nil(t, err)
+}
+
+func Test_Location_Profiles(t *testing.T) {
+	home := t.TempDir()
+	env := testEnv(map[string]string{"VOCAB_HOME": home})
+
+	location, err := resolveLocation("", "", "", env, testHomeDir)
+	require.Nil(t, err)
+	profiles, err := location.profiles()
+	require.Nil(t, err)
+	require.Equal(t, []string{}, profiles)
+
+	for _, profile := range []string{"work", "home"} {
+		location, err := resolveLocation("", profile, "", env, testHomeDir)
+		require.Nil(t, err)
+		require.Nil(t, location.ensure())
+	}
+	err = os.WriteFile(filepath.Join(home, "profiles", "notes.txt"), []byte{}, 0600)
+	require.Nil(t, err)
+
+	profiles, err = location.profiles()
+	require.Nil(t, err)
+	require.Equal(t, []string{"home", "work"}, profiles)
+}
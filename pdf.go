@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pdfDocument is a minimal PDF writer, sufficient for pages of text and lines
+// in the standard Helvetica font. Text is encoded as WinAnsi, so characters
+// outside of it are rendered as "?".
+type pdfDocument struct {
+	width  float64
+	height float64
+	pages  []*pdfPage
+}
+
+func newPdfDocument(width, height float64) *pdfDocument {
+	return &pdfDocument{
+		width:  width,
+		height: height,
+	}
+}
+
+func (d *pdfDocument) addPage() *pdfPage {
+	page := &pdfPage{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+func (d *pdfDocument) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	offsets := make([]int, 0)
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-3 are the catalog, page tree and font. Each page is then
+	// written as a page object followed by its content stream.
+	kids := make([]string, 0, len(d.pages))
+	for idx := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*idx))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] >>",
+		strings.Join(kids, " "), len(d.pages), pdfNum(d.width), pdfNum(d.height)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	for idx, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*idx))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		_, err := zw.Write(page.content.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		err = zw.Close()
+		if err != nil {
+			return 0, err
+		}
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream",
+			compressed.Len(), compressed.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+// text draws s with its baseline starting at (x, y), measured in points from
+// the bottom left of the page.
+func (p *pdfPage) text(x, y, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F1 %s Tf %s %s Td (%s) Tj ET\n",
+		pdfNum(size), pdfNum(x), pdfNum(y), pdfEscape(winAnsi(s)))
+}
+
+func (p *pdfPage) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "%s %s m %s %s l S\n", pdfNum(x1), pdfNum(y1), pdfNum(x2), pdfNum(y2))
+}
+
+// stroke sets the grey level, width and dash length used to draw lines. A
+// dash of 0 draws solid lines.
+func (p *pdfPage) stroke(grey, width, dash float64) {
+	if dash > 0 {
+		fmt.Fprintf(&p.content, "%s G %s w [%s] 0 d\n", pdfNum(grey), pdfNum(width), pdfNum(dash))
+	} else {
+		fmt.Fprintf(&p.content, "%s G %s w [] 0 d\n", pdfNum(grey), pdfNum(width))
+	}
+}
+
+func pdfNum(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
+
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// winAnsi encodes s as WinAnsi (Windows-1252), replacing unsupported
+// characters with "?".
+func winAnsi(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r < 0x80 || (r >= 0xa0 && r <= 0xff) {
+			b = append(b, byte(r))
+		} else if c, ok := winAnsiSpecials[r]; ok {
+			b = append(b, c)
+		} else {
+			b = append(b, '?')
+		}
+	}
+	return string(b)
+}
+
+// helveticaWidths are the glyph widths of printable ASCII characters, in
+// thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth approximates the width of s in points when drawn at size.
+func textWidth(s string, size float64) float64 {
+	width := 0
+	for _, c := range []byte(winAnsi(s)) {
+		if c >= 32 && c <= 126 {
+			width += helveticaWidths[c-32]
+		} else {
+			width += 556
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// wrapText breaks s into lines no wider than width, splitting on spaces.
+// Words wider than width are left on a line of their own.
+func wrapText(s string, size, width float64) []string {
+	lines := make([]string, 0)
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && textWidth(candidate, size) > width {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
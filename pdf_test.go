@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PdfDocument_Xref(t *testing.T) {
+	doc := newPdfDocument(pageWidth, pageHeight)
+	doc.addPage().text(10, 20, 12, "hello (world)")
+	doc.addPage().line(0, 0, 10, 10)
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	require.Nil(t, err)
+	data := buf.String()
+
+	require.True(t, strings.HasPrefix(data, "%PDF-1.4\n"))
+	require.True(t, strings.HasSuffix(data, "%%EOF\n"))
+	require.Contains(t, data, "/Count 2")
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(data)
+	require.NotNil(t, startxref)
+	xref, err := strconv.Atoi(startxref[1])
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(data[xref:], "xref\n0 8\n"))
+
+	// Every object offset in the xref table points at the start of that object.
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(data[xref:], -1)
+	require.Len(t, entries, 7)
+	for idx, entry := range entries {
+		offset, err := strconv.Atoi(entry[1])
+		require.Nil(t, err)
+		require.True(t, strings.HasPrefix(data[offset:], strconv.Itoa(idx+1)+" 0 obj\n"))
+	}
+
+	require.Equal(t, []string{"BT /F1 12 Tf 10 20 Td (hello \\(world\\)) Tj ET\n", "0 0 m 10 10 l S\n"}, pdfStreams(t, data))
+}
+
+func Test_WinAnsi(t *testing.T) {
+	require.Equal(t, "caf\xe9 \x80 \x93x\x94 ?", winAnsi("café € “x” 日"))
+}
+
+func Test_WrapText(t *testing.T) {
+	require.Equal(t, []string{"the quick", "brown fox"}, wrapText("the quick brown fox", 10, 50))
+	require.Equal(t, []string{"supercalifragilistic", "word"}, wrapText("supercalifragilistic word", 10, 50))
+	require.Equal(t, []string{}, wrapText("  ", 10, 50))
+}
+
+// pdfStreams returns the decompressed content streams of the PDF, in order.
+func pdfStreams(t *testing.T, data string) []string {
+	streams := make([]string, 0)
+	re := regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+	for _, loc := range re.FindAllStringSubmatchIndex(data, -1) {
+		length, err := strconv.Atoi(data[loc[2]:loc[3]])
+		require.Nil(t, err)
+		require.True(t, strings.HasPrefix(data[loc[1]+length:], "\nendstream"))
+
+		zr, err := zlib.NewReader(strings.NewReader(data[loc[1] : loc[1]+length]))
+		require.Nil(t, err)
+		b, err := ioutil.ReadAll(zr)
+		require.Nil(t, err)
+		streams = append(streams, string(b))
+	}
+	return streams
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peter554/vocab/client"
+	"gorm.io/gorm"
+)
+
+// Peers are vocab servers synced over HTTP rather than through a folder,
+// e.g. vocab start on a laptop and on a computer at home. A device sends the
+// changes made since it last synced with the peer to POST /api/sync, which
+// merges them and responds with the changes of the peer since a cursor. The
+// changes merge the same way as those in a folder, and reviews are added to
+// the history rather than replacing it.
+//
+// Merged vocab counts as changed on the device that merged it, so a peer
+// passes on the changes of the others, e.g. from the laptop to a desktop both
+// syncing with the computer at home. Changes may come back to the device
+// they were made on, where merging them changes nothing.
+
+// syncCursor is how far the changes of a device have been sent: the vocab
+// changed since VocabAt, and the reviews and tombstones after ReviewID and
+// TombstoneID, which grow as they're added, also when merged.
+type syncCursor struct {
+	VocabAt     time.Time
+	ReviewID    uint
+	TombstoneID uint
+}
+
+func (c syncCursor) String() string {
+	var vocabAt int64
+	if !c.VocabAt.IsZero() {
+		vocabAt = c.VocabAt.UnixNano()
+	}
+	return fmt.Sprintf("%d.%d.%d", vocabAt, c.ReviewID, c.TombstoneID)
+}
+
+// parseSyncCursor parses a cursor, "" being the start of the changes.
+func parseSyncCursor(s string) (syncCursor, error) {
+	cursor := syncCursor{}
+	if s == "" {
+		return cursor, nil
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return cursor, fmt.Errorf("bad cursor: %s", s)
+	}
+	vocabAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return cursor, fmt.Errorf("bad cursor: %s", s)
+	}
+	reviewID, err := strconv.ParseUint(parts[1], 10, 0)
+	if err != nil {
+		return cursor, fmt.Errorf("bad cursor: %s", s)
+	}
+	tombstoneID, err := strconv.ParseUint(parts[2], 10, 0)
+	if err != nil {
+		return cursor, fmt.Errorf("bad cursor: %s", s)
+	}
+	if vocabAt != 0 {
+		cursor.VocabAt = time.Unix(0, vocabAt)
+	}
+	cursor.ReviewID = uint(reviewID)
+	cursor.TombstoneID = uint(tombstoneID)
+	return cursor, nil
+}
+
+// currentCursor returns the cursor of the changes so far. It's taken before
+// finding the changes, so a change made meanwhile is sent again rather than
+// missed.
+func currentCursor(db *gorm.DB, userID uint) (syncCursor, error) {
+	cursor := syncCursor{VocabAt: time.Now()}
+	dbResult := forUser(db, userID).Model(&Review{}).Select("coalesce(max(id), 0)").Scan(&cursor.ReviewID)
+	if dbResult.Error != nil {
+		return cursor, dbResult.Error
+	}
+	dbResult = forUser(db, userID).Model(&Tombstone{}).Select("coalesce(max(id), 0)").Scan(&cursor.TombstoneID)
+	return cursor, dbResult.Error
+}
+
+// cursorChanges returns the changes since the cursor.
+func cursorChanges(db *gorm.DB, userID uint, deviceID string, since syncCursor) ([]change, error) {
+	return findChanges(db, userID, deviceID,
+		func(db *gorm.DB) *gorm.DB { return db.Where("updated_at >= ?", since.VocabAt) },
+		func(db *gorm.DB) *gorm.DB { return db.Where("reviews.id > ?", since.ReviewID) },
+		func(db *gorm.DB) *gorm.DB { return db.Where("id > ?", since.TombstoneID) },
+	)
+}
+
+// syncExchange is the response of a peer to the changes sent to it.
+type syncExchange struct {
+	Device string `json:"device"`
+	// Cursor is where to continue from at the next sync.
+	Cursor  string   `json:"cursor"`
+	Merged  int      `json:"merged"`
+	Changes []change `json:"changes"`
+}
+
+// exchangeChanges merges the changes sent by the device of a peer into the
+// collection of the user with the given ID, returning the changes of the
+// collection since the cursor.
+func exchangeChanges(db *gorm.DB, userID uint, peerDeviceID, cursor string, changes []change) (*syncExchange, error) {
+	since, err := parseSyncCursor(cursor)
+	if err != nil {
+		return nil, ErrInvalid{Field: "cursor", Message: "is not a cursor of this server"}
+	}
+	state, err := syncState(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if peerDeviceID == state.DeviceID {
+		return nil, ErrInvalid{Field: "device", Message: "is the device of this server"}
+	}
+
+	exchange := &syncExchange{Device: state.DeviceID}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		next, err := currentCursor(tx, userID)
+		if err != nil {
+			return err
+		}
+		exchange.Cursor = next.String()
+		// Found before merging, so the changes sent aren't sent straight
+		// back.
+		exchange.Changes, err = cursorChanges(tx, userID, state.DeviceID, since)
+		if err != nil {
+			return err
+		}
+		exchange.Merged, err = mergeChanges(tx, userID, changes, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exchange, nil
+}
+
+// syncPeer syncs the collection of the user with the given ID with the
+// collection of the server of c: it sends the changes made since the last
+// sync with the server, and merges the changes of the server.
+func syncPeer(db *gorm.DB, userID uint, c *client.Client) (*SyncResult, error) {
+	state, err := syncState(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	peer := SyncPeer{UserID: userID, URL: c.BaseURL}
+	dbResult := forUser(db, userID).Where("url = ?", c.BaseURL).Limit(1).Find(&peer)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+
+	sent, err := currentCursor(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	since, err := parseSyncCursor(peer.Sent)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := cursorChanges(db, userID, state.DeviceID, since)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Sync(client.SyncRequest{
+		Device:  state.DeviceID,
+		Cursor:  peer.Received,
+		Changes: toClientChanges(changes),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if peer.DeviceID != "" && res.Device != peer.DeviceID {
+		// Another server, or one with another database, so the cursors
+		// are meaningless. Send and receive everything again.
+		dbResult = db.Model(&peer).Updates(map[string]interface{}{"device_id": res.Device, "received": "", "sent": ""})
+		if dbResult.Error != nil {
+			return nil, dbResult.Error
+		}
+		return syncPeer(db, userID, c)
+	}
+
+	result := &SyncResult{DeviceID: state.DeviceID, Peers: 1, Sent: len(changes)}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result.Merged, err = mergeChanges(tx, userID, fromClientChanges(res.Changes), true)
+		if err != nil {
+			return err
+		}
+		peer.DeviceID = res.Device
+		peer.Received = res.Cursor
+		peer.Sent = sent.String()
+		return tx.Save(&peer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func toClientChanges(changes []change) []client.Change {
+	clientChanges := make([]client.Change, 0, len(changes))
+	for _, c := range changes {
+		clientChanges = append(clientChanges, client.Change(c))
+	}
+	return clientChanges
+}
+
+func fromClientChanges(clientChanges []client.Change) []change {
+	changes := make([]change, 0, len(clientChanges))
+	for _, c := range clientChanges {
+		changes = append(changes, change(c))
+	}
+	return changes
+}
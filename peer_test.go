@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peter554/vocab/client"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// peerServer serves the database like vocab start, returning a client of it.
+func peerServer(t *testing.T, db *gorm.DB) *client.Client {
+	ts := httptest.NewServer(NewServer(db, DefaultConfig()))
+	t.Cleanup(ts.Close)
+	return client.New(ts.URL, "")
+}
+
+func requireSyncPeer(t *testing.T, db *gorm.DB, peer *client.Client) *SyncResult {
+	result, err := syncPeer(db, noUser, peer)
+	require.Nil(t, err)
+	return result
+}
+
+func countReviews(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.Nil(t, db.Model(&Review{}).Count(&count).Error)
+	return count
+}
+
+func Test_SyncPeer(t *testing.T) {
+	laptop, desktop := memoryDb(t), memoryDb(t)
+	desktopServer := peerServer(t, desktop)
+	config := DefaultConfig()
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).CreateVocab("katze", "cat")
+	require.Nil(t, err)
+	result := requireSyncPeer(t, laptop, desktopServer)
+	require.Equal(t, 1, result.Peers)
+	require.Equal(t, 1, result.Sent)
+	require.Equal(t, 1, result.Merged)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+
+	// Both practise hund and the laptop edits it before syncing again.
+	_, err = NewGormStore(laptop).RecordReview(config, findVocab(t, laptop, "hund").ID, false)
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).RecordReview(config, findVocab(t, desktop, "hund").ID, true)
+	require.Nil(t, err)
+	_, err = NewGormStore(laptop).UpdateVocab(findVocab(t, laptop, "hund").ID, "hund", "the dog")
+	require.Nil(t, err)
+
+	requireSyncPeer(t, laptop, desktopServer)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	hund := findVocab(t, desktop, "hund")
+	require.Equal(t, "the dog", hund.Translation)
+	require.Equal(t, uint(1), hund.KnowledgeLevel)
+	// The reviews of both are kept.
+	require.Equal(t, int64(2), countReviews(t, laptop))
+	require.Equal(t, int64(2), countReviews(t, desktop))
+
+	// Changes that came back change nothing.
+	requireSyncPeer(t, laptop, desktopServer)
+	result = requireSyncPeer(t, laptop, desktopServer)
+	require.Equal(t, 0, result.Merged)
+	require.Equal(t, 0, result.Sent)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+}
+
+func Test_SyncPeer_UndoPractice(t *testing.T) {
+	laptop, desktop := memoryDb(t), memoryDb(t)
+	desktopServer := peerServer(t, desktop)
+
+	vocab, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	_, err = NewGormStore(laptop).RecordReview(DefaultConfig(), vocab.ID, true)
+	require.Nil(t, err)
+	requireSyncPeer(t, laptop, desktopServer)
+	require.Equal(t, int64(1), countReviews(t, desktop))
+
+	_, err = NewGormStore(laptop).UndoPractice()
+	require.Nil(t, err)
+	requireSyncPeer(t, laptop, desktopServer)
+	requireSyncPeer(t, laptop, desktopServer)
+
+	require.Equal(t, int64(0), countReviews(t, laptop))
+	require.Equal(t, int64(0), countReviews(t, desktop))
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+}
+
+// Changes are passed on between devices syncing with the same peer.
+func Test_SyncPeer_Relay(t *testing.T) {
+	laptop, desktop, home := memoryDb(t), memoryDb(t), memoryDb(t)
+	homeServer := peerServer(t, home)
+	config := DefaultConfig()
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSyncPeer(t, laptop, homeServer)
+	requireSyncPeer(t, desktop, homeServer)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+
+	_, err = NewGormStore(desktop).RecordReview(config, findVocab(t, desktop, "hund").ID, true)
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).CreateVocab("katze", "cat")
+	require.Nil(t, err)
+	requireSyncPeer(t, desktop, homeServer)
+	requireSyncPeer(t, laptop, homeServer)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Equal(t, int64(1), countReviews(t, laptop))
+
+	found, err := NewGormStore(laptop).DeleteVocab(findVocab(t, laptop, "hund").ID)
+	require.Nil(t, err)
+	require.True(t, found)
+	requireSyncPeer(t, laptop, homeServer)
+	requireSyncPeer(t, desktop, homeServer)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Equal(t, vocabState(t, home), vocabState(t, desktop))
+	require.Len(t, vocabState(t, desktop), 1)
+}
+
+// If the peer has another database, e.g. it was set up again, the cursors
+// are dropped and everything is synced again.
+func Test_SyncPeer_NewDatabase(t *testing.T) {
+	laptop := memoryDb(t)
+	var handler http.Handler = NewServer(memoryDb(t), DefaultConfig())
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	peer := client.New(ts.URL, "")
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSyncPeer(t, laptop, peer)
+	requireSyncPeer(t, laptop, peer)
+
+	db := memoryDb(t)
+	handler = NewServer(db, DefaultConfig())
+	result := requireSyncPeer(t, laptop, peer)
+	require.Equal(t, 1, result.Sent)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, db))
+}
+
+func Test_SyncPeer_Itself(t *testing.T) {
+	db := memoryDb(t)
+	_, err := syncPeer(db, noUser, peerServer(t, db))
+	require.Equal(t, "device is the device of this server", err.Error())
+}
+
+func Test_SyncCursor(t *testing.T) {
+	cursor := syncCursor{VocabAt: time.Now(), ReviewID: 3, TombstoneID: 7}
+	parsed, err := parseSyncCursor(cursor.String())
+	require.Nil(t, err)
+	require.True(t, cursor.VocabAt.Equal(parsed.VocabAt))
+	require.Equal(t, cursor.ReviewID, parsed.ReviewID)
+	require.Equal(t, cursor.TombstoneID, parsed.TombstoneID)
+
+	parsed, err = parseSyncCursor("")
+	require.Nil(t, err)
+	require.Equal(t, syncCursor{}, parsed)
+	parsed, err = parseSyncCursor(syncCursor{}.String())
+	require.Nil(t, err)
+	require.Equal(t, syncCursor{}, parsed)
+
+	for _, s := range []string{"1.2", "a.2.3", "1.-2.3"} {
+		_, err = parseSyncCursor(s)
+		require.NotNil(t, err, s)
+	}
+}
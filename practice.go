@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// practiceSession runs a practice session in the terminal. Each term is shown
+// and the translation revealed when any key is pressed, after which the answer
+// is marked as passed or failed. The answers are recorded together when the
+// session ends, or is quit, so that undoing practice undoes the session.
+type practiceSession struct {
+	store  Store
+	config *Config
+	in     *bufio.Reader
+	out    io.Writer
+	// fd is the terminal keys are read from one at a time, or -1 if the
+	// input isn't a terminal, in which case they are read a line at a time.
+	fd int
+}
+
+func newPracticeSession(store Store, config *Config, in io.Reader, out io.Writer) *practiceSession {
+	fd := -1
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return &practiceSession{
+		store:  store,
+		config: config,
+		in:     bufio.NewReader(in),
+		out:    out,
+		fd:     fd,
+	}
+}
+
+type practiceResult struct {
+	Vocab  Vocab
+	Passed bool
+	// KnowledgeLevel is the knowledge level before the practice.
+	KnowledgeLevel uint
+}
+
+func (s *practiceSession) run(limit int) ([]practiceResult, error) {
+	vocabs, err := s.store.DueVocab(limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(vocabs) == 0 {
+		fmt.Fprintln(s.out, "nothing to practice")
+		return nil, nil
+	}
+
+	answers := make([]Answer, 0, len(vocabs))
+	// The answers given before an error are still recorded.
+	var readErr error
+	for idx, vocab := range vocabs {
+		fmt.Fprintf(s.out, "\n[%d/%d] %s (knowledge: %d)\n", idx+1, len(vocabs), vocab.Term, vocab.KnowledgeLevel)
+		fmt.Fprint(s.out, "press any key to reveal, q to quit ")
+		var answer string
+		answer, readErr = s.readKey()
+		if readErr != nil || answer == "q" {
+			break
+		}
+
+		fmt.Fprintf(s.out, "  -> %s\n", vocab.Translation)
+		var passed, quit bool
+		passed, quit, readErr = s.askPassed()
+		if readErr != nil || quit {
+			break
+		}
+		answers = append(answers, Answer{VocabID: vocab.ID, Passed: passed})
+	}
+
+	results := make([]practiceResult, 0, len(answers))
+	if len(answers) > 0 {
+		updated, err := s.store.RecordReviews(s.config, answers)
+		if err != nil {
+			return nil, err
+		}
+		for idx, answer := range answers {
+			results = append(results, practiceResult{
+				Vocab:          updated[idx],
+				Passed:         answer.Passed,
+				KnowledgeLevel: vocabs[idx].KnowledgeLevel,
+			})
+		}
+	}
+	if readErr != nil {
+		return results, readErr
+	}
+
+	s.summary(results)
+	return results, nil
+}
+
+func (s *practiceSession) askPassed() (passed bool, quit bool, err error) {
+	for {
+		fmt.Fprint(s.out, "correct? [y/n/q] ")
+		answer, err := s.readKey()
+		if err != nil {
+			return false, false, err
+		}
+		switch answer {
+		case "y", "yes":
+			return true, false, nil
+		case "n", "no":
+			return false, false, nil
+		case "q":
+			return false, true, nil
+		}
+	}
+}
+
+// readKey reads the key pressed, lower case, without waiting for enter. Ctrl-C
+// and ctrl-D are treated as quitting. If the input isn't a terminal a line is
+// read instead.
+func (s *practiceSession) readKey() (string, error) {
+	if s.fd < 0 {
+		return s.readLine()
+	}
+	state, err := term.MakeRaw(s.fd)
+	if err != nil {
+		return "", err
+	}
+	b, err := s.in.ReadByte()
+	// Drop the rest of keys that send a sequence, such as the arrow keys.
+	s.in.Discard(s.in.Buffered())
+	term.Restore(s.fd, state)
+	if err == io.EOF {
+		return "q", nil
+	} else if err != nil {
+		return "", err
+	}
+	// The key isn't echoed in raw mode.
+	fmt.Fprintln(s.out)
+	switch b {
+	case 3, 4:
+		return "q", nil
+	}
+	return strings.ToLower(string(b)), nil
+}
+
+// readLine reads a trimmed, lower case line. Reaching the end of the input
+// is treated as quitting.
+func (s *practiceSession) readLine() (string, error) {
+	line, err := s.in.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "q", nil
+		}
+	} else if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(line)), nil
+}
+
+func (s *practiceSession) summary(results []practiceResult) {
+	if len(results) == 0 {
+		return
+	}
+	passed := 0
+	for _, result := range results {
+		if result.Passed {
+			passed++
+		}
+	}
+	fmt.Fprintf(s.out, "\nyou got %d out of %d correct!\n\n", passed, len(results))
+	for _, result := range results {
+		mark := "x"
+		if result.Passed {
+			mark = "✓"
+		}
+		fmt.Fprintf(s.out, "  %s %s: knowledge %d -> %d, practice next in %d days\n",
+			mark, result.Vocab.Term, result.KnowledgeLevel, result.Vocab.KnowledgeLevel, daysUntil(result.Vocab.PracticeAt))
+	}
+}
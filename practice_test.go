@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PracticeSession(t *testing.T) {
+	db := memoryDb(t)
+
+	for _, vocab := range []Vocab{
+		{Term: "foo1", Translation: "bar1", KnowledgeLevel: 2, PracticeAt: inDays(0)},
+		{Term: "foo2", Translation: "bar2", KnowledgeLevel: 1, PracticeAt: inDays(1)},
+		{Term: "foo3", Translation: "bar3", KnowledgeLevel: 4, PracticeAt: inDays(-1)},
+	} {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+
+	in := strings.NewReader("\ny\n\nmaybe\nn\n")
+	var out bytes.Buffer
+	results, err := newPracticeSession(NewGormStore(db), DefaultConfig(), in, &out).run(10)
+	require.Nil(t, err)
+
+	require.Len(t, results, 2)
+	require.Equal(t, "foo3", results[0].Vocab.Term)
+	require.True(t, results[0].Passed)
+	require.Equal(t, "foo1", results[1].Vocab.Term)
+	require.False(t, results[1].Passed)
+
+	var v Vocab
+	dbResult := db.First(&v, 3)
+	require.Nil(t, dbResult.Error)
+	require.Equal(t, uint(5), v.KnowledgeLevel)
+	require.True(t, v.PracticeAt.Equal(inDays(16)))
+
+	v = Vocab{}
+	dbResult = db.First(&v, 1)
+	require.Nil(t, dbResult.Error)
+	require.Equal(t, uint(1), v.KnowledgeLevel)
+	require.True(t, v.PracticeAt.Equal(inDays(1)))
+
+	output := out.String()
+	require.Contains(t, output, "[1/2] foo3 (knowledge: 4)")
+	require.Contains(t, output, "-> bar3")
+	require.Contains(t, output, "you got 1 out of 2 correct!")
+	require.Contains(t, output, "foo3: knowledge 4 -> 5, practice next in 16 days")
+	require.Contains(t, output, "foo1: knowledge 2 -> 1, practice next in 1 days")
+
+	// The session is undone as a whole.
+	vocabs, err := NewGormStore(db).UndoPractice()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 2)
+}
+
+func Test_PracticeSession_Quit(t *testing.T) {
+	db := memoryDb(t)
+
+	for _, vocab := range []Vocab{
+		{Term: "foo1", Translation: "bar1", KnowledgeLevel: 2, PracticeAt: inDays(-2)},
+		{Term: "foo2", Translation: "bar2", KnowledgeLevel: 1, PracticeAt: inDays(-1)},
+	} {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+
+	in := strings.NewReader("\ny\nq\n")
+	var out bytes.Buffer
+	results, err := newPracticeSession(NewGormStore(db), DefaultConfig(), in, &out).run(10)
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+
+	var v Vocab
+	dbResult := db.First(&v, 2)
+	require.Nil(t, dbResult.Error)
+	require.Equal(t, uint(1), v.KnowledgeLevel)
+	require.True(t, v.PracticeAt.Equal(inDays(-1)))
+}
+
+func Test_PracticeSession_NothingToPractice(t *testing.T) {
+	db := memoryDb(t)
+
+	var out bytes.Buffer
+	results, err := newPracticeSession(NewGormStore(db), DefaultConfig(), strings.NewReader(""), &out).run(10)
+	require.Nil(t, err)
+	require.Len(t, results, 0)
+	require.Equal(t, "nothing to practice\n", out.String())
+}
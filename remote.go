@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/peter554/vocab/client"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRemote    = errors.New("not supported with -server")
+	ErrLocalOnly = errors.New("this command only works on a database, not with -server")
+)
+
+// remoteStore is a Store of the collection on a vocab server, which the CLI
+// works on with -server. The API has no transactions, so AddVocab and
+// DeleteAllVocab aren't supported; imports use the import endpoints instead.
+type remoteStore struct {
+	client *client.Client
+}
+
+func NewRemoteStore(c *client.Client) Store {
+	return &remoteStore{client: c}
+}
+
+// FindVocab returns a page of vocab. The server takes at most its own
+// max_page_size, rather than maxTake.
+func (s *remoteStore) FindVocab(vq VocabQuery, maxTake int) ([]Vocab, int64, error) {
+	page, err := s.client.ListVocab(client.VocabQuery{
+		Term:        vq.Term,
+		Translation: vq.Translation,
+		Mode:        vq.Mode,
+		OrderBy:     vq.OrderBy,
+		Skip:        vq.Skip,
+		Take:        min(vq.Take, maxTake),
+	})
+	if err != nil {
+		return nil, 0, remoteError(err)
+	}
+	return fromRemote(page.Items), page.Count, nil
+}
+
+// AllVocab returns all vocab, a page at a time.
+func (s *remoteStore) AllVocab() ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	for {
+		page, err := s.client.ListVocab(client.VocabQuery{Skip: len(vocabs), Take: 1000})
+		if err != nil {
+			return nil, remoteError(err)
+		}
+		vocabs = append(vocabs, fromRemote(page.Items)...)
+		if len(page.Items) == 0 || int64(len(vocabs)) >= page.Count {
+			return vocabs, nil
+		}
+	}
+}
+
+// KnowledgeVocab filters all vocab, as the API can't filter by knowledge
+// level.
+func (s *remoteStore) KnowledgeVocab(minLevel, maxLevel uint) ([]Vocab, error) {
+	all, err := s.AllVocab()
+	if err != nil {
+		return nil, err
+	}
+	vocabs := make([]Vocab, 0, len(all))
+	for _, vocab := range all {
+		if vocab.KnowledgeLevel >= minLevel && vocab.KnowledgeLevel <= maxLevel {
+			vocabs = append(vocabs, vocab)
+		}
+	}
+	return vocabs, nil
+}
+
+func (s *remoteStore) CreateVocab(term, translation string) (*Vocab, error) {
+	id, err := s.client.CreateVocab(term, translation)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return &Vocab{
+		ID:          id,
+		Term:        term,
+		Translation: translation,
+		PracticeAt:  inDays(0),
+	}, nil
+}
+
+func (s *remoteStore) AddVocab(vocabs []Vocab) error {
+	return ErrRemote
+}
+
+func (s *remoteStore) UpdateVocab(id uint, term, translation string) (*Vocab, error) {
+	vocab, err := s.client.UpdateVocab(id, term, translation)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return &fromRemote([]client.Vocab{*vocab})[0], nil
+}
+
+func (s *remoteStore) DeleteVocab(id uint) (bool, error) {
+	err := s.client.DeleteVocab(id)
+	if errors.Is(remoteError(err), ErrVocabNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, remoteError(err)
+	}
+	return true, nil
+}
+
+func (s *remoteStore) DeleteAllVocab() error {
+	return ErrRemote
+}
+
+func (s *remoteStore) TrashedVocab() ([]Vocab, error) {
+	trashed, err := s.client.Trash()
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	vocabs := make([]Vocab, 0, len(trashed))
+	for _, v := range trashed {
+		vocab := fromRemote([]client.Vocab{v.Vocab})[0]
+		vocab.DeletedAt = gorm.DeletedAt{Time: v.DeletedAt, Valid: true}
+		vocabs = append(vocabs, vocab)
+	}
+	return vocabs, nil
+}
+
+func (s *remoteStore) RestoreVocab(id uint) (*Vocab, error) {
+	vocab, err := s.client.RestoreVocab(id)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return &fromRemote([]client.Vocab{*vocab})[0], nil
+}
+
+// DueVocab returns up to limit vocab due for practice. The server returns at
+// most its own session_size.
+func (s *remoteStore) DueVocab(limit int) ([]Vocab, error) {
+	vocabs, err := s.client.DueVocab()
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return fromRemote(vocabs[:min(limit, len(vocabs))]), nil
+}
+
+func (s *remoteStore) CountDueVocab() (int64, error) {
+	count, err := s.client.CountDueVocab()
+	return count, remoteError(err)
+}
+
+// RecordReview records the review on the server, which schedules the vocab
+// with its own settings rather than config.
+func (s *remoteStore) RecordReview(config *Config, id uint, passed bool) (*Vocab, error) {
+	vocabs, err := s.client.Practice([]client.PracticeResult{{ID: id, Passed: passed}})
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return &fromRemote(vocabs)[0], nil
+}
+
+// RecordReviews records the answers on the server in one request, which the
+// server batches.
+func (s *remoteStore) RecordReviews(config *Config, answers []Answer) ([]Vocab, error) {
+	results := make([]client.PracticeResult, 0, len(answers))
+	for _, answer := range answers {
+		results = append(results, client.PracticeResult{ID: answer.VocabID, Passed: answer.Passed})
+	}
+	vocabs, err := s.client.Practice(results)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return fromRemote(vocabs), nil
+}
+
+func (s *remoteStore) UndoPractice() ([]Vocab, error) {
+	vocabs, err := s.client.UndoPractice()
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return fromRemote(vocabs), nil
+}
+
+func (s *remoteStore) Stats() (*Stats, error) {
+	stats, err := s.client.Stats()
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return &Stats{
+		Total:           stats.Total,
+		DueToday:        stats.DueToday,
+		DueThisWeek:     stats.DueThisWeek,
+		KnowledgeLevels: stats.KnowledgeLevels,
+		Last7Days:       ReviewStats(stats.Last7Days),
+		Last30Days:      ReviewStats(stats.Last30Days),
+		Streak:          stats.Streak,
+	}, nil
+}
+
+// Transaction runs fn with the store. Changes over the API can't be rolled
+// back, so they're kept even if fn returns an error.
+func (s *remoteStore) Transaction(fn func(tx Store) error) error {
+	return fn(s)
+}
+
+func fromRemote(remoteVocabs []client.Vocab) []Vocab {
+	vocabs := make([]Vocab, 0, len(remoteVocabs))
+	for _, v := range remoteVocabs {
+		vocabs = append(vocabs, Vocab{
+			ID:             v.ID,
+			Term:           v.Term,
+			Translation:    v.Translation,
+			KnowledgeLevel: v.KnowledgeLevel,
+			PracticeAt:     v.PracticeAt,
+		})
+	}
+	return vocabs
+}
+
+// remoteError returns the error matching an error response of the server,
+// so that e.g. a missing vocab is ErrVocabNotFound like with a local Store.
+func remoteError(err error) error {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && apiErr.Message == ErrVocabNotFound.Error() {
+		return ErrVocabNotFound
+	}
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict && apiErr.Message == ErrNothingToUndo.Error() {
+		return ErrNothingToUndo
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peter554/vocab/client"
+	"github.com/stretchr/testify/require"
+)
+
+func newRemoteStore(t *testing.T, config *Config) Store {
+	ts := httptest.NewServer(NewServer(memoryDb(t), config))
+	t.Cleanup(ts.Close)
+	return NewRemoteStore(client.New(ts.URL, ""))
+}
+
+func Test_RemoteStore(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxPageSize = 2
+	store := newRemoteStore(t, config)
+
+	vocab, err := store.CreateVocab("foo1", "bar1")
+	require.Nil(t, err)
+	require.Equal(t, uint(1), vocab.ID)
+	for _, term := range []string{"foo2", "foo3"} {
+		_, err = store.CreateVocab(term, "bar")
+		require.Nil(t, err)
+	}
+
+	vq := NewVocabQuery()
+	vq.Term = "foo1"
+	vocabs, count, err := store.FindVocab(vq, 10)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), count)
+	require.Equal(t, "bar1", vocabs[0].Translation)
+
+	// More than the server's max_page_size.
+	vocabs, err = store.AllVocab()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 3)
+
+	vocabs, err = store.KnowledgeVocab(0, 0)
+	require.Nil(t, err)
+	require.Len(t, vocabs, 3)
+	vocabs, err = store.KnowledgeVocab(1, 7)
+	require.Nil(t, err)
+	require.Len(t, vocabs, 0)
+
+	due, err := store.DueVocab(1)
+	require.Nil(t, err)
+	require.Len(t, due, 1)
+	dueCount, err := store.CountDueVocab()
+	require.Nil(t, err)
+	require.Equal(t, int64(3), dueCount)
+
+	vocab, err = store.RecordReview(config, 1, true)
+	require.Nil(t, err)
+	require.Equal(t, uint(1), vocab.KnowledgeLevel)
+	vocabs, err = store.UndoPractice()
+	require.Nil(t, err)
+	require.Equal(t, uint(0), vocabs[0].KnowledgeLevel)
+	_, err = store.UndoPractice()
+	require.Equal(t, ErrNothingToUndo, err)
+	// The answers of a session are undone together.
+	vocabs, err = store.RecordReviews(config, []Answer{{VocabID: 2, Passed: true}, {VocabID: 3, Passed: true}})
+	require.Nil(t, err)
+	require.Equal(t, "foo3", vocabs[1].Term)
+	vocabs, err = store.UndoPractice()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 2)
+	_, err = store.RecordReview(config, 1, true)
+	require.Nil(t, err)
+
+	vocab, err = store.UpdateVocab(1, "foo", "bar")
+	require.Nil(t, err)
+	require.Equal(t, "foo", vocab.Term)
+	require.Equal(t, uint(1), vocab.KnowledgeLevel)
+
+	found, err := store.DeleteVocab(1)
+	require.Nil(t, err)
+	require.True(t, found)
+	found, err = store.DeleteVocab(1)
+	require.Nil(t, err)
+	require.False(t, found)
+
+	_, err = store.UpdateVocab(1, "foo", "bar")
+	require.Equal(t, ErrVocabNotFound, err)
+	_, err = store.RecordReview(config, 1, true)
+	require.Equal(t, ErrVocabNotFound, err)
+
+	trashed, err := store.TrashedVocab()
+	require.Nil(t, err)
+	require.Len(t, trashed, 1)
+	require.Equal(t, "foo", trashed[0].Term)
+	require.True(t, trashed[0].DeletedAt.Valid)
+	vocab, err = store.RestoreVocab(1)
+	require.Nil(t, err)
+	require.Equal(t, "foo", vocab.Term)
+	_, err = store.RestoreVocab(1)
+	require.Equal(t, ErrVocabNotFound, err)
+
+	require.Equal(t, ErrRemote, store.AddVocab([]Vocab{{Term: "foo", Translation: "bar"}}))
+	require.Equal(t, ErrRemote, store.DeleteAllVocab())
+}
+
+func Test_RemoteStore_Errors(t *testing.T) {
+	config := DefaultConfig()
+	config.RequireToken = true
+	store := newRemoteStore(t, config)
+
+	_, err := store.CreateVocab("foo", "bar")
+	require.Equal(t, &client.Error{StatusCode: 401, Code: "unauthorized", Message: "API token required"}, err)
+}
+
+func Test_RemoteStats(t *testing.T) {
+	db := memoryDb(t)
+	ts := httptest.NewServer(NewServer(db, DefaultConfig()))
+	defer ts.Close()
+	store := NewGormStore(db)
+	_, err := store.CreateVocab("foo", "bar")
+	require.Nil(t, err)
+	_, err = store.RecordReview(DefaultConfig(), 1, true)
+	require.Nil(t, err)
+
+	stats, err := NewRemoteStore(client.New(ts.URL, "")).Stats()
+	require.Nil(t, err)
+	expected, err := store.Stats()
+	require.Nil(t, err)
+	require.Equal(t, expected, stats)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+var maxKnowledge uint = 7
+
+// schedule updates the vocab after it has been practised.
+// Passed vocab should be skilled up and scheduled for practice according to the
+// configured interval for the new level.
+// Failed vocab should be skilled down and scheduled for practice tomorrow.
+func schedule(config *Config, vocab *Vocab, passed bool) {
+	if passed {
+		if vocab.KnowledgeLevel < maxKnowledge {
+			vocab.KnowledgeLevel++
+		}
+		vocab.PracticeAt = inDays(config.interval(vocab.KnowledgeLevel))
+	} else {
+		if vocab.KnowledgeLevel > 0 {
+			vocab.KnowledgeLevel--
+		}
+		vocab.PracticeAt = inDays(1)
+	}
+}
+
+// daysUntil returns the number of days from today until the day of t.
+func daysUntil(t time.Time) int {
+	return int(math.Round(t.Sub(inDays(0)).Hours() / 24))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Schedule(t *testing.T) {
+	cases := []struct {
+		knowledgeLevel         uint
+		passed                 bool
+		expectedKnowledgeLevel uint
+		expectedDays           int
+	}{
+		{0, true, 1, 1},
+		{3, true, 4, 8},
+		{7, true, 7, 64},
+		{0, false, 0, 1},
+		{5, false, 4, 1},
+	}
+
+	for _, c := range cases {
+		vocab := &Vocab{KnowledgeLevel: c.knowledgeLevel, PracticeAt: inDays(0)}
+		schedule(DefaultConfig(), vocab, c.passed)
+		require.Equal(t, c.expectedKnowledgeLevel, vocab.KnowledgeLevel)
+		require.True(t, vocab.PracticeAt.Equal(inDays(c.expectedDays)))
+		require.Equal(t, c.expectedDays, daysUntil(vocab.PracticeAt))
+	}
+}
+
+func Test_Schedule_ConfiguredIntervals(t *testing.T) {
+	config := DefaultConfig()
+	config.Intervals = []int{3, 3, 5, 10, 20, 40, 80}
+
+	vocab := &Vocab{KnowledgeLevel: 0, PracticeAt: inDays(0)}
+	schedule(config, vocab, true)
+	require.Equal(t, uint(1), vocab.KnowledgeLevel)
+	require.Equal(t, 3, daysUntil(vocab.PracticeAt))
+
+	vocab = &Vocab{KnowledgeLevel: 6, PracticeAt: inDays(0)}
+	schedule(config, vocab, true)
+	require.Equal(t, 80, daysUntil(vocab.PracticeAt))
+}
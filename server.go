@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
-	"io/ioutil"
-	"log"
+	"math"
 	"net/http"
 	"os"
-	"path/filepath"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "embed"
@@ -22,20 +26,59 @@ type Server struct {
 	router *mux.Router
 }
 
-func NewServer(db *gorm.DB) *Server {
+func NewServer(db *gorm.DB, config *Config) *Server {
 	router := mux.NewRouter()
 	router.Use(errorHandlingMiddleware)
+	tokenHandler := &tokenHandler{db: db, config: config}
+	router.Use(tokenHandler.middleware)
+
+	// Without accounts, every request works on the local collection.
+	stores := oneStore(NewGormStore(db))
+	if config.Accounts {
+		stores = func(r *http.Request) Store {
+			return NewUserStore(db, requestUser(r).ID)
+		}
+	}
 
 	api := router.PathPrefix("/api").Subrouter()
-	vocabHandler := &vocabHandler{db: db}
-	api.HandleFunc("/vocab", vocabHandler.get).Methods("GET")
-	api.HandleFunc("/vocab", vocabHandler.post).Methods("POST")
-	api.HandleFunc("/vocab/{id:\\d+}", vocabHandler.delete).Methods("DELETE")
-	practiceHandler := &practiceHandler{db: db}
-	api.HandleFunc("/practice", practiceHandler.get).Methods("GET")
-	api.HandleFunc("/practice/count", practiceHandler.getCount).Methods("GET")
-	api.HandleFunc("/practice", practiceHandler.post).Methods("POST")
-	router.PathPrefix("/").Handler(http.HandlerFunc(serveSPA))
+	accountHandler := &accountHandler{db: db, config: config, tokens: tokenHandler}
+	api.HandleFunc("/openapi.json", getOpenApi).Methods("GET")
+	api.HandleFunc("/session", accountHandler.getSession).Methods("GET")
+	api.HandleFunc("/token", tokenHandler.post).Methods("POST")
+	if config.Accounts {
+		api.HandleFunc("/register", accountHandler.register).Methods("POST")
+		api.HandleFunc("/login", accountHandler.login).Methods("POST")
+		api.HandleFunc("/logout", accountHandler.logout).Methods("POST")
+	}
+
+	collection := api.NewRoute().Subrouter()
+	if config.Accounts {
+		collection.Use(accountHandler.requireUser)
+	}
+	vocabHandler := &vocabHandler{stores: stores, config: config}
+	collection.HandleFunc("/vocab", vocabHandler.get).Methods("GET")
+	collection.HandleFunc("/vocab", vocabHandler.post).Methods("POST")
+	collection.HandleFunc("/vocab/{id:\\d+}", vocabHandler.put).Methods("PUT")
+	collection.HandleFunc("/vocab/{id:\\d+}", vocabHandler.delete).Methods("DELETE")
+	collection.HandleFunc("/vocab/{id:\\d+}/restore", vocabHandler.restore).Methods("POST")
+	collection.HandleFunc("/trash", vocabHandler.getTrash).Methods("GET")
+	practiceHandler := &practiceHandler{stores: stores, config: config}
+	collection.HandleFunc("/practice", practiceHandler.get).Methods("GET")
+	collection.HandleFunc("/practice/count", practiceHandler.getCount).Methods("GET")
+	collection.HandleFunc("/practice", practiceHandler.post).Methods("POST")
+	collection.HandleFunc("/practice/undo", practiceHandler.undo).Methods("POST")
+	importHandler := &importHandler{stores: stores}
+	collection.HandleFunc("/import/text/preview", importHandler.previewText).Methods("POST")
+	collection.HandleFunc("/import/text", importHandler.postText).Methods("POST")
+	collection.HandleFunc("/import/csv", importHandler.postCsv).Methods("POST")
+	statsHandler := &statsHandler{stores: stores}
+	collection.HandleFunc("/stats", statsHandler.get).Methods("GET")
+	exportHandler := &exportHandler{stores: stores}
+	collection.HandleFunc("/export", exportHandler.get).Methods("GET")
+	syncHandler := &syncHandler{db: db, config: config}
+	collection.HandleFunc("/sync", syncHandler.post).Methods("POST")
+	api.PathPrefix("/").HandlerFunc(notFound)
+	router.PathPrefix("/").Handler(spaHandler{files: wwwFiles()})
 
 	return &Server{
 		router: router,
@@ -46,42 +89,73 @@ func (a *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.router.ServeHTTP(w, r)
 }
 
+//go:generate go run vendor_www.go
+
 //go:embed www
 var www embed.FS
 
-func serveSPA(w http.ResponseWriter, r *http.Request) {
+// wwwFiles returns the files of the web application: those in www when run
+// from the repository, so changes show without rebuilding, otherwise those
+// embedded in the binary.
+func wwwFiles() fs.FS {
 	_, err := os.Stat("www")
 	if err == nil {
-		// dev
-		_, err = os.Stat(filepath.Join("www", r.URL.Path))
-		if err == nil {
-			http.FileServer(http.Dir("www")).ServeHTTP(w, r)
-			return
-		}
-		http.ServeFile(w, r, "www/index.html")
-	} else {
-		// prod
-		_, err = www.Open(filepath.Join("www", r.URL.Path))
-		if err == nil {
-			files, err := fs.Sub(www, "www")
-			check(err)
-			http.FileServer(http.FS(files)).ServeHTTP(w, r)
-			return
+		return os.DirFS("www")
+	}
+	return embeddedWwwFiles()
+}
+
+// embeddedWwwFiles returns the files of the web application embedded in the
+// binary.
+func embeddedWwwFiles() fs.FS {
+	files, err := fs.Sub(www, "www")
+	check(err)
+	return files
+}
+
+// spaHandler serves the files of the web application, and index.html for
+// any other path, for the router of the application to handle.
+type spaHandler struct {
+	files fs.FS
+}
+
+func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	vendored := strings.HasPrefix(name, "vendor/")
+	info, err := fs.Stat(h.files, name)
+	if err == nil {
+		if vendored && !info.IsDir() {
+			// Vendored libraries are named by version, so never change.
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
 		}
-		b, err := www.ReadFile("index.html")
-		check(err)
-		_, err = w.Write(b)
-		check(err)
+		http.FileServer(http.FS(h.files)).ServeHTTP(w, r)
+		return
+	}
+	if vendored {
+		http.NotFound(w, r)
+		return
 	}
+
+	b, err := fs.ReadFile(h.files, "index.html")
+	check(err)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write(b)
+	check(err)
 }
 
 func errorHandlingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			err := recover()
-			if err != nil {
-				http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
-				log.Println(err)
+			recovered := recover()
+			if recovered != nil {
+				err, ok := recovered.(error)
+				if !ok {
+					err = fmt.Errorf("%v", recovered)
+				}
+				writeError(w, err)
 			}
 		}()
 
@@ -89,172 +163,730 @@ func errorHandlingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+const (
+	sessionCookieName = "vocab_session"
+	tokenCookieName   = "vocab_token"
+)
+
+type contextKey string
+
+const (
+	userContextKey  contextKey = "user"
+	tokenContextKey contextKey = "token"
+)
+
+// publicPaths can be requested without an API token, so that the web
+// application can find out it needs one and ask for it, and scripts can read
+// the description of the API.
+var publicPaths = map[string]bool{
+	"/api/openapi.json": true,
+	"/api/session":      true,
+	"/api/token":        true,
+}
+
+// requestToken returns the API token sent with the request, from the
+// Authorization header or, for the web application, the token cookie.
+func requestToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	cookie, err := r.Cookie(tokenCookieName)
+	if err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requestApiToken returns the API token the request was authenticated with,
+// or nil if there was none.
+func requestApiToken(r *http.Request) *ApiToken {
+	apiToken, _ := r.Context().Value(tokenContextKey).(*ApiToken)
+	return apiToken
+}
+
+type tokenHandler struct {
+	db     *gorm.DB
+	config *Config
+}
+
+// middleware authenticates API requests made with a token, rejecting those
+// with a bad token and, if tokens are required, those without one.
+func (h *tokenHandler) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := requestToken(r)
+		if token != "" {
+			ctx, err := h.authenticate(r.Context(), token)
+			if errors.Is(err, ErrBadToken) {
+				// A bad token is treated as none on the public paths,
+				// so the web application can ask for a new one.
+				if !publicPaths[r.URL.Path] {
+					writeError(w, err)
+					return
+				}
+			} else {
+				check(err)
+				r = r.WithContext(ctx)
+			}
+		}
+
+		if h.tokenRequired(r) && !publicPaths[r.URL.Path] {
+			writeError(w, &ApiError{Status: http.StatusUnauthorized, Code: codeUnauthorized, Message: "API token required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenRequired returns true if the request needs, but doesn't have, an API
+// token. With accounts on, logging in is enough.
+func (h *tokenHandler) tokenRequired(r *http.Request) bool {
+	return h.config.RequireToken && !h.config.Accounts && requestApiToken(r) == nil
+}
+
+// authenticate returns ctx with the API token matching token and, with
+// accounts on, the user it belongs to.
+func (h *tokenHandler) authenticate(ctx context.Context, token string) (context.Context, error) {
+	apiToken, err := useApiToken(h.db, token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !h.config.Accounts {
+		// Without accounts, only tokens for the local collection are valid.
+		if apiToken.UserID != noUser {
+			return nil, ErrBadToken
+		}
+		return context.WithValue(ctx, tokenContextKey, apiToken), nil
+	}
+
+	users := make([]User, 0)
+	dbResult := h.db.Where("id = ?", apiToken.UserID).Limit(1).Find(&users)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	if len(users) == 0 {
+		return nil, ErrBadToken
+	}
+	ctx = context.WithValue(ctx, tokenContextKey, apiToken)
+	return context.WithValue(ctx, userContextKey, &users[0]), nil
+}
+
+// post checks the token the web application was given and keeps it in a
+// cookie, which unlike the Authorization header is also sent with links,
+// e.g. to exports.
+func (h *tokenHandler) post(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Token string `json:"token"`
+	}
+	err := readJSON(w, r, &requestData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	token := strings.TrimSpace(requestData.Token)
+	if token == "" {
+		writeError(w, ErrInvalid{Field: "token", Message: "is required"})
+		return
+	}
+
+	_, err = h.authenticate(r.Context(), token)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().AddDate(1, 0, 0),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// requestUser returns the user logged in to make the request, or nil if
+// accounts are off.
+func requestUser(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+type accountHandler struct {
+	db     *gorm.DB
+	config *Config
+	tokens *tokenHandler
+}
+
+// requireUser rejects requests that aren't logged in, and passes the user on
+// to the next handler.
+func (h *accountHandler) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestUser(r) != nil {
+			// Authenticated with an API token.
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, err := h.sessionUser(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+func (h *accountHandler) sessionUser(r *http.Request) (*User, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	return sessionUser(h.db, cookie.Value, time.Now())
+}
+
+func (h *accountHandler) getSession(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if h.config.Accounts && user == nil {
+		var err error
+		user, err = h.sessionUser(r)
+		if !errors.Is(err, ErrNoSession) {
+			check(err)
+		}
+	}
+
+	err := writeJSON(w, struct {
+		Accounts      bool  `json:"accounts"`
+		User          *User `json:"user"`
+		TokenRequired bool  `json:"tokenRequired"`
+	}{h.config.Accounts, user, h.tokens.tokenRequired(r)})
+	check(err)
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (h *accountHandler) register(w http.ResponseWriter, r *http.Request) {
+	var requestData credentialsRequest
+	err := readJSON(w, r, &requestData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	user, err := registerUser(h.db, requestData.Username, requestData.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.startSession(w, r, user)
+}
+
+func (h *accountHandler) login(w http.ResponseWriter, r *http.Request) {
+	var requestData credentialsRequest
+	err := readJSON(w, r, &requestData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	user, err := authenticate(h.db, requestData.Username, requestData.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	h.startSession(w, r, user)
+}
+
+func (h *accountHandler) startSession(w http.ResponseWriter, r *http.Request, user *User) {
+	now := time.Now()
+	token, err := createSession(h.db, user.ID, now)
+	check(err)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  now.Add(sessionDuration),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Other sites can't make requests with the cookie, which protects
+		// against cross-site request forgery.
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	err = writeJSON(w, user)
+	check(err)
+}
+
+func (h *accountHandler) logout(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err == nil {
+		err = deleteSession(h.db, cookie.Value, time.Now())
+		check(err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, &ApiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "no such endpoint: " + r.Method + " " + r.URL.Path})
+}
+
+// storeFunc returns the Store of the collection a request works on.
+type storeFunc func(r *http.Request) Store
+
+// oneStore returns a storeFunc for which every request works on store.
+func oneStore(store Store) storeFunc {
+	return func(r *http.Request) Store {
+		return store
+	}
+}
+
 type vocabHandler struct {
-	db *gorm.DB
+	stores storeFunc
+	config *Config
 }
 
 func (h *vocabHandler) get(w http.ResponseWriter, r *http.Request) {
 	qp := &QueryParams{r}
 
-	q := h.db.Model(&Vocab{})
+	vq := NewVocabQuery()
+	vq.Term = qp.Str("term", "")
+	vq.Translation = qp.Str("translation", "")
+	vq.Mode = qp.Str("mode", "")
+	vq.OrderBy = qp.Str("order_by", "")
+	vq.Skip = qp.Int("skip", 0)
+	vq.Take = qp.Int("take", vq.Take)
 
-	termQp := qp.Str("term", "")
-	translationQp := qp.Str("translation", "")
-	if termQp != "" && translationQp != "" {
-		if qp.Str("mode", "") == "or" {
-			q = q.Where("term like ? or translation like ?", like(termQp), like(translationQp))
-		} else {
-			q = q.Where("term like ? and translation like ?", like(termQp), like(translationQp))
-		}
-	} else if termQp != "" {
-		q = q.Where("term like ?", like(termQp))
-	} else if translationQp != "" {
-		q = q.Where("translation like ?", like(translationQp))
-	}
-
-	var count int64
-	dbResult := q.Count(&count)
-	check(dbResult.Error)
-
-	orderBy, orderByQp := "term", qp.Str("order_by", "")
-	if orderByQp == "knowledge_level" {
-		orderBy = "knowledge_level"
-	} else if orderByQp == "knowledge_level_desc" {
-		orderBy = "knowledge_level desc"
-	} else if orderByQp == "practice_at" {
-		orderBy = "practice_at"
-	} else if orderByQp == "practice_at_desc" {
-		orderBy = "practice_at desc"
-	}
-
-	vocabs := make([]Vocab, 0)
-	dbResult = q.
-		Order(orderBy + ", term").
-		Offset(qp.Int("skip", 0)).
-		Limit(min(qp.Int("take", 10), 50)).
-		Find(&vocabs)
-	check(dbResult.Error)
-
-	err := writeJSON(w, map[string]interface{}{
+	vocabs, count, err := h.stores(r).FindVocab(vq, h.config.MaxPageSize)
+	check(err)
+
+	err = writeJSON(w, map[string]interface{}{
 		"count": count,
 		"items": vocabs,
 	})
 	check(err)
 }
 
+type vocabRequest struct {
+	Term        string `json:"term"`
+	Translation string `json:"translation"`
+}
+
+func (v vocabRequest) Validate() error {
+	if strings.TrimSpace(v.Term) == "" {
+		return ErrInvalid{Field: "term", Message: "is required"}
+	}
+	if strings.TrimSpace(v.Translation) == "" {
+		return ErrInvalid{Field: "translation", Message: "is required"}
+	}
+	return nil
+}
+
 func (h *vocabHandler) post(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+	var requestData vocabRequest
+	err := readJSON(w, r, &requestData)
+	if err == nil {
+		err = requestData.Validate()
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	vocab, err := h.stores(r).CreateVocab(strings.TrimSpace(requestData.Term), strings.TrimSpace(requestData.Translation))
 	check(err)
 
-	var requestData map[string]string
-	err = json.Unmarshal(body, &requestData)
+	err = writeJSON(w, map[string]uint{"id": vocab.ID})
 	check(err)
+}
 
-	if term, ok := requestData["term"]; !ok || term == "" {
-		http.Error(w, "term is required", http.StatusBadRequest)
+func (h *vocabHandler) put(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	check(err)
+	var requestData vocabRequest
+	err = readJSON(w, r, &requestData)
+	if err == nil {
+		err = requestData.Validate()
+	}
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	if translation, ok := requestData["translation"]; !ok || translation == "" {
-		http.Error(w, "translation is required", http.StatusBadRequest)
+	vocab, err := h.stores(r).UpdateVocab(uint(id), strings.TrimSpace(requestData.Term), strings.TrimSpace(requestData.Translation))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	vocab := &Vocab{
-		Term:           requestData["term"],
-		Translation:    requestData["translation"],
-		KnowledgeLevel: 0,
-		PracticeAt:     inDays(0),
+	err = writeJSON(w, vocab)
+	check(err)
+}
+
+func (h *vocabHandler) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	check(err)
+	found, err := h.stores(r).DeleteVocab(uint(id))
+	check(err)
+	if !found {
+		writeError(w, ErrVocabNotFound)
 	}
-	dbResult := h.db.Create(vocab)
-	check(dbResult.Error)
+}
 
-	err = writeJSON(w, map[string]uint{"id": vocab.ID})
+type trashedVocab struct {
+	Vocab
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+func (h *vocabHandler) getTrash(w http.ResponseWriter, r *http.Request) {
+	vocabs, err := h.stores(r).TrashedVocab()
+	check(err)
+
+	trashed := make([]trashedVocab, 0, len(vocabs))
+	for _, vocab := range vocabs {
+		trashed = append(trashed, trashedVocab{vocab, vocab.DeletedAt.Time})
+	}
+	err = writeJSON(w, trashed)
 	check(err)
 }
 
-func (h *vocabHandler) delete(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
-	dbResult := h.db.Delete(&Vocab{}, id)
-	check(dbResult.Error)
+func (h *vocabHandler) restore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	check(err)
+	vocab, err := h.stores(r).RestoreVocab(uint(id))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = writeJSON(w, vocab)
+	check(err)
 }
 
 type practiceHandler struct {
-	db *gorm.DB
+	stores storeFunc
+	config *Config
 }
 
 func (h *practiceHandler) get(w http.ResponseWriter, r *http.Request) {
-	vocabs := make([]Vocab, 0)
-	dbResult := h.db.
-		Model(&Vocab{}).
-		Where("practice_at < ?", time.Now()).
-		Order("practice_at").
-		Limit(10).
-		Find(&vocabs)
-	check(dbResult.Error)
+	vocabs, err := h.stores(r).DueVocab(h.config.SessionSize)
+	check(err)
 
-	err := writeJSON(w, vocabs)
+	err = writeJSON(w, vocabs)
 	check(err)
 }
 
 func (h *practiceHandler) getCount(w http.ResponseWriter, r *http.Request) {
-	var count int64
-	dbResult := h.db.
-		Model(&Vocab{}).
-		Where("practice_at < ?", time.Now()).
-		Count(&count)
-	check(dbResult.Error)
+	count, err := h.stores(r).CountDueVocab()
+	check(err)
 
-	err := writeJSON(w, struct {
+	err = writeJSON(w, struct {
 		Count int64 `json:"count"`
 	}{count})
 	check(err)
 }
 
-var maxKnowledge uint = 7
-var knowledgeToPracticeMap map[uint]int = map[uint]int{
-	1: 1,
-	2: 2,
-	3: 4,
-	4: 8,
-	5: 16,
-	6: 32,
-	7: 64,
+type practiceRequest []struct {
+	ID uint `json:"id"`
+	// Passed is a pointer to tell false from missing.
+	Passed *bool `json:"passed"`
+}
+
+func (p practiceRequest) Validate() error {
+	for idx, item := range p {
+		if item.ID == 0 {
+			return ErrInvalid{Field: fmt.Sprintf("[%d].id", idx), Message: "is required"}
+		}
+		if item.Passed == nil {
+			return ErrInvalid{Field: fmt.Sprintf("[%d].passed", idx), Message: "is required"}
+		}
+	}
+	return nil
 }
 
-// Passed vocab should be skilled up and scheduled for practice according to the new level.
-// Failed vocab should be skilled down and scheduled for practice tomorrow.
 func (h *practiceHandler) post(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+	requestData := make(practiceRequest, 0)
+	err := readJSON(w, r, &requestData)
+	if err == nil {
+		err = requestData.Validate()
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	answers := make([]Answer, 0, len(requestData))
+	for _, practiceItem := range requestData {
+		answers = append(answers, Answer{VocabID: practiceItem.ID, Passed: *practiceItem.Passed})
+	}
+	vocabs, err := h.stores(r).RecordReviews(h.config, answers)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = writeJSON(w, vocabs)
 	check(err)
+}
 
-	requestData := make([]struct {
-		ID     uint `json:"id"`
-		Passed bool `json:"passed"`
-	}, 0)
-	err = json.Unmarshal(body, &requestData)
+// undo undoes the results posted most recently.
+func (h *practiceHandler) undo(w http.ResponseWriter, r *http.Request) {
+	vocabs, err := h.stores(r).UndoPractice()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = writeJSON(w, vocabs)
 	check(err)
+}
 
-	for _, practiceItem := range requestData {
-		var vocab *Vocab
-		dbResult := h.db.First(&vocab, practiceItem.ID)
-		check(dbResult.Error)
+type importHandler struct {
+	stores storeFunc
+}
 
-		if practiceItem.Passed {
-			if vocab.KnowledgeLevel < maxKnowledge {
-				vocab.KnowledgeLevel++
-			}
-			vocab.PracticeAt = inDays(knowledgeToPracticeMap[vocab.KnowledgeLevel])
-		} else {
-			if vocab.KnowledgeLevel > 0 {
-				vocab.KnowledgeLevel--
-			}
-			vocab.PracticeAt = inDays(1)
+// parseText parses the text in the request body, writing an error response
+// and returning false if it can't be parsed.
+func (h *importHandler) parseText(w http.ResponseWriter, r *http.Request) ([]TextPair, bool) {
+	var requestData struct {
+		Text          string `json:"text"`
+		TermSeparator string `json:"termSeparator"`
+		CardSeparator string `json:"cardSeparator"`
+	}
+	err := readJSON(w, r, &requestData)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+
+	text := NewText(h.stores(r))
+	if requestData.TermSeparator != "" {
+		text.TermSeparator = requestData.TermSeparator
+	}
+	if requestData.CardSeparator != "" {
+		text.CardSeparator = requestData.CardSeparator
+	}
+
+	pairs, err := text.Parse(strings.NewReader(requestData.Text))
+	var badCard ErrBadCard
+	if errors.As(err, &ErrBadSeparator{}) {
+		writeError(w, ErrInvalid{Field: "termSeparator", Message: "must not be empty or the same as cardSeparator"})
+		return nil, false
+	} else if errors.As(err, &badCard) {
+		writeError(w, ErrInvalid{Field: "text", Message: fmt.Sprintf("has a bad card, number %d", badCard.Number)})
+		return nil, false
+	}
+	check(err)
+	return pairs, true
+}
+
+func (h *importHandler) previewText(w http.ResponseWriter, r *http.Request) {
+	pairs, ok := h.parseText(w, r)
+	if !ok {
+		return
+	}
+
+	err := writeJSON(w, pairs)
+	check(err)
+}
+
+func (h *importHandler) postText(w http.ResponseWriter, r *http.Request) {
+	pairs, ok := h.parseText(w, r)
+	if !ok {
+		return
+	}
+	if len(pairs) == 0 {
+		writeError(w, ErrInvalid{Field: "text", Message: "has no vocab"})
+		return
+	}
+
+	err := h.stores(r).Transaction(func(tx Store) error {
+		return createPairs(tx, pairs)
+	})
+	check(err)
+
+	err = writeJSON(w, struct {
+		Count int `json:"count"`
+	}{len(pairs)})
+	check(err)
+}
+
+// postCsv imports the CSV in the request body, in the format of the CSV
+// export.
+func (h *importHandler) postCsv(w http.ResponseWriter, r *http.Request) {
+	count := 0
+	csv := NewCsv(h.stores(r))
+	csv.Progress = func(rows int) {
+		count = rows
+	}
+	err := csv.Import(r.Body)
+	var missingHeading ErrMissingHeading
+	var badRow ErrBadRow
+	if errors.As(err, &missingHeading) {
+		writeError(w, ErrInvalid{Field: "csv", Message: "is missing the heading " + missingHeading.Heading})
+		return
+	} else if errors.As(err, &badRow) {
+		message := fmt.Sprintf("has a bad row, number %d", badRow.Number)
+		if badRow.Field != "" {
+			message += ", field " + badRow.Field
 		}
+		writeError(w, ErrInvalid{Field: "csv", Message: message})
+		return
+	} else if errors.Is(err, io.EOF) {
+		writeError(w, ErrInvalid{Field: "csv", Message: "is empty"})
+		return
+	}
+	check(err)
+
+	err = writeJSON(w, struct {
+		Count int `json:"count"`
+	}{count})
+	check(err)
+}
 
-		dbResult = h.db.Save(&vocab)
-		check(dbResult.Error)
+type statsHandler struct {
+	stores storeFunc
+}
+
+func (h *statsHandler) get(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.stores(r).Stats()
+	check(err)
+
+	err = writeJSON(w, stats)
+	check(err)
+}
+
+type exportHandler struct {
+	stores storeFunc
+}
+
+func (h *exportHandler) get(w http.ResponseWriter, r *http.Request) {
+	qp := &QueryParams{r}
+
+	opts := DefaultExportOptions()
+	minLevel := qp.Int("min_knowledge", int(opts.MinKnowledgeLevel))
+	if minLevel < 0 {
+		writeError(w, badRequest("min_knowledge", "min_knowledge must not be negative"))
+		return
+	}
+	maxLevel := qp.Int("max_knowledge", int(opts.MaxKnowledgeLevel))
+	if maxLevel < 0 {
+		writeError(w, badRequest("max_knowledge", "max_knowledge must not be negative"))
+		return
+	}
+	opts.MinKnowledgeLevel = uint(minLevel)
+	opts.MaxKnowledgeLevel = uint(maxLevel)
+	opts.GroupBy = qp.Str("group_by", opts.GroupBy)
+	opts.OrderBy = qp.Str("order_by", opts.OrderBy)
+	err := opts.Validate()
+	if err != nil {
+		writeError(w, badRequest("", err.Error()))
+		return
+	}
+
+	layout := DefaultFlashcardLayout()
+	layout.CardsPerPage = qp.Int("cards_per_page", layout.CardsPerPage)
+	layout.FontSize = qp.Float("font_size", layout.FontSize)
+	if layout.FontSize <= 0 {
+		writeError(w, badRequest("font_size", "font_size must be positive"))
+		return
 	}
+	layout.FlipEdge = qp.Str("flip_edge", layout.FlipEdge)
+	err = layout.Validate()
+	if err != nil {
+		writeError(w, badRequest("", err.Error()))
+		return
+	}
+
+	format := qp.Str("format", "csv")
+	if format == "md" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		err = NewExport(h.stores(r)).Markdown(w, opts)
+	} else if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = NewExport(h.stores(r)).HTML(w, opts)
+	} else if format == "pdf" {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="vocab.pdf"`)
+		err = NewExport(h.stores(r)).Flashcards(w, opts, layout)
+	} else if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="vocab.csv"`)
+		err = NewCsv(h.stores(r)).Export(w)
+	} else {
+		writeError(w, badRequest("format", "format must be one of csv, md, html, pdf"))
+		return
+	}
+	check(err)
+}
+
+type syncHandler struct {
+	db     *gorm.DB
+	config *Config
+}
+
+type syncRequest struct {
+	Device  string   `json:"device"`
+	Cursor  string   `json:"cursor"`
+	Changes []change `json:"changes"`
+}
+
+func (s syncRequest) Validate() error {
+	if s.Device == "" {
+		return ErrInvalid{Field: "device", Message: "is required"}
+	}
+	for idx, c := range s.Changes {
+		err := c.validate()
+		var invalid ErrInvalid
+		if errors.As(err, &invalid) {
+			return ErrInvalid{Field: fmt.Sprintf("changes[%d].%s", idx, invalid.Field), Message: invalid.Message}
+		}
+	}
+	return nil
+}
+
+func (h *syncHandler) post(w http.ResponseWriter, r *http.Request) {
+	requestData := syncRequest{}
+	err := readJSON(w, r, &requestData)
+	if err == nil {
+		err = requestData.Validate()
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	userID := uint(noUser)
+	if h.config.Accounts {
+		userID = requestUser(r).ID
+	}
+	exchange, err := exchangeChanges(h.db, userID, requestData.Device, requestData.Cursor, requestData.Changes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = writeJSON(w, exchange)
+	check(err)
 }
 
 func check(err error) {
@@ -297,6 +929,20 @@ func (q *QueryParams) Int(key string, fallback int) int {
 	return i
 }
 
+// Float returns the number, or the fallback if it's missing, invalid or not
+// finite.
+func (q *QueryParams) Float(key string, fallback float64) float64 {
+	s := q.r.URL.Query().Get(key)
+	if s == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fallback
+	}
+	return f
+}
+
 func like(s string) string {
 	return "%" + s + "%"
 }
@@ -313,3 +959,10 @@ func min(i, j int) int {
 	}
 	return j
 }
+
+func max(i, j int) int {
+	if i > j {
+		return i
+	}
+	return j
+}
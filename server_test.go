@@ -2,65 +2,380 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func Test_GetVocab(t *testing.T) {
-	db := memoryDb(t)
-	server := NewServer(db)
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 3,
-		PracticeAt:     inDays(2),
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(2),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("GET", "/api/vocab", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON := fmt.Sprintf(`{
+			"count": 2,
+			"items": [
+				{
+					"id": 1,
+					"term": "foo1",
+					"translation": "bar1",
+					"knowledgeLevel": 3,
+					"practiceAt": "%s"
+				},
+				{
+					"id": 2,
+					"term": "foo2",
+					"translation": "bar2",
+					"knowledgeLevel": 1,
+					"practiceAt": "%s"
+				}
+			]
+		}`, inDaysJSON(2), inDaysJSON(1))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
 	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
+}
+
+func Test_GetVocab_Paging(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		for i := 0; i < 10; i++ {
+			dbResult := db.Create(&Vocab{
+				Term:           "foo",
+				Translation:    "bar",
+				KnowledgeLevel: 3,
+				PracticeAt:     inDays(2),
+			})
+			require.Nil(t, dbResult.Error)
+		}
+
+		req, _ := http.NewRequest("GET", "/api/vocab?skip=3&take=2", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON := fmt.Sprintf(`{
+			"count": 10,
+			"items": [
+				{
+					"id": 4,
+					"term": "foo",
+					"translation": "bar",
+					"knowledgeLevel": 3,
+					"practiceAt": "%[1]s"
+				},
+				{
+					"id": 5,
+					"term": "foo",
+					"translation": "bar",
+					"knowledgeLevel": 3,
+					"practiceAt": "%[1]s"
+				}
+			]
+		}`, inDaysJSON(2))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
 	})
-	require.Nil(t, dbResult.Error)
+}
 
-	req, _ := http.NewRequest("GET", "/api/vocab", nil)
-	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+func Test_GetVocab_Search(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
 
-	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON := fmt.Sprintf(`{
-		"count": 2,
-		"items": [
-			{
-				"id": 1,
-				"term": "foo1",
-				"translation": "bar1",
-				"knowledgeLevel": 3,
-				"practiceAt": "%s"
-			},
-			{
-				"id": 2,
-				"term": "foo2",
-				"translation": "bar2",
-				"knowledgeLevel": 1,
-				"practiceAt": "%s"
-			}
-		]
-	}`, inDaysJSON(2), inDaysJSON(1))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+		dbResult := db.Create(&Vocab{
+			Term:           "guten tag",
+			Translation:    "good day",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "apfel kuchen",
+			Translation:    "apple cake",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("GET", "/api/vocab?term=guten", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON := fmt.Sprintf(`{
+			"count": 1,
+			"items": [
+				{
+					"id": 1,
+					"term": "guten tag",
+					"translation": "good day",
+					"knowledgeLevel": 1,
+					"practiceAt": "%s"
+				}
+			]
+		}`, inDaysJSON(1))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+
+		req, _ = http.NewRequest("GET", "/api/vocab?translation=apple%20cake", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON = fmt.Sprintf(`{
+			"count": 1,
+			"items": [
+				{
+					"id": 2,
+					"term": "apfel kuchen",
+					"translation": "apple cake",
+					"knowledgeLevel": 1,
+					"practiceAt": "%s"
+				}
+			]
+		}`, inDaysJSON(1))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+
+		req, _ = http.NewRequest("GET", "/api/vocab?term=guten&translation=apple%20cake", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{
+			"count": 0,
+			"items": []
+		}`, rr.Body.String())
+
+		req, _ = http.NewRequest("GET", "/api/vocab?term=guten&translation=apple%20cake&mode=or", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON = fmt.Sprintf(`{
+			"count": 2,
+			"items": [
+				{
+					"id": 2,
+					"term": "apfel kuchen",
+					"translation": "apple cake",
+					"knowledgeLevel": 1,
+					"practiceAt": "%[1]s"
+				},
+				{
+					"id": 1,
+					"term": "guten tag",
+					"translation": "good day",
+					"knowledgeLevel": 1,
+					"practiceAt": "%[1]s"
+				}
+			]
+		}`, inDaysJSON(1))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+	})
 }
 
-func Test_GetVocab_Paging(t *testing.T) {
-	db := memoryDb(t)
-	server := NewServer(db)
+func Test_GetVocab_OrderBy(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(2),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 5,
+			PracticeAt:     inDays(4),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo3",
+			Translation:    "bar3",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(3),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("GET", "/api/vocab?order_by=knowledge_level", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON := fmt.Sprintf(`{
+			"count": 3,
+			"items": [
+				{
+					"id": 3,
+					"term": "foo3",
+					"translation": "bar3",
+					"knowledgeLevel": 1,
+					"practiceAt": "%[3]s"
+				},
+				{
+					"id": 1,
+					"term": "foo1",
+					"translation": "bar1",
+					"knowledgeLevel": 3,
+					"practiceAt": "%[1]s"
+				},
+				{
+					"id": 2,
+					"term": "foo2",
+					"translation": "bar2",
+					"knowledgeLevel": 5,
+					"practiceAt": "%[2]s"
+				}
+			]
+		}`, inDaysJSON(2), inDaysJSON(4), inDaysJSON(3))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+
+		req, _ = http.NewRequest("GET", "/api/vocab?order_by=knowledge_level_desc", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON = fmt.Sprintf(`{
+			"count": 3,
+			"items": [
+				{
+					"id": 2,
+					"term": "foo2",
+					"translation": "bar2",
+					"knowledgeLevel": 5,
+					"practiceAt": "%[2]s"
+				},
+				{
+					"id": 1,
+					"term": "foo1",
+					"translation": "bar1",
+					"knowledgeLevel": 3,
+					"practiceAt": "%[1]s"
+				},
+				{
+					"id": 3,
+					"term": "foo3",
+					"translation": "bar3",
+					"knowledgeLevel": 1,
+					"practiceAt": "%[3]s"
+				}
+			]
+		}`, inDaysJSON(2), inDaysJSON(4), inDaysJSON(3))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+
+		req, _ = http.NewRequest("GET", "/api/vocab?order_by=practice_at", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON = fmt.Sprintf(`{
+			"count": 3,
+			"items": [
+				{
+					"id": 1,
+					"term": "foo1",
+					"translation": "bar1",
+					"knowledgeLevel": 3,
+					"practiceAt": "%[1]s"
+				},
+				{
+					"id": 3,
+					"term": "foo3",
+					"translation": "bar3",
+					"knowledgeLevel": 1,
+					"practiceAt": "%[3]s"
+				},
+				{
+					"id": 2,
+					"term": "foo2",
+					"translation": "bar2",
+					"knowledgeLevel": 5,
+					"practiceAt": "%[2]s"
+				}
+			]
+		}`, inDaysJSON(2), inDaysJSON(4), inDaysJSON(3))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+	})
+}
+
+func Test_PostVocab(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		var body bytes.Buffer
+		_, err := body.WriteString(`{
+			"term": "foo",
+			"translation": "bar"
+		}`)
+		require.Nil(t, err)
+
+		req, _ := http.NewRequest("POST", "/api/vocab", &body)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"id": 1}`, rr.Body.String())
+
+		v := Vocab{}
+		dbResult := db.First(&v)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, "foo", v.Term)
+		require.Equal(t, "bar", v.Translation)
+		require.Equal(t, uint(0), v.KnowledgeLevel)
+		require.True(t, v.PracticeAt.Equal(inDays(0)))
+
+		// Spaces around the term and translation aren't kept.
+		req, _ = http.NewRequest("POST", "/api/vocab", strings.NewReader(`{"term": "  hund ", "translation": "dog\n"}`))
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		v = Vocab{}
+		dbResult = db.Last(&v)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, "hund", v.Term)
+		require.Equal(t, "dog", v.Translation)
+	})
+}
+
+func Test_PutVocab(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
 
-	for i := 0; i < 10; i++ {
 		dbResult := db.Create(&Vocab{
 			Term:           "foo",
 			Translation:    "bar",
@@ -68,469 +383,1040 @@ func Test_GetVocab_Paging(t *testing.T) {
 			PracticeAt:     inDays(2),
 		})
 		require.Nil(t, dbResult.Error)
-	}
 
-	req, _ := http.NewRequest("GET", "/api/vocab?skip=3&take=2", nil)
+		req, _ := http.NewRequest("PUT", "/api/vocab/1", strings.NewReader(`{"term": "foo1", "translation": "bar1"}`))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		expectedJSON := fmt.Sprintf(`{
+			"id": 1,
+			"term": "foo1",
+			"translation": "bar1",
+			"knowledgeLevel": 3,
+			"practiceAt": "%s"
+		}`, inDaysJSON(2))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+
+		req, _ = http.NewRequest("PUT", "/api/vocab/2", strings.NewReader(`{"term": "foo1", "translation": "bar1"}`))
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		req, _ = http.NewRequest("PUT", "/api/vocab/1", strings.NewReader(`{"term": " foo2", "translation": "bar2 "}`))
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), `"term":"foo2","translation":"bar2"`)
+
+		req, _ = http.NewRequest("PUT", "/api/vocab/1", strings.NewReader(`{"term": "foo1", "translation": ""}`))
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func Test_DeleteVocab(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		dbResult := db.Create(&Vocab{
+			Term:           "foo",
+			Translation:    "bar",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(2),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("DELETE", "/api/vocab/1", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var rowCount int64
+		dbResult = db.Model(&Vocab{}).Count(&rowCount)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(0), rowCount)
+	})
+}
+
+func Test_GetTrash(t *testing.T) {
+	store := newMemoryStore()
+	h := &vocabHandler{stores: oneStore(store), config: DefaultConfig()}
+	_, err := store.CreateVocab("foo", "bar")
+	require.Nil(t, err)
+	_, err = store.DeleteVocab(1)
+	require.Nil(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/trash", nil)
 	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+	h.getTrash(rr, req)
 
 	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON := fmt.Sprintf(`{
-		"count": 10,
-		"items": [
-			{
-				"id": 4,
-				"term": "foo",
-				"translation": "bar",
-				"knowledgeLevel": 3,
-				"practiceAt": "%[1]s"
-			},
-			{
-				"id": 5,
-				"term": "foo",
-				"translation": "bar",
-				"knowledgeLevel": 3,
-				"practiceAt": "%[1]s"
-			}
-		]
-	}`, inDaysJSON(2))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+	var trashed []struct {
+		ID        uint      `json:"id"`
+		Term      string    `json:"term"`
+		DeletedAt time.Time `json:"deletedAt"`
+	}
+	require.Nil(t, json.Unmarshal(rr.Body.Bytes(), &trashed))
+	require.Len(t, trashed, 1)
+	require.Equal(t, uint(1), trashed[0].ID)
+	require.Equal(t, "foo", trashed[0].Term)
+	require.WithinDuration(t, time.Now(), trashed[0].DeletedAt, time.Minute)
 }
 
-func Test_GetVocab_Search(t *testing.T) {
-	db := memoryDb(t)
-	server := NewServer(db)
+func Test_PostRestore(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+		_, err := NewGormStore(db).CreateVocab("foo", "bar")
+		require.Nil(t, err)
+		_, err = NewGormStore(db).DeleteVocab(1)
+		require.Nil(t, err)
 
-	dbResult := db.Create(&Vocab{
-		Term:           "guten tag",
-		Translation:    "good day",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "apfel kuchen",
-		Translation:    "apple cake",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
+		req, _ := http.NewRequest("POST", "/api/vocab/1/restore", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), `"term":"foo"`)
+		var rowCount int64
+		require.Nil(t, db.Model(&Vocab{}).Count(&rowCount).Error)
+		require.Equal(t, int64(1), rowCount)
+
+		// It's no longer in the trash.
+		req, _ = http.NewRequest("POST", "/api/vocab/1/restore", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNotFound, rr.Code)
 	})
-	require.Nil(t, dbResult.Error)
+}
+
+// The handlers only need a Store, so they can be tested against the fake.
+func Test_VocabHandler_MemoryStore(t *testing.T) {
+	store := newMemoryStore()
+	h := &vocabHandler{stores: oneStore(store), config: DefaultConfig()}
 
-	req, _ := http.NewRequest("GET", "/api/vocab?term=guten", nil)
+	req, _ := http.NewRequest("POST", "/api/vocab", strings.NewReader(`{"term": "foo", "translation": "bar"}`))
 	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+	h.post(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `{"id": 1}`, rr.Body.String())
 
+	req, _ = http.NewRequest("GET", "/api/vocab?term=fo", nil)
+	rr = httptest.NewRecorder()
+	h.get(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON := fmt.Sprintf(`{
+	require.JSONEq(t, fmt.Sprintf(`{
 		"count": 1,
 		"items": [
 			{
 				"id": 1,
-				"term": "guten tag",
-				"translation": "good day",
-				"knowledgeLevel": 1,
+				"term": "foo",
+				"translation": "bar",
+				"knowledgeLevel": 0,
 				"practiceAt": "%s"
 			}
 		]
-	}`, inDaysJSON(1))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+	}`, inDaysJSON(0)), rr.Body.String())
 
-	req, _ = http.NewRequest("GET", "/api/vocab?translation=apple%20cake", nil)
+	req, _ = http.NewRequest("DELETE", "/api/vocab/1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
 	rr = httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
-
+	h.delete(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON = fmt.Sprintf(`{
-		"count": 1,
-		"items": [
-			{
-				"id": 2,
-				"term": "apfel kuchen",
-				"translation": "apple cake",
-				"knowledgeLevel": 1,
-				"practiceAt": "%s"
-			}
-		]
-	}`, inDaysJSON(1))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
 
-	req, _ = http.NewRequest("GET", "/api/vocab?term=guten&translation=apple%20cake", nil)
-	rr = httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+	vocabs, err := store.AllVocab()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 0)
+}
 
-	require.Equal(t, http.StatusOK, rr.Code)
-	require.JSONEq(t, `{
-		"count": 0,
-		"items": []
-	}`, rr.Body.String())
+func Test_PracticeHandler_MemoryStore(t *testing.T) {
+	store := newMemoryStore()
+	h := &practiceHandler{stores: oneStore(store), config: DefaultConfig()}
+	require.Nil(t, store.AddVocab([]Vocab{
+		{Term: "foo1", Translation: "bar1", PracticeAt: inDays(-1)},
+		{Term: "foo2", Translation: "bar2", PracticeAt: inDays(2)},
+	}))
 
-	req, _ = http.NewRequest("GET", "/api/vocab?term=guten&translation=apple%20cake&mode=or", nil)
-	rr = httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+	req, _ := http.NewRequest("GET", "/api/practice/count", nil)
+	rr := httptest.NewRecorder()
+	h.getCount(rr, req)
+	require.JSONEq(t, `{"count": 1}`, rr.Body.String())
 
+	req, _ = http.NewRequest("POST", "/api/practice", strings.NewReader(`[{"id": 1, "passed": true}]`))
+	rr = httptest.NewRecorder()
+	h.post(rr, req)
 	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON = fmt.Sprintf(`{
-		"count": 2,
-		"items": [
-			{
-				"id": 2,
-				"term": "apfel kuchen",
-				"translation": "apple cake",
-				"knowledgeLevel": 1,
-				"practiceAt": "%[1]s"
-			},
-			{
-				"id": 1,
-				"term": "guten tag",
-				"translation": "good day",
-				"knowledgeLevel": 1,
-				"practiceAt": "%[1]s"
-			}
-		]
-	}`, inDaysJSON(1))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+
+	vocabs, err := store.AllVocab()
+	require.Nil(t, err)
+	require.Equal(t, uint(1), vocabs[0].KnowledgeLevel)
+	require.True(t, vocabs[0].PracticeAt.Equal(inDays(1)))
 }
 
-func Test_GetVocab_OrderBy(t *testing.T) {
-	db := memoryDb(t)
-	server := NewServer(db)
+func Test_GetPractice(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 3,
-		PracticeAt:     inDays(2),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 5,
-		PracticeAt:     inDays(4),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo3",
-		Translation:    "bar3",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(3),
-	})
-	require.Nil(t, dbResult.Error)
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 2,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo3",
+			Translation:    "bar3",
+			KnowledgeLevel: 4,
+			PracticeAt:     inDays(-1),
+		})
+		require.Nil(t, dbResult.Error)
 
-	req, _ := http.NewRequest("GET", "/api/vocab?order_by=knowledge_level", nil)
-	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+		req, _ := http.NewRequest("GET", "/api/practice", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
 
-	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON := fmt.Sprintf(`{
-		"count": 3,
-		"items": [
+		expectedJSON := fmt.Sprintf(`[
 			{
 				"id": 3,
 				"term": "foo3",
 				"translation": "bar3",
-				"knowledgeLevel": 1,
-				"practiceAt": "%[3]s"
+				"knowledgeLevel": 4,
+				"practiceAt": "%s"
 			},
 			{
 				"id": 1,
 				"term": "foo1",
 				"translation": "bar1",
-				"knowledgeLevel": 3,
-				"practiceAt": "%[1]s"
-			},
-			{
-				"id": 2,
-				"term": "foo2",
-				"translation": "bar2",
-				"knowledgeLevel": 5,
-				"practiceAt": "%[2]s"
+				"knowledgeLevel": 2,
+				"practiceAt": "%s"
 			}
-		]
-	}`, inDaysJSON(2), inDaysJSON(4), inDaysJSON(3))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+		]`, inDaysJSON(-1), inDaysJSON(0))
+		require.JSONEq(t, expectedJSON, rr.Body.String())
+	})
+}
 
-	req, _ = http.NewRequest("GET", "/api/vocab?order_by=knowledge_level_desc", nil)
-	rr = httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+func Test_GetPractice_SessionSize(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		config := DefaultConfig()
+		config.SessionSize = 2
+		server := NewServer(db, config)
 
-	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON = fmt.Sprintf(`{
-		"count": 3,
-		"items": [
+		for i := 0; i < 5; i++ {
+			_, err := NewGormStore(db).CreateVocab(fmt.Sprintf("foo%d", i), "bar")
+			require.Nil(t, err)
+		}
+
+		req, _ := http.NewRequest("GET", "/api/practice", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		vocabs := make([]Vocab, 0)
+		require.Nil(t, json.Unmarshal(rr.Body.Bytes(), &vocabs))
+		require.Len(t, vocabs, 2)
+	})
+}
+
+func Test_GetCountPractice(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 2,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 1,
+			PracticeAt:     inDays(1),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo3",
+			Translation:    "bar3",
+			KnowledgeLevel: 4,
+			PracticeAt:     inDays(-1),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("GET", "/api/practice/count", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.JSONEq(t, `{"count": 2}`, rr.Body.String())
+	})
+}
+
+func Test_PostPractice(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 0,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo2",
+			Translation:    "bar2",
+			KnowledgeLevel: 5,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo3",
+			Translation:    "bar3",
+			KnowledgeLevel: 2,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+		dbResult = db.Create(&Vocab{
+			Term:           "foo4",
+			Translation:    "bar4",
+			KnowledgeLevel: 7,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+
+		var body bytes.Buffer
+		_, err := body.WriteString(`[
 			{
-				"id": 2,
-				"term": "foo2",
-				"translation": "bar2",
-				"knowledgeLevel": 5,
-				"practiceAt": "%[2]s"
+				"id": 1,
+				"passed": false
 			},
 			{
-				"id": 1,
-				"term": "foo1",
-				"translation": "bar1",
-				"knowledgeLevel": 3,
-				"practiceAt": "%[1]s"
+				"id": 2,
+				"passed": false
 			},
 			{
 				"id": 3,
-				"term": "foo3",
-				"translation": "bar3",
-				"knowledgeLevel": 1,
-				"practiceAt": "%[3]s"
+				"passed": true
+			},
+			{
+				"id": 4,
+				"passed": true
 			}
-		]
-	}`, inDaysJSON(2), inDaysJSON(4), inDaysJSON(3))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+		]`)
+		require.Nil(t, err)
 
-	req, _ = http.NewRequest("GET", "/api/vocab?order_by=practice_at", nil)
-	rr = httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+		req, _ := http.NewRequest("POST", "/api/practice", &body)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
 
-	require.Equal(t, http.StatusOK, rr.Code)
-	expectedJSON = fmt.Sprintf(`{
-		"count": 3,
-		"items": [
+		require.Equal(t, http.StatusOK, rr.Code)
+		var practiced []Vocab
+		err = json.Unmarshal(rr.Body.Bytes(), &practiced)
+		require.Nil(t, err)
+		require.Len(t, practiced, 4)
+		require.Equal(t, uint(3), practiced[2].ID)
+		require.Equal(t, uint(3), practiced[2].KnowledgeLevel)
+
+		var v Vocab
+		dbResult = db.First(&v, 1)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, uint(0), v.KnowledgeLevel)
+		require.True(t, v.PracticeAt.Equal(inDays(1)))
+
+		v = Vocab{}
+		dbResult = db.First(&v, 2)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, uint(4), v.KnowledgeLevel)
+		require.True(t, v.PracticeAt.Equal(inDays(1)))
+
+		v = Vocab{}
+		dbResult = db.First(&v, 3)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, uint(3), v.KnowledgeLevel)
+		require.True(t, v.PracticeAt.Equal(inDays(4)))
+
+		v = Vocab{}
+		dbResult = db.First(&v, 4)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, uint(7), v.KnowledgeLevel)
+		require.True(t, v.PracticeAt.Equal(inDays(64)))
+	})
+}
+
+func Test_PostPracticeUndo(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+		dbResult := db.Create(&Vocab{
+			Term:           "foo",
+			Translation:    "bar",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(-2),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("POST", "/api/practice", strings.NewReader(`[{"id": 1, "passed": false}]`))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest("POST", "/api/practice/undo", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, fmt.Sprintf(`[
 			{
 				"id": 1,
-				"term": "foo1",
-				"translation": "bar1",
+				"term": "foo",
+				"translation": "bar",
 				"knowledgeLevel": 3,
-				"practiceAt": "%[1]s"
-			},
-			{
-				"id": 3,
-				"term": "foo3",
-				"translation": "bar3",
-				"knowledgeLevel": 1,
-				"practiceAt": "%[3]s"
-			},
-			{
-				"id": 2,
-				"term": "foo2",
-				"translation": "bar2",
-				"knowledgeLevel": 5,
-				"practiceAt": "%[2]s"
+				"practiceAt": "%s"
 			}
-		]
-	}`, inDaysJSON(2), inDaysJSON(4), inDaysJSON(3))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+		]`, inDaysJSON(-2)), rr.Body.String())
+		var count int64
+		require.Nil(t, db.Model(&Review{}).Count(&count).Error)
+		require.Equal(t, int64(0), count)
+
+		req, _ = http.NewRequest("POST", "/api/practice/undo", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.JSONEq(t, `{"code": "conflict", "message": "nothing to undo"}`, rr.Body.String())
+	})
 }
 
-func Test_PostVocab(t *testing.T) {
-	db := memoryDb(t)
-	server := NewServer(db)
+func Test_PostImportTextPreview(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
 
-	var body bytes.Buffer
-	_, err := body.WriteString(`{
-		"term": "foo",
-		"translation": "bar"
-	}`)
-	require.Nil(t, err)
+		var body bytes.Buffer
+		_, err := body.WriteString(`{
+			"text": "foo1 - bar1;foo2 - bar2",
+			"termSeparator": " - ",
+			"cardSeparator": ";"
+		}`)
+		require.Nil(t, err)
 
-	req, _ := http.NewRequest("POST", "/api/vocab", &body)
-	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+		req, _ := http.NewRequest("POST", "/api/import/text/preview", &body)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
 
-	require.Equal(t, http.StatusOK, rr.Code)
-	require.JSONEq(t, `{"id": 1}`, rr.Body.String())
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `[
+			{"term": "foo1", "translation": "bar1"},
+			{"term": "foo2", "translation": "bar2"}
+		]`, rr.Body.String())
 
-	v := Vocab{}
-	dbResult := db.First(&v)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, "foo", v.Term)
-	require.Equal(t, "bar", v.Translation)
-	require.Equal(t, uint(0), v.KnowledgeLevel)
-	require.True(t, v.PracticeAt.Equal(inDays(0)))
+		var count int64
+		dbResult := db.Model(&Vocab{}).Count(&count)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(0), count)
+	})
 }
 
-func Test_DeleteVocab(t *testing.T) {
-	db := memoryDb(t)
-	server := NewServer(db)
+func Test_PostImportText(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		var body bytes.Buffer
+		_, err := body.WriteString(`{
+			"text": "foo1\tbar1\nfoo2\tbar2\n"
+		}`)
+		require.Nil(t, err)
+
+		req, _ := http.NewRequest("POST", "/api/import/text", &body)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"count": 2}`, rr.Body.String())
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo",
-		Translation:    "bar",
-		KnowledgeLevel: 3,
-		PracticeAt:     inDays(2),
+		var count int64
+		dbResult := db.Model(&Vocab{}).Count(&count)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, int64(2), count)
 	})
-	require.Nil(t, dbResult.Error)
+}
 
-	req, _ := http.NewRequest("DELETE", "/api/vocab/1", nil)
-	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+func Test_PostImportText_BadCard(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
 
-	require.Equal(t, http.StatusOK, rr.Code)
+		var body bytes.Buffer
+		_, err := body.WriteString(`{
+			"text": "foo1\tbar1\nfoo2\n"
+		}`)
+		require.Nil(t, err)
+
+		req, _ := http.NewRequest("POST", "/api/import/text", &body)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
 
-	var rowCount int64
-	dbResult = db.Model(&Vocab{}).Count(&rowCount)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, int64(0), rowCount)
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		require.JSONEq(t, `{"code": "invalid", "message": "text has a bad card, number 2", "field": "text"}`, rr.Body.String())
+	})
 }
 
-func Test_GetPractice(t *testing.T) {
+func Test_PostImportCsv(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		body := "term,translation,knowledge_level,practice_at\n" +
+			"foo1,bar1,3,2021-05-01T00:00:00Z\n" +
+			"foo2,bar2,0,2021-05-02T00:00:00Z\n"
+		req, _ := http.NewRequest("POST", "/api/import/csv", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"count": 2}`, rr.Body.String())
+
+		v := Vocab{}
+		dbResult := db.First(&v)
+		require.Nil(t, dbResult.Error)
+		require.Equal(t, "foo1", v.Term)
+		require.Equal(t, uint(3), v.KnowledgeLevel)
+	})
+}
+
+func Test_PostImportCsv_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		body    string
+		message string
+	}{
+		{"", "csv is empty"},
+		{"term,translation\nfoo,bar\n", "csv is missing the heading knowledge_level"},
+		{"term,translation,knowledge_level,practice_at\nfoo,bar,x,2021-05-01T00:00:00Z\n", "csv has a bad row, number 2, field knowledge_level"},
+	} {
+		server := NewServer(memoryDb(t), DefaultConfig())
+
+		req, _ := http.NewRequest("POST", "/api/import/csv", strings.NewReader(tc.body))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		require.JSONEq(t, fmt.Sprintf(`{"code": "invalid", "message": %q, "field": "csv"}`, tc.message), rr.Body.String())
+	}
+}
+
+func Test_PostSync(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		_, err := NewGormStore(db).CreateVocab("hund", "dog")
+		require.Nil(t, err)
+
+		body := `{"device": "laptop", "changes": [{"type": "vocab", "device": "laptop", "syncId": "abc", "term": "katze", "translation": "cat", "practiceAt": "2021-05-01T00:00:00Z", "editedAt": "2021-04-01T00:00:00Z"}]}`
+		req, _ := http.NewRequest("POST", "/api/sync", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var responseData syncExchange
+		require.Nil(t, json.Unmarshal(rr.Body.Bytes(), &responseData))
+		require.Equal(t, 1, responseData.Merged)
+		require.NotEmpty(t, responseData.Cursor)
+		// Only the changes made here are returned.
+		require.Len(t, responseData.Changes, 1)
+		require.Equal(t, "hund", responseData.Changes[0].Term)
+
+		vocab := findVocab(t, db, "katze")
+		require.Equal(t, "abc", vocab.SyncID)
+	})
+}
+
+func Test_PostSync_Invalid(t *testing.T) {
 	db := memoryDb(t)
-	server := NewServer(db)
+	server := NewServer(db, DefaultConfig())
+	state, err := syncState(db, noUser)
+	require.Nil(t, err)
+
+	for _, tc := range []struct {
+		body    string
+		field   string
+		message string
+	}{
+		{`{}`, "device", "is required"},
+		{`{"device": "laptop", "cursor": "foo"}`, "cursor", "is not a cursor of this server"},
+		{`{"device": "` + state.DeviceID + `"}`, "device", "is the device of this server"},
+		{`{"device": "laptop", "changes": [{"type": "foo", "syncId": "abc"}]}`, "changes[0].type", "must be vocab, review, delete or undo"},
+		{`{"device": "laptop", "changes": [{"type": "delete"}]}`, "changes[0].syncId", "is required"},
+		{`{"device": "laptop", "changes": [{"type": "delete", "syncId": "abc", "deletedAt": "2021-05-01T00:00:00Z"}, {"type": "review", "syncId": "def", "vocabSyncId": "abc"}]}`, "changes[1].createdAt", "is required"},
+	} {
+		req, _ := http.NewRequest("POST", "/api/sync", strings.NewReader(tc.body))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code, tc.body)
+		require.JSONEq(t, fmt.Sprintf(`{"code": "invalid", "message": "%s %s", "field": %q}`, tc.field, tc.message, tc.field), rr.Body.String())
+	}
+}
+
+func Test_GetExport(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 3,
+			PracticeAt:     inDays(2),
+		})
+		require.Nil(t, dbResult.Error)
+
+		req, _ := http.NewRequest("GET", "/api/export?format=md&min_knowledge=2", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "text/markdown; charset=utf-8", rr.Header().Get("Content-Type"))
+		require.Contains(t, rr.Body.String(), "| foo1 | bar1 | 3 |")
+
+		req, _ = http.NewRequest("GET", "/api/export?format=html&max_knowledge=2", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		require.NotContains(t, rr.Body.String(), "foo1")
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 2,
-		PracticeAt:     inDays(0),
+		req, _ = http.NewRequest("GET", "/api/export?format=pdf&cards_per_page=4", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+		require.True(t, strings.HasPrefix(rr.Body.String(), "%PDF-"))
+
+		req, _ = http.NewRequest("GET", "/api/export?format=pdf&font_size=10.5", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest("GET", "/api/export?format=docx", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		for query, field := range map[string]string{
+			"format=md&min_knowledge=-1": "min_knowledge",
+			"format=md&max_knowledge=-1": "max_knowledge",
+			"format=pdf&font_size=-10":   "font_size",
+			"format=pdf&font_size=0":     "font_size",
+		} {
+			req, _ = http.NewRequest("GET", "/api/export?"+query, nil)
+			rr = httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code, query)
+			require.Contains(t, rr.Body.String(), `"field":"`+field+`"`, query)
+		}
 	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
+}
+
+func Test_GetStats(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		server := NewServer(db, DefaultConfig())
+
+		dbResult := db.Create(&Vocab{
+			Term:           "foo1",
+			Translation:    "bar1",
+			KnowledgeLevel: 2,
+			PracticeAt:     inDays(0),
+		})
+		require.Nil(t, dbResult.Error)
+
+		var body bytes.Buffer
+		_, err := body.WriteString(`[{"id": 1, "passed": true}]`)
+		require.Nil(t, err)
+		req, _ := http.NewRequest("POST", "/api/practice", &body)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest("GET", "/api/stats", nil)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{
+			"total": 1,
+			"dueToday": 0,
+			"dueThisWeek": 1,
+			"knowledgeLevels": [0, 0, 0, 1, 0, 0, 0, 0],
+			"last7Days": {"reviews": 1, "passed": 1, "accuracy": 1},
+			"last30Days": {"reviews": 1, "passed": 1, "accuracy": 1},
+			"streak": 1
+		}`, rr.Body.String())
 	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo3",
-		Translation:    "bar3",
-		KnowledgeLevel: 4,
-		PracticeAt:     inDays(-1),
+}
+
+func Test_Accounts(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		config := DefaultConfig()
+		config.Accounts = true
+		server := NewServer(db, config)
+
+		// do makes a request with the session cookie, if any.
+		do := func(method, url, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, url, strings.NewReader(body))
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+			return rr
+		}
+		sessionCookie := func(rr *httptest.ResponseRecorder) *http.Cookie {
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Name == sessionCookieName {
+					return cookie
+				}
+			}
+			return nil
+		}
+
+		rr := do("GET", "/api/vocab", "", nil)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		rr = do("GET", "/api/session", "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"accounts": true, "user": null, "tokenRequired": false}`, rr.Body.String())
+
+		rr = do("POST", "/api/register", `{"username": "alice", "password": "short"}`, nil)
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		rr = do("POST", "/api/register", `{"username": "alice", "password": "password1"}`, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		alice := sessionCookie(rr)
+		require.NotNil(t, alice)
+		require.True(t, alice.HttpOnly)
+		rr = do("POST", "/api/register", `{"username": "alice", "password": "password2"}`, nil)
+		require.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = do("GET", "/api/session", "", alice)
+		require.JSONEq(t, `{"accounts": true, "user": {"id": 1, "username": "alice"}, "tokenRequired": false}`, rr.Body.String())
+		rr = do("POST", "/api/vocab", `{"term": "foo", "translation": "bar"}`, alice)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do("POST", "/api/register", `{"username": "bob", "password": "password1"}`, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		bob := sessionCookie(rr)
+
+		// Bob can't see or change Alice's vocab.
+		rr = do("GET", "/api/vocab", "", bob)
+		require.JSONEq(t, `{"count": 0, "items": []}`, rr.Body.String())
+		rr = do("DELETE", "/api/vocab/1", "", bob)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		rr = do("GET", "/api/practice/count", "", bob)
+		require.JSONEq(t, `{"count": 0}`, rr.Body.String())
+		rr = do("GET", "/api/stats", "", bob)
+		require.Equal(t, http.StatusOK, rr.Code)
+		stats := Stats{}
+		require.Nil(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		require.Equal(t, int64(0), stats.Total)
+		rr = do("GET", "/api/export?format=md", "", bob)
+		require.NotContains(t, rr.Body.String(), "foo")
+
+		rr = do("GET", "/api/vocab", "", alice)
+		require.Contains(t, rr.Body.String(), `"count":1`)
+		rr = do("GET", "/api/practice/count", "", alice)
+		require.JSONEq(t, `{"count": 1}`, rr.Body.String())
+
+		rr = do("POST", "/api/login", `{"username": "alice", "password": "password2"}`, nil)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		rr = do("POST", "/api/login", `{"username": "alice", "password": "password1"}`, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NotNil(t, sessionCookie(rr))
+
+		rr = do("POST", "/api/logout", "", alice)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "", sessionCookie(rr).Value)
+		rr = do("GET", "/api/vocab", "", alice)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		// The local collection isn't served.
+		_, err := NewGormStore(db).CreateVocab("baz", "qux")
+		require.Nil(t, err)
+		rr = do("GET", "/api/vocab", "", bob)
+		require.JSONEq(t, `{"count": 0, "items": []}`, rr.Body.String())
 	})
-	require.Nil(t, dbResult.Error)
+}
+
+func Test_Accounts_Off(t *testing.T) {
+	db := memoryDb(t)
+	server := NewServer(db, DefaultConfig())
 
-	req, _ := http.NewRequest("GET", "/api/practice", nil)
+	req, _ := http.NewRequest("GET", "/api/session", nil)
 	rr := httptest.NewRecorder()
 	server.ServeHTTP(rr, req)
+	require.JSONEq(t, `{"accounts": false, "user": null, "tokenRequired": false}`, rr.Body.String())
 
-	expectedJSON := fmt.Sprintf(`[
-		{
-			"id": 3,
-			"term": "foo3",
-			"translation": "bar3",
-			"knowledgeLevel": 4,
-			"practiceAt": "%s"
-		},
-		{
-			"id": 1,
-			"term": "foo1",
-			"translation": "bar1",
-			"knowledgeLevel": 2,
-			"practiceAt": "%s"
-		}
-	]`, inDaysJSON(-1), inDaysJSON(0))
-	require.JSONEq(t, expectedJSON, rr.Body.String())
+	req, _ = http.NewRequest("POST", "/api/register", strings.NewReader(`{"username": "alice", "password": "password1"}`))
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	var count int64
+	require.Nil(t, db.Model(&User{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
 }
 
-func Test_GetCountPractice(t *testing.T) {
+func Test_RequireToken(t *testing.T) {
 	db := memoryDb(t)
-	server := NewServer(db)
+	config := DefaultConfig()
+	config.RequireToken = true
+	server := NewServer(db, config)
+	token, _, err := createApiToken(db, noUser, "script")
+	require.Nil(t, err)
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 2,
-		PracticeAt:     inDays(0),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 1,
-		PracticeAt:     inDays(1),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo3",
-		Translation:    "bar3",
-		KnowledgeLevel: 4,
-		PracticeAt:     inDays(-1),
-	})
-	require.Nil(t, dbResult.Error)
+	do := func(method, url, body string, prepare func(req *http.Request)) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		if prepare != nil {
+			prepare(req)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+	bearer := func(token string) func(req *http.Request) {
+		return func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
 
-	req, _ := http.NewRequest("GET", "/api/practice/count", nil)
+	rr := do("DELETE", "/api/vocab/1", "", nil)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = do("GET", "/api/vocab", "", bearer("vocab_nope"))
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = do("POST", "/api/vocab", `{"term": "foo", "translation": "bar"}`, bearer(token))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	// The web application is served, and can find out it needs a token.
+	rr = do("GET", "/", "", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = do("GET", "/api/session", "", nil)
+	require.JSONEq(t, `{"accounts": false, "user": null, "tokenRequired": true}`, rr.Body.String())
+
+	rr = do("POST", "/api/token", `{"token": "vocab_nope"}`, nil)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = do("POST", "/api/token", fmt.Sprintf(`{"token": "%s"}`, token), nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, tokenCookieName, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+	require.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+
+	withCookie := func(req *http.Request) {
+		req.AddCookie(cookies[0])
+	}
+	rr = do("GET", "/api/session", "", withCookie)
+	require.JSONEq(t, `{"accounts": false, "user": null, "tokenRequired": false}`, rr.Body.String())
+	rr = do("GET", "/api/export?format=md", "", withCookie)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), "foo")
+
+	// Tokens for users aren't valid without accounts.
+	alice, _, err := createApiToken(db, 1, "alice")
+	require.Nil(t, err)
+	rr = do("GET", "/api/vocab", "", bearer(alice))
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func Test_Accounts_ApiToken(t *testing.T) {
+	db := memoryDb(t)
+	config := DefaultConfig()
+	config.Accounts = true
+	server := NewServer(db, config)
+	alice, err := registerUser(db, "alice", "password1")
+	require.Nil(t, err)
+	_, err = NewUserStore(db, alice.ID).CreateVocab("foo", "bar")
+	require.Nil(t, err)
+	token, _, err := createApiToken(db, alice.ID, "script")
+	require.Nil(t, err)
+	local, _, err := createApiToken(db, noUser, "local")
+	require.Nil(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/vocab", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
 	rr := httptest.NewRecorder()
 	server.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `"count":1`)
 
-	require.JSONEq(t, `{"count": 2}`, rr.Body.String())
+	req, _ = http.NewRequest("GET", "/api/vocab", nil)
+	req.Header.Set("Authorization", "Bearer "+local)
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
 }
 
-func Test_PostPractice(t *testing.T) {
+func Test_ApiErrors(t *testing.T) {
 	db := memoryDb(t)
-	server := NewServer(db)
+	server := NewServer(db, DefaultConfig())
+	_, err := NewGormStore(db).CreateVocab("foo", "bar")
+	require.Nil(t, err)
 
-	dbResult := db.Create(&Vocab{
-		Term:           "foo1",
-		Translation:    "bar1",
-		KnowledgeLevel: 0,
-		PracticeAt:     inDays(0),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo2",
-		Translation:    "bar2",
-		KnowledgeLevel: 5,
-		PracticeAt:     inDays(0),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo3",
-		Translation:    "bar3",
-		KnowledgeLevel: 2,
-		PracticeAt:     inDays(0),
-	})
-	require.Nil(t, dbResult.Error)
-	dbResult = db.Create(&Vocab{
-		Term:           "foo4",
-		Translation:    "bar4",
-		KnowledgeLevel: 7,
-		PracticeAt:     inDays(0),
-	})
-	require.Nil(t, dbResult.Error)
+	cases := []struct {
+		method   string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{"POST", "/api/vocab", `{"term": "foo"`, http.StatusBadRequest, `{"code": "invalid_json", "message": "request body must be valid JSON: unexpected end of JSON input"}`},
+		{"POST", "/api/vocab", `{"term": 1}`, http.StatusBadRequest, `{"code": "invalid_json", "message": "term can't be a JSON number", "field": "term"}`},
+		{"POST", "/api/vocab", `{"term": "foo", "translation": " "}`, http.StatusUnprocessableEntity, `{"code": "invalid", "message": "translation is required", "field": "translation"}`},
+		{"POST", "/api/vocab", `{"term": "` + strings.Repeat("a", maxRequestBytes) + `"}`, http.StatusRequestEntityTooLarge, fmt.Sprintf(`{"code": "too_large", "message": "request body must be at most %d bytes"}`, maxRequestBytes)},
+		{"DELETE", "/api/vocab/2", ``, http.StatusNotFound, `{"code": "not_found", "message": "vocab not found"}`},
+		{"POST", "/api/practice", `{"id": 1}`, http.StatusBadRequest, `{"code": "invalid_json", "message": "request body can't be a JSON object"}`},
+		{"POST", "/api/practice", `[{"id": 1, "passed": true}, {"passed": true}]`, http.StatusUnprocessableEntity, `{"code": "invalid", "message": "[1].id is required", "field": "[1].id"}`},
+		{"POST", "/api/practice", `[{"id": 1}]`, http.StatusUnprocessableEntity, `{"code": "invalid", "message": "[0].passed is required", "field": "[0].passed"}`},
+		{"POST", "/api/practice", `[{"id": 1, "passed": true}, {"id": 2, "passed": true}]`, http.StatusNotFound, `{"code": "not_found", "message": "vocab not found"}`},
+		{"POST", "/api/import/text", `{"text": ""}`, http.StatusUnprocessableEntity, `{"code": "invalid", "message": "text has no vocab", "field": "text"}`},
+		{"GET", "/api/export?format=docx", ``, http.StatusBadRequest, `{"code": "bad_request", "message": "format must be one of csv, md, html, pdf", "field": "format"}`},
+		{"GET", "/api/nope", ``, http.StatusNotFound, `{"code": "not_found", "message": "no such endpoint: GET /api/nope"}`},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
 
-	var body bytes.Buffer
-	_, err := body.WriteString(`[
-		{
-			"id": 1,
-			"passed": false
-		},
-		{
-			"id": 2,
-			"passed": false
-		},
-		{
-			"id": 3,
-			"passed": true
-		},
-		{
-			"id": 4,
-			"passed": true
+		require.Equal(t, c.status, rr.Code, c.body)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.JSONEq(t, c.expected, rr.Body.String())
+	}
+
+	// Reviews are recorded together, so none were for the unknown vocab.
+	var count int64
+	require.Nil(t, db.Model(&Review{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+}
+
+func Test_ErrorHandlingMiddleware(t *testing.T) {
+	handler := errorHandlingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(errors.New("database is locked"))
+	}))
+	req, _ := http.NewRequest("GET", "/api/vocab", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.JSONEq(t, `{"code": "internal", "message": "Oops, something went wrong..."}`, rr.Body.String())
+
+	// Expected errors are passed on.
+	handler = errorHandlingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(ErrVocabNotFound)
+	}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func Test_SpaHandler(t *testing.T) {
+	h := spaHandler{files: fstest.MapFS{
+		"index.html":           {Data: []byte("<html></html>")},
+		"index.js":             {Data: []byte("// app")},
+		"vendor/vue-3.2.47.js": {Data: []byte("// vue")},
+	}}
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, path := range []string{"/", "/practice", "/trash"} {
+		rr := get(path)
+		require.Equal(t, http.StatusOK, rr.Code, path)
+		require.Equal(t, "<html></html>", rr.Body.String(), path)
+	}
+
+	rr := get("/index.js")
+	require.Equal(t, "// app", rr.Body.String())
+	require.Equal(t, "", rr.Header().Get("Cache-Control"))
+
+	// Vendored libraries are cached for good, and missing ones aren't
+	// answered with index.html.
+	rr = get("/vendor/vue-3.2.47.js")
+	require.Equal(t, "// vue", rr.Body.String())
+	require.Equal(t, "public, max-age=31536000, immutable", rr.Header().Get("Cache-Control"))
+	rr = get("/vendor/vue-3.2.46.js")
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// vendoredScripts returns the scripts of the libraries index.html loads,
+// by path, with their integrity hashes.
+func vendoredScripts(t *testing.T, index []byte) map[string]string {
+	scripts := make(map[string]string)
+	for _, tag := range regexp.MustCompile(`<script[^>]*>`).FindAllString(string(index), -1) {
+		src := regexp.MustCompile(`src="(/vendor/[^"]+)"`).FindStringSubmatch(tag)
+		if src == nil {
+			continue
 		}
-	]`)
+		integrity := regexp.MustCompile(`integrity="sha384-([^"]+)"`).FindStringSubmatch(tag)
+		require.NotNil(t, integrity, "%s has no integrity hash", src[1])
+		scripts[src[1]] = integrity[1]
+	}
+	return scripts
+}
+
+// index.html works offline: everything it loads is served by vocab, and the
+// vendored libraries match their integrity hashes.
+func Test_IndexHtml_LocalAssets(t *testing.T) {
+	index, err := fs.ReadFile(www, "www/index.html")
 	require.Nil(t, err)
 
-	req, _ := http.NewRequest("POST", "/api/practice", &body)
-	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+	refs := regexp.MustCompile(`(?:src|href)="([^"]*)"`).FindAllStringSubmatch(string(index), -1)
+	require.NotEmpty(t, refs)
+	for _, ref := range refs {
+		require.NotRegexp(t, `^(?:https?:)?//`, ref[1], "index.html references an external origin")
+		require.True(t, strings.HasPrefix(ref[1], "/"), ref[1])
+		_, err := fs.Stat(www, "www"+ref[1])
+		require.Nil(t, err, ref[1])
+	}
 
-	require.Equal(t, http.StatusOK, rr.Code)
+	scripts := vendoredScripts(t, index)
+	require.NotEmpty(t, scripts, "index.html loads no vendored libraries. run go generate")
+	for src, integrity := range scripts {
+		b, err := fs.ReadFile(www, "www"+src)
+		require.Nil(t, err, src)
+		sum := sha512.Sum384(b)
+		require.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), integrity, src)
+	}
+}
+
+// The vendored libraries are cached for good, whether served from the
+// repository or from the binary.
+func Test_Server_VendoredFiles(t *testing.T) {
+	index, err := fs.ReadFile(www, "www/index.html")
+	require.Nil(t, err)
+	scripts := vendoredScripts(t, index)
+	require.NotEmpty(t, scripts, "index.html loads no vendored libraries. run go generate")
 
-	var v Vocab
-	dbResult = db.First(&v, 1)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, uint(0), v.KnowledgeLevel)
-	require.True(t, v.PracticeAt.Equal(inDays(1)))
-
-	v = Vocab{}
-	dbResult = db.First(&v, 2)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, uint(4), v.KnowledgeLevel)
-	require.True(t, v.PracticeAt.Equal(inDays(1)))
-
-	v = Vocab{}
-	dbResult = db.First(&v, 3)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, uint(3), v.KnowledgeLevel)
-	require.True(t, v.PracticeAt.Equal(inDays(4)))
-
-	v = Vocab{}
-	dbResult = db.First(&v, 4)
-	require.Nil(t, dbResult.Error)
-	require.Equal(t, uint(7), v.KnowledgeLevel)
-	require.True(t, v.PracticeAt.Equal(inDays(64)))
+	for name, files := range map[string]fs.FS{"repository": wwwFiles(), "binary": embeddedWwwFiles()} {
+		h := spaHandler{files: files}
+		for src := range scripts {
+			req, _ := http.NewRequest("GET", src, nil)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, name+" "+src)
+			require.Equal(t, "public, max-age=31536000, immutable", rr.Header().Get("Cache-Control"), name+" "+src)
+			b, err := fs.ReadFile(www, "www"+src)
+			require.Nil(t, err)
+			require.Equal(t, b, rr.Body.Bytes(), name+" "+src)
+		}
+	}
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Stats struct {
+	Total       int64 `json:"total"`
+	DueToday    int64 `json:"dueToday"`
+	DueThisWeek int64 `json:"dueThisWeek"`
+	// KnowledgeLevels is the number of vocab at each knowledge level, from 0
+	// to maxKnowledge.
+	KnowledgeLevels []int64     `json:"knowledgeLevels"`
+	Last7Days       ReviewStats `json:"last7Days"`
+	Last30Days      ReviewStats `json:"last30Days"`
+	// Streak is the number of consecutive days, up to today, with at least one
+	// review. Today not having been practised yet doesn't break the streak.
+	Streak int `json:"streak"`
+}
+
+type ReviewStats struct {
+	Reviews  int64   `json:"reviews"`
+	Passed   int64   `json:"passed"`
+	Accuracy float64 `json:"accuracy"`
+}
+
+func computeStats(db *gorm.DB) (*Stats, error) {
+	stats := &Stats{
+		KnowledgeLevels: make([]int64, maxKnowledge+1),
+	}
+
+	dbResult := db.Model(&Vocab{}).Count(&stats.Total)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	dbResult = db.Model(&Vocab{}).Where("practice_at < ?", inDays(1)).Count(&stats.DueToday)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	dbResult = db.Model(&Vocab{}).Where("practice_at < ?", inDays(7)).Count(&stats.DueThisWeek)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+
+	levels := make([]struct {
+		KnowledgeLevel uint
+		Count          int64
+	}, 0)
+	dbResult = db.Model(&Vocab{}).
+		Select("knowledge_level, count(*) as count").
+		Group("knowledge_level").
+		Scan(&levels)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	for _, level := range levels {
+		if level.KnowledgeLevel <= maxKnowledge {
+			stats.KnowledgeLevels[level.KnowledgeLevel] = level.Count
+		}
+	}
+
+	var err error
+	stats.Last7Days, err = reviewStats(db, inDays(-6))
+	if err != nil {
+		return nil, err
+	}
+	stats.Last30Days, err = reviewStats(db, inDays(-29))
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Streak, err = reviewStreak(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// streakWindow is the number of days of reviews reviewStreak loads at a time.
+const streakWindow = 30
+
+// reviewStreak returns the streak of the reviews, walking back through them a
+// window at a time and stopping at the first day without any, so it doesn't
+// load the whole history.
+func reviewStreak(db *gorm.DB) (int, error) {
+	// days holds the days with reviews, the latest first.
+	days := make([]time.Time, 0)
+	end := inDays(1)
+	for {
+		start := end.AddDate(0, 0, -streakWindow)
+		times := make([]time.Time, 0)
+		dbResult := db.Model(&Review{}).
+			Where("created_at >= ? and created_at < ?", start, end).
+			Order("created_at desc").
+			Pluck("created_at", &times)
+		if dbResult.Error != nil {
+			return 0, dbResult.Error
+		}
+		for _, t := range times {
+			day := dayOf(t)
+			if len(days) == 0 || !day.Equal(days[len(days)-1]) {
+				days = append(days, day)
+			}
+		}
+
+		// The streak goes on before the window only if it covers every day
+		// with reviews, back to the start of the window.
+		n := streak(days)
+		if n < len(days) || len(days) == 0 || !days[len(days)-1].Equal(start) {
+			return n, nil
+		}
+		end = start
+	}
+}
+
+// reviewStats summarises the reviews made since the given time.
+func reviewStats(db *gorm.DB, since time.Time) (ReviewStats, error) {
+	var rs ReviewStats
+	dbResult := db.Model(&Review{}).Where("created_at >= ?", since).Count(&rs.Reviews)
+	if dbResult.Error != nil {
+		return rs, dbResult.Error
+	}
+	dbResult = db.Model(&Review{}).Where("created_at >= ? and passed = ?", since, true).Count(&rs.Passed)
+	if dbResult.Error != nil {
+		return rs, dbResult.Error
+	}
+	if rs.Reviews > 0 {
+		rs.Accuracy = float64(rs.Passed) / float64(rs.Reviews)
+	}
+	return rs, nil
+}
+
+// streak returns the streak of the reviews made at the given times, the
+// latest first.
+func streak(times []time.Time) int {
+	// Walk back through the reviews a day at a time, stopping at the first
+	// day without any. next is the day, relative to today, that continues
+	// the streak.
+	streak := 0
+	next := 0
+	for _, t := range times {
+		day := daysUntil(dayOf(t))
+		if day > next {
+			continue
+		}
+		if day == next {
+			streak++
+			next--
+			continue
+		}
+		if streak == 0 && day == -1 {
+			streak = 1
+			next = -2
+			continue
+		}
+		break
+	}
+	return streak
+}
+
+// dayOf returns the start of the local day of t.
+func dayOf(t time.Time) time.Time {
+	year, month, day := t.Local().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+func printStats(w io.Writer, stats *Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "total\t%d\n", stats.Total)
+	fmt.Fprintf(tw, "due today\t%d\n", stats.DueToday)
+	fmt.Fprintf(tw, "due this week\t%d\n", stats.DueThisWeek)
+	fmt.Fprintf(tw, "streak\t%d days\n", stats.Streak)
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "reviews\tcount\taccuracy")
+	fmt.Fprintf(tw, "last 7 days\t%d\t%.0f%%\n", stats.Last7Days.Reviews, stats.Last7Days.Accuracy*100)
+	fmt.Fprintf(tw, "last 30 days\t%d\t%.0f%%\n", stats.Last30Days.Reviews, stats.Last30Days.Accuracy*100)
+	fmt.Fprintln(tw)
+
+	var most int64
+	for _, count := range stats.KnowledgeLevels {
+		if count > most {
+			most = count
+		}
+	}
+	fmt.Fprintln(tw, "knowledge\tcount\t")
+	for level, count := range stats.KnowledgeLevels {
+		bar := ""
+		if most > 0 {
+			bar = strings.Repeat("#", int(count*30/most))
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\n", level, count, bar)
+	}
+	return tw.Flush()
+}
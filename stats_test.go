@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ComputeStats(t *testing.T) {
+	db := memoryDb(t)
+
+	for _, vocab := range []Vocab{
+		{Term: "foo1", Translation: "bar1", KnowledgeLevel: 0, PracticeAt: inDays(-1)},
+		{Term: "foo2", Translation: "bar2", KnowledgeLevel: 1, PracticeAt: inDays(0)},
+		{Term: "foo3", Translation: "bar3", KnowledgeLevel: 3, PracticeAt: inDays(3)},
+		{Term: "foo4", Translation: "bar4", KnowledgeLevel: 7, PracticeAt: inDays(64)},
+		{Term: "foo5", Translation: "bar5", KnowledgeLevel: 3, PracticeAt: inDays(6)},
+	} {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+
+	for _, review := range []Review{
+		{VocabID: 1, Passed: true, CreatedAt: time.Now()},
+		{VocabID: 2, Passed: false, CreatedAt: time.Now()},
+		{VocabID: 1, Passed: true, CreatedAt: inDays(-1).Add(time.Hour)},
+		{VocabID: 3, Passed: true, CreatedAt: inDays(-2).Add(time.Hour)},
+		{VocabID: 3, Passed: false, CreatedAt: inDays(-10)},
+		{VocabID: 4, Passed: true, CreatedAt: inDays(-40)},
+	} {
+		dbResult := db.Create(&review)
+		require.Nil(t, dbResult.Error)
+	}
+
+	stats, err := computeStats(db)
+	require.Nil(t, err)
+	require.Equal(t, &Stats{
+		Total:           5,
+		DueToday:        2,
+		DueThisWeek:     4,
+		KnowledgeLevels: []int64{1, 1, 0, 2, 0, 0, 0, 1},
+		Last7Days:       ReviewStats{Reviews: 4, Passed: 3, Accuracy: 0.75},
+		Last30Days:      ReviewStats{Reviews: 5, Passed: 3, Accuracy: 0.6},
+		Streak:          3,
+	}, stats)
+}
+
+// The streak is found a window at a time, stopping at the first day without
+// reviews.
+func Test_ComputeStats_LongStreak(t *testing.T) {
+	db := memoryDb(t)
+
+	_, err := NewGormStore(db).CreateVocab("foo", "bar")
+	require.Nil(t, err)
+	for day := -1; day >= -50; day-- {
+		if day == -45 {
+			continue
+		}
+		for _, hour := range []time.Duration{1, 2} {
+			dbResult := db.Create(&Review{VocabID: 1, Passed: true, CreatedAt: inDays(day).Add(hour * time.Hour)})
+			require.Nil(t, dbResult.Error)
+		}
+	}
+
+	stats, err := computeStats(db)
+	require.Nil(t, err)
+	require.Equal(t, 44, stats.Streak)
+}
+
+func Test_Streak(t *testing.T) {
+	cases := []struct {
+		days     []int
+		expected int
+	}{
+		{[]int{}, 0},
+		{[]int{0}, 1},
+		{[]int{0, 0, -1, -2, -4}, 3},
+		{[]int{-1, -2}, 2},
+		{[]int{-2, -3}, 0},
+		{[]int{1, 0}, 1},
+	}
+
+	for _, c := range cases {
+		times := make([]time.Time, 0, len(c.days))
+		for _, day := range c.days {
+			times = append(times, inDays(day).Add(time.Hour))
+		}
+		require.Equal(t, c.expected, streak(times), c.days)
+	}
+}
+
+func Test_RecordPractice_Review(t *testing.T) {
+	db := memoryDb(t)
+
+	_, err := NewGormStore(db).CreateVocab("foo", "bar")
+	require.Nil(t, err)
+
+	_, err = NewGormStore(db).RecordReview(DefaultConfig(), 1, true)
+	require.Nil(t, err)
+
+	reviews := make([]Review, 0)
+	dbResult := db.Find(&reviews)
+	require.Nil(t, dbResult.Error)
+	require.Len(t, reviews, 1)
+	require.Equal(t, uint(1), reviews[0].VocabID)
+	require.True(t, reviews[0].Passed)
+
+	_, err = NewGormStore(db).RecordReview(DefaultConfig(), 2, true)
+	require.NotNil(t, err)
+}
+
+func Test_PrintStats(t *testing.T) {
+	stats := &Stats{
+		Total:           4,
+		DueToday:        2,
+		DueThisWeek:     3,
+		KnowledgeLevels: []int64{2, 1, 0, 0, 0, 0, 0, 1},
+		Last7Days:       ReviewStats{Reviews: 4, Passed: 3, Accuracy: 0.75},
+		Last30Days:      ReviewStats{Reviews: 5, Passed: 3, Accuracy: 0.6},
+		Streak:          3,
+	}
+
+	var buf bytes.Buffer
+	err := printStats(&buf, stats)
+	require.Nil(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "due today      2\n")
+	require.Contains(t, output, "streak         3 days\n")
+	require.Contains(t, output, "last 7 days   4      75%\n")
+	require.Contains(t, output, "0          2      ##############################\n")
+	require.Contains(t, output, "1          1      ###############\n")
+}
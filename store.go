@@ -0,0 +1,448 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVocabNotFound = errors.New("vocab not found")
+	ErrNothingToUndo = errors.New("nothing to undo")
+)
+
+// Store keeps the vocab and the reviews of their practice. The handlers, the
+// importers, the exports and the CLI work through a Store, so they don't
+// depend on how the vocab is kept. gormStore is the default; memoryStore is a
+// fake for tests. Sync is left out on purpose: it merges the rows, sync IDs
+// and tombstones of the database, so it works on a *gorm.DB.
+type Store interface {
+	// FindVocab returns the page of vocab matching the query, taking at most
+	// maxTake, and the total number of matches.
+	FindVocab(vq VocabQuery, maxTake int) ([]Vocab, int64, error)
+	// AllVocab returns all vocab in the order it was added.
+	AllVocab() ([]Vocab, error)
+	// KnowledgeVocab returns the vocab with a knowledge level from minLevel
+	// to maxLevel, in the order it was added.
+	KnowledgeVocab(minLevel, maxLevel uint) ([]Vocab, error)
+	// CreateVocab adds new vocab, due for practice today.
+	CreateVocab(term, translation string) (*Vocab, error)
+	// AddVocab adds vocab as given, e.g. when importing.
+	AddVocab(vocabs []Vocab) error
+	// UpdateVocab changes the term and translation of the vocab with the
+	// given ID, keeping its knowledge level and practice schedule.
+	UpdateVocab(id uint, term, translation string) (*Vocab, error)
+	// DeleteVocab moves the vocab with the given ID to the trash, returning
+	// false if there was no such vocab.
+	DeleteVocab(id uint) (bool, error)
+	// DeleteAllVocab deletes all vocab for good, including the trash, and
+	// the reviews of its practice, e.g. before a clean import.
+	DeleteAllVocab() error
+	// TrashedVocab returns the vocab in the trash, the last deleted first.
+	TrashedVocab() ([]Vocab, error)
+	// RestoreVocab moves the vocab with the given ID out of the trash,
+	// returning ErrVocabNotFound if it isn't in the trash.
+	RestoreVocab(id uint) (*Vocab, error)
+	// DueVocab returns up to limit vocab due for practice, the most overdue
+	// first.
+	DueVocab(limit int) ([]Vocab, error)
+	CountDueVocab() (int64, error)
+	// RecordReview schedules the vocab with the given ID, saves it and
+	// records the review.
+	RecordReview(config *Config, id uint, passed bool) (*Vocab, error)
+	// RecordReviews records the answers of a practice session together, so
+	// that they're undone together, returning the vocab in the order of the
+	// answers. None are recorded if a vocab isn't found.
+	RecordReviews(config *Config, answers []Answer) ([]Vocab, error)
+	// UndoPractice undoes the reviews recorded together most recently, e.g.
+	// the results of a practice session, returning the vocab with the
+	// knowledge level and practice schedule it had before them. It returns
+	// ErrNothingToUndo if the latest review can't be undone.
+	UndoPractice() ([]Vocab, error)
+	// Stats summarises the vocab and its practice.
+	Stats() (*Stats, error)
+	// Transaction runs fn with a Store whose changes are kept only if fn
+	// returns nil.
+	Transaction(fn func(tx Store) error) error
+}
+
+// Answer is the result of practising the vocab with the given ID.
+type Answer struct {
+	VocabID uint
+	Passed  bool
+}
+
+type gormStore struct {
+	// db only sees the rows of the user.
+	db     *gorm.DB
+	userID uint
+	// batch is the batch of the reviews recorded in a transaction, or ""
+	// outside one.
+	batch string
+}
+
+// NewGormStore returns a Store of the local collection.
+func NewGormStore(db *gorm.DB) Store {
+	return NewUserStore(db, noUser)
+}
+
+// NewUserStore returns a Store of the collection of the user with the given
+// ID.
+func NewUserStore(db *gorm.DB, userID uint) Store {
+	return &gormStore{db: forUser(db, userID), userID: userID}
+}
+
+func (s *gormStore) FindVocab(vq VocabQuery, maxTake int) ([]Vocab, int64, error) {
+	q := s.db.Model(&Vocab{})
+
+	// like is case sensitive in PostgreSQL but not SQLite, so compare both
+	// sides in lower case.
+	if vq.Term != "" && vq.Translation != "" {
+		if vq.Mode == "or" {
+			q = q.Where("lower(term) like lower(?) or lower(translation) like lower(?)", like(vq.Term), like(vq.Translation))
+		} else {
+			q = q.Where("lower(term) like lower(?) and lower(translation) like lower(?)", like(vq.Term), like(vq.Translation))
+		}
+	} else if vq.Term != "" {
+		q = q.Where("lower(term) like lower(?)", like(vq.Term))
+	} else if vq.Translation != "" {
+		q = q.Where("lower(translation) like lower(?)", like(vq.Translation))
+	}
+
+	var count int64
+	dbResult := q.Count(&count)
+	if dbResult.Error != nil {
+		return nil, 0, dbResult.Error
+	}
+
+	orderBy := "term"
+	if vq.OrderBy == "knowledge_level" {
+		orderBy = "knowledge_level"
+	} else if vq.OrderBy == "knowledge_level_desc" {
+		orderBy = "knowledge_level desc"
+	} else if vq.OrderBy == "practice_at" {
+		orderBy = "practice_at"
+	} else if vq.OrderBy == "practice_at_desc" {
+		orderBy = "practice_at desc"
+	}
+
+	// Rows that tie aren't returned in any particular order by PostgreSQL, so
+	// finish with the ID to keep paging stable.
+	vocabs := make([]Vocab, 0)
+	dbResult = q.
+		Order(orderBy + ", term, id").
+		Offset(vq.Skip).
+		Limit(min(vq.Take, maxTake)).
+		Find(&vocabs)
+	if dbResult.Error != nil {
+		return nil, 0, dbResult.Error
+	}
+	return vocabs, count, nil
+}
+
+func (s *gormStore) AllVocab() ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	dbResult := s.db.Order("id").Find(&vocabs)
+	return vocabs, dbResult.Error
+}
+
+func (s *gormStore) KnowledgeVocab(minLevel, maxLevel uint) ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	dbResult := s.db.Where("knowledge_level between ? and ?", minLevel, maxLevel).Order("id").Find(&vocabs)
+	return vocabs, dbResult.Error
+}
+
+func (s *gormStore) CreateVocab(term, translation string) (*Vocab, error) {
+	vocab := &Vocab{
+		UserID:         s.userID,
+		Term:           term,
+		Translation:    translation,
+		KnowledgeLevel: 0,
+		PracticeAt:     inDays(0),
+	}
+	dbResult := s.db.Create(vocab)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	return vocab, nil
+}
+
+func (s *gormStore) AddVocab(vocabs []Vocab) error {
+	if len(vocabs) == 0 {
+		return nil
+	}
+	for idx := range vocabs {
+		vocabs[idx].UserID = s.userID
+	}
+	dbResult := s.db.CreateInBatches(&vocabs, defaultImportBatchSize)
+	return dbResult.Error
+}
+
+func (s *gormStore) UpdateVocab(id uint, term, translation string) (*Vocab, error) {
+	vocab, err := s.vocab(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	vocab.Term = term
+	vocab.Translation = translation
+	vocab.EditedAt = time.Now()
+	dbResult := s.db.Save(vocab)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	return vocab, nil
+}
+
+// DeleteVocab deletes the vocab, leaving a tombstone so the deletion can be
+// synced.
+func (s *gormStore) DeleteVocab(id uint) (bool, error) {
+	found := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		vocabs := make([]Vocab, 0)
+		dbResult := tx.Where("id = ?", id).Limit(1).Find(&vocabs)
+		if dbResult.Error != nil || len(vocabs) == 0 {
+			return dbResult.Error
+		}
+		found = true
+
+		dbResult = tx.Delete(&vocabs[0])
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		return tx.Create(&Tombstone{UserID: s.userID, SyncID: vocabs[0].SyncID, Type: changeDelete, DeletedAt: time.Now()}).Error
+	})
+	return found, err
+}
+
+func (s *gormStore) DeleteAllVocab() error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		syncIDs := make([]string, 0)
+		dbResult := tx.Model(&Vocab{}).Pluck("sync_id", &syncIDs)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		now := time.Now()
+		tombstones := make([]Tombstone, 0, len(syncIDs))
+		for _, syncID := range syncIDs {
+			tombstones = append(tombstones, Tombstone{UserID: s.userID, SyncID: syncID, Type: changeDelete, DeletedAt: now})
+		}
+		if len(tombstones) > 0 {
+			dbResult = tx.CreateInBatches(&tombstones, defaultImportBatchSize)
+			if dbResult.Error != nil {
+				return dbResult.Error
+			}
+		}
+
+		dbResult = tx.Where("1 = 1").Delete(&Review{})
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		return tx.Unscoped().Where("1 = 1").Delete(&Vocab{}).Error
+	})
+}
+
+func (s *gormStore) TrashedVocab() ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	dbResult := s.db.Unscoped().Where("deleted_at is not null").Order("deleted_at desc, id desc").Find(&vocabs)
+	return vocabs, dbResult.Error
+}
+
+func (s *gormStore) RestoreVocab(id uint) (*Vocab, error) {
+	vocab := Vocab{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		vocabs := make([]Vocab, 0)
+		dbResult := tx.Unscoped().Where("id = ? and deleted_at is not null", id).Limit(1).Find(&vocabs)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		if len(vocabs) == 0 {
+			return ErrVocabNotFound
+		}
+		vocab = vocabs[0]
+
+		// A later edit wins over the deletion on the devices it's synced to.
+		now := time.Now()
+		vocab.DeletedAt = gorm.DeletedAt{}
+		vocab.EditedAt = now
+		vocab.UpdatedAt = now
+		return tx.Unscoped().Model(&vocab).UpdateColumns(map[string]interface{}{
+			"deleted_at": nil,
+			"edited_at":  now,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &vocab, nil
+}
+
+func (s *gormStore) DueVocab(limit int) ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	dbResult := s.db.
+		Model(&Vocab{}).
+		Where("practice_at < ?", time.Now()).
+		Order("practice_at, id").
+		Limit(limit).
+		Find(&vocabs)
+	return vocabs, dbResult.Error
+}
+
+func (s *gormStore) CountDueVocab() (int64, error) {
+	var count int64
+	dbResult := s.db.
+		Model(&Vocab{}).
+		Where("practice_at < ?", time.Now()).
+		Count(&count)
+	return count, dbResult.Error
+}
+
+func (s *gormStore) RecordReview(config *Config, id uint, passed bool) (*Vocab, error) {
+	var vocab *Vocab
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		vocab, err = s.vocab(tx, id)
+		if err != nil {
+			return err
+		}
+		batch := s.batch
+		if batch == "" {
+			batch, err = newSyncID()
+			if err != nil {
+				return err
+			}
+		}
+		previousPracticeAt := vocab.PracticeAt
+		review := &Review{
+			UserID:                 s.userID,
+			VocabID:                vocab.ID,
+			Passed:                 passed,
+			Batch:                  batch,
+			PreviousKnowledgeLevel: vocab.KnowledgeLevel,
+			PreviousPracticeAt:     &previousPracticeAt,
+		}
+
+		schedule(config, vocab, passed)
+		now := time.Now()
+		vocab.ReviewedAt = &now
+
+		dbResult := tx.Save(vocab)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+
+		dbResult = tx.Create(review)
+		return dbResult.Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vocab, nil
+}
+
+func (s *gormStore) RecordReviews(config *Config, answers []Answer) ([]Vocab, error) {
+	return recordReviews(s, config, answers)
+}
+
+// recordReviews records the answers in a transaction of the store, which
+// batches the reviews.
+func recordReviews(store Store, config *Config, answers []Answer) ([]Vocab, error) {
+	vocabs := make([]Vocab, 0, len(answers))
+	err := store.Transaction(func(tx Store) error {
+		for _, answer := range answers {
+			vocab, err := tx.RecordReview(config, answer.VocabID, answer.Passed)
+			if err != nil {
+				return err
+			}
+			vocabs = append(vocabs, *vocab)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vocabs, nil
+}
+
+func (s *gormStore) UndoPractice() ([]Vocab, error) {
+	vocabs := make([]Vocab, 0)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		latest := make([]Review, 0)
+		dbResult := tx.Order("id desc").Limit(1).Find(&latest)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		// Reviews from other devices, or from before reviews were
+		// batched, can't be undone.
+		if len(latest) == 0 || latest[0].Batch == "" {
+			return ErrNothingToUndo
+		}
+		reviews := make([]Review, 0)
+		dbResult = tx.Where("batch = ?", latest[0].Batch).Order("id desc").Find(&reviews)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+
+		// From the last review to the first, so vocab reviewed more than
+		// once goes back to before the first. Undoing counts as practice, so
+		// it wins over the reviews on the devices they were synced to.
+		now := time.Now()
+		ids := make([]uint, 0, len(reviews))
+		tombstones := make([]Tombstone, 0, len(reviews))
+		for _, review := range reviews {
+			dbResult = tx.Unscoped().Model(&Vocab{}).Where("id = ?", review.VocabID).UpdateColumns(map[string]interface{}{
+				"knowledge_level": review.PreviousKnowledgeLevel,
+				"practice_at":     review.PreviousPracticeAt,
+				"reviewed_at":     now,
+				"updated_at":      now,
+			})
+			if dbResult.Error != nil {
+				return dbResult.Error
+			}
+			ids = append(ids, review.VocabID)
+			tombstones = append(tombstones, Tombstone{UserID: s.userID, SyncID: review.SyncID, Type: changeUndo, DeletedAt: now})
+		}
+		dbResult = tx.Where("batch = ?", latest[0].Batch).Delete(&Review{})
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		// So the reviews aren't synced back from the devices that have them.
+		dbResult = tx.Create(&tombstones)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		return tx.Where("id in ?", ids).Order("id").Find(&vocabs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vocabs, nil
+}
+
+func (s *gormStore) Stats() (*Stats, error) {
+	return computeStats(s.db)
+}
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	batch, err := newSyncID()
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx, userID: s.userID, batch: batch})
+	})
+}
+
+func (s *gormStore) vocab(db *gorm.DB, id uint) (*Vocab, error) {
+	vocab := &Vocab{}
+	dbResult := db.First(vocab, id)
+	if errors.Is(dbResult.Error, gorm.ErrRecordNotFound) {
+		return nil, ErrVocabNotFound
+	}
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	return vocab, nil
+}
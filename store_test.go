@@ -0,0 +1,461 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// stores are the Store implementations, each of which must pass the tests
+// below.
+var stores = map[string]func(t *testing.T) Store{
+	"gorm": func(t *testing.T) Store {
+		return NewGormStore(memoryDb(t))
+	},
+	"postgres": func(t *testing.T) Store {
+		return NewGormStore(postgresDb(t))
+	},
+	"memory": func(t *testing.T) Store {
+		return newMemoryStore()
+	},
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			test(t, newStore(t))
+		})
+	}
+}
+
+func Test_Store_FindVocab(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		for i := 1; i <= 60; i++ {
+			_, err := store.CreateVocab(fmt.Sprintf("foo%02d", i), fmt.Sprintf("bar%02d", i))
+			require.Nil(t, err)
+		}
+
+		vq := NewVocabQuery()
+		vocabs, count, err := store.FindVocab(vq, 50)
+		require.Nil(t, err)
+		require.Equal(t, int64(60), count)
+		require.Len(t, vocabs, 10)
+		require.Equal(t, "foo01", vocabs[0].Term)
+
+		vq.Take = 100
+		vocabs, _, err = store.FindVocab(vq, 50)
+		require.Nil(t, err)
+		require.Len(t, vocabs, 50)
+
+		vocabs, _, err = store.FindVocab(vq, 20)
+		require.Nil(t, err)
+		require.Len(t, vocabs, 20)
+
+		vq = NewVocabQuery()
+		vq.Term = "FOO1"
+		vq.Translation = "bar2"
+		vocabs, count, err = store.FindVocab(vq, 50)
+		require.Nil(t, err)
+		require.Equal(t, int64(0), count)
+		require.Len(t, vocabs, 0)
+
+		vq.Mode = "or"
+		vq.Skip = 5
+		vocabs, count, err = store.FindVocab(vq, 50)
+		require.Nil(t, err)
+		require.Equal(t, int64(20), count)
+		require.Equal(t, "foo15", vocabs[0].Term)
+	})
+}
+
+func Test_Store_FindVocab_OrderBy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		require.Nil(t, store.AddVocab([]Vocab{
+			{Term: "b", Translation: "b", KnowledgeLevel: 1, PracticeAt: inDays(3)},
+			{Term: "a", Translation: "a", KnowledgeLevel: 2, PracticeAt: inDays(1)},
+			{Term: "c", Translation: "c", KnowledgeLevel: 1, PracticeAt: inDays(2)},
+		}))
+
+		cases := []struct {
+			orderBy  string
+			expected []string
+		}{
+			{"", []string{"a", "b", "c"}},
+			{"knowledge_level", []string{"b", "c", "a"}},
+			{"knowledge_level_desc", []string{"a", "b", "c"}},
+			{"practice_at", []string{"a", "c", "b"}},
+			{"practice_at_desc", []string{"b", "c", "a"}},
+		}
+		for _, c := range cases {
+			vq := NewVocabQuery()
+			vq.OrderBy = c.orderBy
+			vocabs, _, err := store.FindVocab(vq, 50)
+			require.Nil(t, err)
+			terms := make([]string, 0)
+			for _, vocab := range vocabs {
+				terms = append(terms, vocab.Term)
+			}
+			require.Equal(t, c.expected, terms, c.orderBy)
+		}
+	})
+}
+
+func Test_Store_CreateVocab(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		vocab, err := store.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+		require.Equal(t, uint(1), vocab.ID)
+
+		vocabs, err := store.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+		require.Equal(t, "foo", vocabs[0].Term)
+		require.Equal(t, "bar", vocabs[0].Translation)
+		require.Equal(t, uint(0), vocabs[0].KnowledgeLevel)
+		require.True(t, vocabs[0].PracticeAt.Equal(inDays(0)))
+	})
+}
+
+func Test_Store_UpdateVocab(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		require.Nil(t, store.AddVocab([]Vocab{
+			{Term: "foo", Translation: "bar", KnowledgeLevel: 3, PracticeAt: inDays(2)},
+		}))
+
+		vocab, err := store.UpdateVocab(1, "foo2", "bar2")
+		require.Nil(t, err)
+		require.Equal(t, "foo2", vocab.Term)
+
+		vocabs, err := store.AllVocab()
+		require.Nil(t, err)
+		require.Equal(t, "foo2", vocabs[0].Term)
+		require.Equal(t, "bar2", vocabs[0].Translation)
+		require.Equal(t, uint(3), vocabs[0].KnowledgeLevel)
+		require.True(t, vocabs[0].PracticeAt.Equal(inDays(2)))
+
+		_, err = store.UpdateVocab(2, "foo", "bar")
+		require.Equal(t, ErrVocabNotFound, err)
+	})
+}
+
+func Test_Store_DeleteVocab(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		_, err := store.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+
+		found, err := store.DeleteVocab(1)
+		require.Nil(t, err)
+		require.True(t, found)
+
+		found, err = store.DeleteVocab(1)
+		require.Nil(t, err)
+		require.False(t, found)
+
+		_, err = store.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+		require.Nil(t, store.DeleteAllVocab())
+		vocabs, err := store.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 0)
+	})
+}
+
+func Test_Store_Trash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		for _, term := range []string{"foo1", "foo2", "foo3"} {
+			_, err := store.CreateVocab(term, "bar")
+			require.Nil(t, err)
+		}
+		for _, id := range []uint{2, 1} {
+			found, err := store.DeleteVocab(id)
+			require.Nil(t, err)
+			require.True(t, found)
+		}
+
+		trashed, err := store.TrashedVocab()
+		require.Nil(t, err)
+		require.Len(t, trashed, 2)
+		require.Equal(t, "foo1", trashed[0].Term)
+		require.Equal(t, "foo2", trashed[1].Term)
+		require.True(t, trashed[0].DeletedAt.Valid)
+		_, count, err := store.FindVocab(NewVocabQuery(), 10)
+		require.Nil(t, err)
+		require.Equal(t, int64(1), count)
+
+		vocab, err := store.RestoreVocab(2)
+		require.Nil(t, err)
+		require.Equal(t, "foo2", vocab.Term)
+		_, count, err = store.FindVocab(NewVocabQuery(), 10)
+		require.Nil(t, err)
+		require.Equal(t, int64(2), count)
+		trashed, err = store.TrashedVocab()
+		require.Nil(t, err)
+		require.Len(t, trashed, 1)
+
+		// Only vocab in the trash can be restored.
+		_, err = store.RestoreVocab(2)
+		require.Equal(t, ErrVocabNotFound, err)
+		_, err = store.RestoreVocab(4)
+		require.Equal(t, ErrVocabNotFound, err)
+
+		require.Nil(t, store.DeleteAllVocab())
+		trashed, err = store.TrashedVocab()
+		require.Nil(t, err)
+		require.Len(t, trashed, 0)
+	})
+}
+
+func Test_Store_DueVocab(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		require.Nil(t, store.AddVocab([]Vocab{
+			{Term: "foo1", Translation: "bar1", PracticeAt: inDays(0)},
+			{Term: "foo2", Translation: "bar2", PracticeAt: inDays(1)},
+			{Term: "foo3", Translation: "bar3", PracticeAt: inDays(-1)},
+			{Term: "foo4", Translation: "bar4", PracticeAt: inDays(-2)},
+		}))
+
+		vocabs, err := store.DueVocab(2)
+		require.Nil(t, err)
+		require.Len(t, vocabs, 2)
+		require.Equal(t, "foo4", vocabs[0].Term)
+		require.Equal(t, "foo3", vocabs[1].Term)
+
+		count, err := store.CountDueVocab()
+		require.Nil(t, err)
+		require.Equal(t, int64(3), count)
+	})
+}
+
+func Test_Store_KnowledgeVocab(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		require.Nil(t, store.AddVocab([]Vocab{
+			{Term: "foo1", Translation: "bar1", KnowledgeLevel: 3},
+			{Term: "foo2", Translation: "bar2", KnowledgeLevel: 0},
+			{Term: "foo3", Translation: "bar3", KnowledgeLevel: 1},
+			{Term: "foo4", Translation: "bar4", KnowledgeLevel: 2},
+		}))
+
+		vocabs, err := store.KnowledgeVocab(1, 2)
+		require.Nil(t, err)
+		require.Len(t, vocabs, 2)
+		require.Equal(t, "foo3", vocabs[0].Term)
+		require.Equal(t, "foo4", vocabs[1].Term)
+	})
+}
+
+func Test_Store_RecordReview(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		_, err := store.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+
+		vocab, err := store.RecordReview(DefaultConfig(), 1, true)
+		require.Nil(t, err)
+		require.Equal(t, uint(1), vocab.KnowledgeLevel)
+		require.True(t, vocab.PracticeAt.Equal(inDays(1)))
+
+		count, err := store.CountDueVocab()
+		require.Nil(t, err)
+		require.Equal(t, int64(0), count)
+
+		_, err = store.RecordReview(DefaultConfig(), 2, true)
+		require.Equal(t, ErrVocabNotFound, err)
+	})
+}
+
+func Test_Store_RecordReviews(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		config := DefaultConfig()
+		for _, term := range []string{"foo1", "foo2"} {
+			_, err := store.CreateVocab(term, "bar")
+			require.Nil(t, err)
+		}
+
+		vocabs, err := store.RecordReviews(config, []Answer{{VocabID: 2, Passed: true}, {VocabID: 1, Passed: false}})
+		require.Nil(t, err)
+		require.Len(t, vocabs, 2)
+		require.Equal(t, "foo2", vocabs[0].Term)
+		require.Equal(t, uint(1), vocabs[0].KnowledgeLevel)
+		require.Equal(t, "foo1", vocabs[1].Term)
+		require.Equal(t, uint(0), vocabs[1].KnowledgeLevel)
+
+		// None are recorded if a vocab isn't found.
+		_, err = store.RecordReviews(config, []Answer{{VocabID: 1, Passed: true}, {VocabID: 3, Passed: true}})
+		require.Equal(t, ErrVocabNotFound, err)
+		vocabs, err = store.AllVocab()
+		require.Nil(t, err)
+		require.Equal(t, uint(0), vocabs[0].KnowledgeLevel)
+
+		// The answers are undone together.
+		vocabs, err = store.UndoPractice()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 2)
+		_, err = store.UndoPractice()
+		require.Equal(t, ErrNothingToUndo, err)
+	})
+}
+
+func Test_Store_Stats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		config := DefaultConfig()
+		for _, term := range []string{"foo1", "foo2", "foo3"} {
+			_, err := store.CreateVocab(term, "bar")
+			require.Nil(t, err)
+		}
+		_, err := store.RecordReview(config, 1, true)
+		require.Nil(t, err)
+		_, err = store.RecordReview(config, 2, false)
+		require.Nil(t, err)
+
+		stats, err := store.Stats()
+		require.Nil(t, err)
+		require.Equal(t, &Stats{
+			Total:           3,
+			DueToday:        1,
+			DueThisWeek:     3,
+			KnowledgeLevels: []int64{2, 1, 0, 0, 0, 0, 0, 0},
+			Last7Days:       ReviewStats{Reviews: 2, Passed: 1, Accuracy: 0.5},
+			Last30Days:      ReviewStats{Reviews: 2, Passed: 1, Accuracy: 0.5},
+			Streak:          1,
+		}, stats)
+	})
+}
+
+// Deleting all vocab leaves no reviews behind to count in the stats.
+func Test_Store_DeleteAllVocab_Stats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		_, err := store.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+		_, err = store.RecordReview(DefaultConfig(), 1, true)
+		require.Nil(t, err)
+
+		require.Nil(t, store.DeleteAllVocab())
+		stats, err := store.Stats()
+		require.Nil(t, err)
+		require.Equal(t, &Stats{KnowledgeLevels: make([]int64, maxKnowledge+1)}, stats)
+		_, err = store.UndoPractice()
+		require.Equal(t, ErrNothingToUndo, err)
+	})
+}
+
+func Test_Store_UndoPractice(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		config := DefaultConfig()
+		_, err := store.UndoPractice()
+		require.Equal(t, ErrNothingToUndo, err)
+		for _, term := range []string{"foo1", "foo2"} {
+			_, err = store.CreateVocab(term, "bar")
+			require.Nil(t, err)
+		}
+		_, err = store.RecordReview(config, 1, true)
+		require.Nil(t, err)
+
+		// The reviews of a transaction are undone together, even of the same
+		// vocab.
+		err = store.Transaction(func(tx Store) error {
+			for _, id := range []uint{1, 2, 1} {
+				_, err := tx.RecordReview(config, id, false)
+				require.Nil(t, err)
+			}
+			return nil
+		})
+		require.Nil(t, err)
+		vocabs, err := store.UndoPractice()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 2)
+		require.Equal(t, uint(1), vocabs[0].KnowledgeLevel)
+		require.True(t, vocabs[0].PracticeAt.Equal(inDays(1)))
+		require.Equal(t, uint(0), vocabs[1].KnowledgeLevel)
+		require.True(t, vocabs[1].PracticeAt.Equal(inDays(0)))
+		count, err := store.CountDueVocab()
+		require.Nil(t, err)
+		require.Equal(t, int64(1), count)
+
+		// Then the review before.
+		vocabs, err = store.UndoPractice()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+		require.Equal(t, uint(0), vocabs[0].KnowledgeLevel)
+		_, err = store.UndoPractice()
+		require.Equal(t, ErrNothingToUndo, err)
+	})
+}
+
+func Test_Store_Transaction(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		_, err := store.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+
+		failed := errors.New("failed")
+		err = store.Transaction(func(tx Store) error {
+			require.Nil(t, tx.DeleteAllVocab())
+			_, err := tx.CreateVocab("foo2", "bar2")
+			require.Nil(t, err)
+			return failed
+		})
+		require.Equal(t, failed, err)
+
+		vocabs, err := store.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+		require.Equal(t, "foo", vocabs[0].Term)
+
+		err = store.Transaction(func(tx Store) error {
+			_, err := tx.CreateVocab("foo2", "bar2")
+			return err
+		})
+		require.Nil(t, err)
+		vocabs, err = store.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 2)
+	})
+}
+
+func Test_UserStore(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		local := NewGormStore(db)
+		alice := NewUserStore(db, 1)
+		bob := NewUserStore(db, 2)
+
+		_, err := local.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+		vocab, err := alice.CreateVocab("foo", "bar")
+		require.Nil(t, err)
+		require.Nil(t, bob.AddVocab([]Vocab{{Term: "baz", Translation: "qux", PracticeAt: inDays(-1)}}))
+
+		vocabs, count, err := alice.FindVocab(NewVocabQuery(), 50)
+		require.Nil(t, err)
+		require.Equal(t, int64(1), count)
+		require.Equal(t, vocab.ID, vocabs[0].ID)
+
+		// Users can't see or change each other's vocab.
+		_, err = bob.UpdateVocab(vocab.ID, "foo2", "bar2")
+		require.Equal(t, ErrVocabNotFound, err)
+		_, err = bob.RecordReview(DefaultConfig(), vocab.ID, true)
+		require.Equal(t, ErrVocabNotFound, err)
+		found, err := bob.DeleteVocab(vocab.ID)
+		require.Nil(t, err)
+		require.False(t, found)
+
+		count, err = bob.CountDueVocab()
+		require.Nil(t, err)
+		require.Equal(t, int64(1), count)
+		vocabs, err = bob.DueVocab(10)
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+		require.Equal(t, "baz", vocabs[0].Term)
+
+		err = bob.Transaction(func(tx Store) error {
+			return tx.DeleteAllVocab()
+		})
+		require.Nil(t, err)
+		vocabs, err = alice.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+		vocabs, err = local.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+	})
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sync keeps the vocab of computers practising the same collection in step,
+// through a folder they share, e.g. with Dropbox or Syncthing. Each computer
+// is a device with its own ID. It appends the changes made on it to its own
+// change log in the folder, <device ID>.jsonl, so no two devices write the
+// same file, and merges the new changes in the logs of the other devices:
+//
+//   - the term and translation of the latest edit win,
+//   - the knowledge level and practice date of the latest review win,
+//   - a deletion wins over changes made before it, and loses to those made
+//     after it,
+//   - an undone review is removed for good.
+//
+// Ties are broken by comparing the values, so that the devices end up with
+// the same vocab whatever order they sync in.
+
+const syncLogExt = ".jsonl"
+
+const (
+	changeVocab  = "vocab"
+	changeReview = "review"
+	changeDelete = "delete"
+	changeUndo   = "undo"
+)
+
+// Tombstone records that a vocab was deleted, or a review undone, so it can
+// be synced.
+type Tombstone struct {
+	ID     uint   `gorm:"primarykey"`
+	UserID uint   `gorm:"index"`
+	SyncID string `gorm:"index"`
+	// Type is changeDelete for vocab, or changeUndo for a review.
+	Type      string `gorm:"not null;default:'delete'"`
+	DeletedAt time.Time
+}
+
+// SyncState is the device of a collection.
+type SyncState struct {
+	ID       uint `gorm:"primarykey"`
+	UserID   uint `gorm:"uniqueIndex"`
+	DeviceID string
+	// ExportedAt is when the changes were last appended to the log of the
+	// device.
+	ExportedAt time.Time
+}
+
+// SyncPeer records how many of the changes of another device have been
+// merged.
+type SyncPeer struct {
+	ID       uint   `gorm:"primarykey"`
+	UserID   uint   `gorm:"index"`
+	DeviceID string `gorm:"index"`
+	// Lines is the number of lines of the log merged so far.
+	Lines int
+	// URL is the URL of a peer synced over HTTP, or "" for a log in a
+	// folder.
+	URL string `gorm:"index"`
+	// Received is the cursor of the peer up to which its changes have been
+	// merged, and Sent the cursor of this device up to which its changes
+	// have been sent to the peer.
+	Received string
+	Sent     string
+}
+
+// change is a line of a change log, or a change sent to a peer.
+type change struct {
+	Type   string `json:"type"`
+	Device string `json:"device"`
+	SyncID string `json:"syncId"`
+
+	// Vocab.
+	Term           string     `json:"term,omitempty"`
+	Translation    string     `json:"translation,omitempty"`
+	KnowledgeLevel uint       `json:"knowledgeLevel,omitempty"`
+	PracticeAt     *time.Time `json:"practiceAt,omitempty"`
+	EditedAt       *time.Time `json:"editedAt,omitempty"`
+	ReviewedAt     *time.Time `json:"reviewedAt,omitempty"`
+
+	// Review.
+	VocabSyncID string     `json:"vocabSyncId,omitempty"`
+	Passed      bool       `json:"passed,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+
+	// Delete or undo.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type SyncResult struct {
+	DeviceID string
+	// Peers is the number of other devices synced with.
+	Peers int
+	// Merged is the number of changes from other devices that changed the
+	// vocab.
+	Merged int
+	// Sent is the number of changes appended to the log of the device, or
+	// sent to the peer.
+	Sent int
+}
+
+// validate returns an error if the change is missing a field its type needs.
+func (c change) validate() error {
+	if c.Type != changeVocab && c.Type != changeReview && c.Type != changeDelete && c.Type != changeUndo {
+		return ErrInvalid{Field: "type", Message: "must be vocab, review, delete or undo"}
+	}
+	if c.SyncID == "" {
+		return ErrInvalid{Field: "syncId", Message: "is required"}
+	}
+	required := map[string]bool{}
+	if c.Type == changeVocab {
+		required["practiceAt"] = c.PracticeAt != nil
+		required["editedAt"] = c.EditedAt != nil
+	} else if c.Type == changeReview {
+		required["vocabSyncId"] = c.VocabSyncID != ""
+		required["createdAt"] = c.CreatedAt != nil
+	} else {
+		required["deletedAt"] = c.DeletedAt != nil
+	}
+	for _, field := range []string{"practiceAt", "editedAt", "vocabSyncId", "createdAt", "deletedAt"} {
+		if present, ok := required[field]; ok && !present {
+			return ErrInvalid{Field: field, Message: "is required"}
+		}
+	}
+	return nil
+}
+
+// BeforeCreate gives new vocab the ID it's synced by.
+func (v *Vocab) BeforeCreate(tx *gorm.DB) error {
+	if v.SyncID == "" {
+		syncID, err := newSyncID()
+		if err != nil {
+			return err
+		}
+		v.SyncID = syncID
+	}
+	if v.EditedAt.IsZero() {
+		v.EditedAt = time.Now()
+	}
+	return nil
+}
+
+// BeforeCreate gives new reviews the ID they're synced by.
+func (r *Review) BeforeCreate(tx *gorm.DB) error {
+	if r.SyncID != "" {
+		return nil
+	}
+	syncID, err := newSyncID()
+	if err != nil {
+		return err
+	}
+	r.SyncID = syncID
+	return nil
+}
+
+func newSyncID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// syncState returns the device of the collection of the user with the given
+// ID, creating it on the first sync.
+func syncState(db *gorm.DB, userID uint) (*SyncState, error) {
+	states := make([]SyncState, 0)
+	dbResult := forUser(db, userID).Limit(1).Find(&states)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	if len(states) > 0 {
+		return &states[0], nil
+	}
+
+	deviceID, err := newSyncID()
+	if err != nil {
+		return nil, err
+	}
+	state := &SyncState{UserID: userID, DeviceID: deviceID[:12]}
+	dbResult = db.Create(state)
+	return state, dbResult.Error
+}
+
+// syncDir syncs the collection of the user with the given ID through dir:
+// it merges the new changes in the logs of the other devices, then appends
+// the changes made since the last sync to the log of this device.
+func syncDir(db *gorm.DB, userID uint, dir string) (*SyncResult, error) {
+	state, err := syncState(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &SyncResult{DeviceID: state.DeviceID}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		peers, changes, err := readPeerLogs(tx, userID, dir, state.DeviceID)
+		if err != nil {
+			return err
+		}
+		result.Peers = len(peers)
+		result.Merged, err = mergeChanges(tx, userID, changes, false)
+		if err != nil {
+			return err
+		}
+		for idx := range peers {
+			dbResult := tx.Save(&peers[idx])
+			if dbResult.Error != nil {
+				return dbResult.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exportedAt := time.Now()
+	changes, err := localChanges(db, userID, state.DeviceID, state.ExportedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = appendLog(filepath.Join(dir, state.DeviceID+syncLogExt), changes)
+	if err != nil {
+		return nil, err
+	}
+	result.Sent = len(changes)
+	dbResult := db.Model(state).Update("exported_at", exportedAt)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	return result, nil
+}
+
+// readPeerLogs returns the lines of the logs of the other devices in dir
+// that haven't been merged yet, with the peers updated to include them.
+func readPeerLogs(db *gorm.DB, userID uint, dir, deviceID string) ([]SyncPeer, []change, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+syncLogExt))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(paths)
+
+	peers := make([]SyncPeer, 0)
+	changes := make([]change, 0)
+	for _, path := range paths {
+		peerID := strings.TrimSuffix(filepath.Base(path), syncLogExt)
+		if peerID == deviceID {
+			continue
+		}
+
+		peer := SyncPeer{UserID: userID, DeviceID: peerID}
+		dbResult := forUser(db, userID).Where("device_id = ? and url = ''", peerID).Limit(1).Find(&peer)
+		if dbResult.Error != nil {
+			return nil, nil, dbResult.Error
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The last line may still be being written, e.g. by the program
+		// syncing the folder, unless it ends with a new line.
+		lines := bytes.Split(b, []byte("\n"))
+		lines = lines[:len(lines)-1]
+		if len(lines) < peer.Lines {
+			// The log was started again. Merging is idempotent, so it
+			// can all be merged again.
+			peer.Lines = 0
+		}
+		for idx := peer.Lines; idx < len(lines); idx++ {
+			var c change
+			err = json.Unmarshal(lines[idx], &c)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s, line %d: %w", path, idx+1, err)
+			}
+			changes = append(changes, c)
+		}
+		peer.Lines = len(lines)
+		peers = append(peers, peer)
+	}
+	return peers, changes, nil
+}
+
+// mergeChanges merges changes from other devices, returning the number that
+// changed the vocab. Vocab is merged before the reviews of it, then deletions
+// and undone reviews. With relay, merged vocab counts as changed on this device, so it's
+// passed on to the peers synced over HTTP.
+func mergeChanges(tx *gorm.DB, userID uint, changes []change, relay bool) (int, error) {
+	merged := 0
+	for _, changeType := range []string{changeVocab, changeReview, changeDelete, changeUndo} {
+		for _, c := range changes {
+			if c.Type != changeType {
+				continue
+			}
+			var changed bool
+			var err error
+			if c.Type == changeVocab {
+				changed, err = mergeVocab(tx, userID, c, relay)
+			} else if c.Type == changeReview {
+				changed, err = mergeReview(tx, userID, c)
+			} else if c.Type == changeDelete {
+				changed, err = mergeDelete(tx, userID, c)
+			} else {
+				changed, err = mergeUndo(tx, userID, c)
+			}
+			if err != nil {
+				return merged, err
+			}
+			if changed {
+				merged++
+			}
+		}
+	}
+	return merged, nil
+}
+
+func mergeVocab(tx *gorm.DB, userID uint, c change, relay bool) (bool, error) {
+	if c.EditedAt == nil || c.PracticeAt == nil {
+		return false, fmt.Errorf("bad change of vocab %s from device %s", c.SyncID, c.Device)
+	}
+	changedAt := *c.EditedAt
+	if c.ReviewedAt != nil && c.ReviewedAt.After(changedAt) {
+		changedAt = *c.ReviewedAt
+	}
+	deletedAt, err := lastDeleted(tx, userID, c.SyncID)
+	if err != nil {
+		return false, err
+	}
+	if deletedAt != nil && !changedAt.After(*deletedAt) {
+		return false, nil
+	}
+
+	// Vocab in the trash is found too, to be restored by the later change.
+	vocabs := make([]Vocab, 0)
+	dbResult := forUser(tx, userID).Unscoped().Where("sync_id = ?", c.SyncID).Limit(1).Find(&vocabs)
+	if dbResult.Error != nil {
+		return false, dbResult.Error
+	}
+	updatedAt := changedAt
+	if relay {
+		updatedAt = time.Now()
+	}
+	if len(vocabs) == 0 {
+		dbResult = tx.Create(&Vocab{
+			UserID:         userID,
+			SyncID:         c.SyncID,
+			Term:           c.Term,
+			Translation:    c.Translation,
+			KnowledgeLevel: c.KnowledgeLevel,
+			PracticeAt:     *c.PracticeAt,
+			EditedAt:       *c.EditedAt,
+			ReviewedAt:     c.ReviewedAt,
+			// Unless relayed, not changed on this device, so not sent
+			// back.
+			UpdatedAt: updatedAt,
+		})
+		return dbResult.Error == nil, dbResult.Error
+	}
+
+	vocab := vocabs[0]
+	updates := make(map[string]interface{})
+	if laterEdit(c, vocab) {
+		updates["term"] = c.Term
+		updates["translation"] = c.Translation
+		updates["edited_at"] = *c.EditedAt
+	}
+	if laterReview(c, vocab) {
+		updates["knowledge_level"] = c.KnowledgeLevel
+		updates["practice_at"] = *c.PracticeAt
+		updates["reviewed_at"] = *c.ReviewedAt
+	}
+	if vocab.DeletedAt.Valid {
+		updates["deleted_at"] = nil
+	}
+	if len(updates) == 0 {
+		return false, nil
+	}
+	// UpdateColumns leaves updated_at, so unless relayed the change isn't
+	// sent back.
+	if relay {
+		updates["updated_at"] = updatedAt
+	}
+	dbResult = tx.Unscoped().Model(&vocab).UpdateColumns(updates)
+	return dbResult.Error == nil, dbResult.Error
+}
+
+// laterEdit returns true if the term and translation of c win over those of
+// vocab.
+func laterEdit(c change, vocab Vocab) bool {
+	if !c.EditedAt.Equal(vocab.EditedAt) {
+		return c.EditedAt.After(vocab.EditedAt)
+	}
+	return c.Term+"\x00"+c.Translation > vocab.Term+"\x00"+vocab.Translation
+}
+
+// laterReview returns true if the schedule of c wins over that of vocab.
+func laterReview(c change, vocab Vocab) bool {
+	if c.ReviewedAt == nil {
+		return false
+	}
+	if vocab.ReviewedAt == nil || !c.ReviewedAt.Equal(*vocab.ReviewedAt) {
+		return vocab.ReviewedAt == nil || c.ReviewedAt.After(*vocab.ReviewedAt)
+	}
+	if c.KnowledgeLevel != vocab.KnowledgeLevel {
+		return c.KnowledgeLevel > vocab.KnowledgeLevel
+	}
+	return c.PracticeAt.After(vocab.PracticeAt)
+}
+
+func mergeReview(tx *gorm.DB, userID uint, c change) (bool, error) {
+	if c.CreatedAt == nil {
+		return false, fmt.Errorf("bad change of review %s from device %s", c.SyncID, c.Device)
+	}
+	var count int64
+	dbResult := forUser(tx, userID).Model(&Review{}).Where("sync_id = ?", c.SyncID).Count(&count)
+	if dbResult.Error != nil {
+		return false, dbResult.Error
+	}
+	if count > 0 {
+		return false, nil
+	}
+	undoneAt, err := lastDeleted(tx, userID, c.SyncID)
+	if err != nil || undoneAt != nil {
+		return false, err
+	}
+
+	// Reviews of vocab in the trash are kept, in case it's restored.
+	vocabs := make([]Vocab, 0)
+	dbResult = forUser(tx, userID).Unscoped().Where("sync_id = ?", c.VocabSyncID).Limit(1).Find(&vocabs)
+	if dbResult.Error != nil {
+		return false, dbResult.Error
+	}
+	if len(vocabs) == 0 {
+		// The vocab was deleted for good.
+		return false, nil
+	}
+
+	dbResult = tx.Create(&Review{
+		UserID:    userID,
+		SyncID:    c.SyncID,
+		VocabID:   vocabs[0].ID,
+		Passed:    c.Passed,
+		CreatedAt: *c.CreatedAt,
+	})
+	return dbResult.Error == nil, dbResult.Error
+}
+
+func mergeDelete(tx *gorm.DB, userID uint, c change) (bool, error) {
+	if c.DeletedAt == nil {
+		return false, fmt.Errorf("bad deletion of vocab %s from device %s", c.SyncID, c.Device)
+	}
+	deletedAt, err := lastDeleted(tx, userID, c.SyncID)
+	if err != nil {
+		return false, err
+	}
+	if deletedAt == nil || c.DeletedAt.After(*deletedAt) {
+		dbResult := tx.Create(&Tombstone{UserID: userID, SyncID: c.SyncID, Type: changeDelete, DeletedAt: *c.DeletedAt})
+		if dbResult.Error != nil {
+			return false, dbResult.Error
+		}
+	}
+
+	vocabs := make([]Vocab, 0)
+	dbResult := forUser(tx, userID).Where("sync_id = ?", c.SyncID).Limit(1).Find(&vocabs)
+	if dbResult.Error != nil {
+		return false, dbResult.Error
+	}
+	if len(vocabs) == 0 {
+		return false, nil
+	}
+	vocab := vocabs[0]
+	if vocab.EditedAt.After(*c.DeletedAt) || (vocab.ReviewedAt != nil && vocab.ReviewedAt.After(*c.DeletedAt)) {
+		// Changed since it was deleted.
+		return false, nil
+	}
+	dbResult = tx.Delete(&vocab)
+	return dbResult.Error == nil, dbResult.Error
+}
+
+// mergeUndo removes the review of undone practice. Unlike a deletion, an undo
+// is for good, so the review isn't added again by a device that hasn't merged
+// it yet.
+func mergeUndo(tx *gorm.DB, userID uint, c change) (bool, error) {
+	if c.DeletedAt == nil {
+		return false, fmt.Errorf("bad undo of review %s from device %s", c.SyncID, c.Device)
+	}
+	undoneAt, err := lastDeleted(tx, userID, c.SyncID)
+	if err != nil {
+		return false, err
+	}
+	if undoneAt == nil {
+		dbResult := tx.Create(&Tombstone{UserID: userID, SyncID: c.SyncID, Type: changeUndo, DeletedAt: *c.DeletedAt})
+		if dbResult.Error != nil {
+			return false, dbResult.Error
+		}
+	}
+	dbResult := forUser(tx, userID).Where("sync_id = ?", c.SyncID).Delete(&Review{})
+	return dbResult.RowsAffected > 0, dbResult.Error
+}
+
+// lastDeleted returns when the vocab with the given sync ID was last deleted,
+// or the review undone, or nil if it hasn't been.
+func lastDeleted(tx *gorm.DB, userID uint, syncID string) (*time.Time, error) {
+	tombstones := make([]Tombstone, 0)
+	dbResult := forUser(tx, userID).Where("sync_id = ?", syncID).Order("deleted_at desc").Limit(1).Find(&tombstones)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	if len(tombstones) == 0 {
+		return nil, nil
+	}
+	return &tombstones[0].DeletedAt, nil
+}
+
+// localChanges returns the changes made on this device since the given time.
+func localChanges(db *gorm.DB, userID uint, deviceID string, since time.Time) ([]change, error) {
+	return findChanges(db, userID, deviceID,
+		func(db *gorm.DB) *gorm.DB { return db.Where("updated_at >= ?", since) },
+		func(db *gorm.DB) *gorm.DB { return db.Where("reviews.created_at >= ?", since) },
+		func(db *gorm.DB) *gorm.DB { return db.Where("deleted_at >= ?", since) },
+	)
+}
+
+// findChanges returns the changes of the vocab, reviews and tombstones
+// selected by the given scopes.
+func findChanges(db *gorm.DB, userID uint, deviceID string, vocabScope, reviewScope, tombstoneScope func(*gorm.DB) *gorm.DB) ([]change, error) {
+	changes := make([]change, 0)
+
+	vocabs := make([]Vocab, 0)
+	dbResult := forUser(db, userID).Scopes(vocabScope).Order("id").Find(&vocabs)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	for idx := range vocabs {
+		vocab := vocabs[idx]
+		changes = append(changes, change{
+			Type:           changeVocab,
+			Device:         deviceID,
+			SyncID:         vocab.SyncID,
+			Term:           vocab.Term,
+			Translation:    vocab.Translation,
+			KnowledgeLevel: vocab.KnowledgeLevel,
+			PracticeAt:     &vocab.PracticeAt,
+			EditedAt:       &vocab.EditedAt,
+			ReviewedAt:     vocab.ReviewedAt,
+		})
+	}
+
+	var reviews []struct {
+		SyncID      string
+		VocabSyncID string
+		Passed      bool
+		CreatedAt   time.Time
+	}
+	dbResult = db.
+		Table("reviews").
+		Select("reviews.sync_id, vocabs.sync_id as vocab_sync_id, reviews.passed, reviews.created_at").
+		Joins("join vocabs on vocabs.id = reviews.vocab_id").
+		Where("reviews.user_id = ?", userID).
+		Scopes(reviewScope).
+		Order("reviews.id").
+		Scan(&reviews)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	for idx := range reviews {
+		review := reviews[idx]
+		changes = append(changes, change{
+			Type:        changeReview,
+			Device:      deviceID,
+			SyncID:      review.SyncID,
+			VocabSyncID: review.VocabSyncID,
+			Passed:      review.Passed,
+			CreatedAt:   &review.CreatedAt,
+		})
+	}
+
+	tombstones := make([]Tombstone, 0)
+	dbResult = forUser(db, userID).Scopes(tombstoneScope).Order("id").Find(&tombstones)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	for idx := range tombstones {
+		tombstone := tombstones[idx]
+		changes = append(changes, change{
+			Type:      tombstone.Type,
+			Device:    deviceID,
+			SyncID:    tombstone.SyncID,
+			DeletedAt: &tombstone.DeletedAt,
+		})
+	}
+	return changes, nil
+}
+
+// appendLog appends the changes to the log at path, a line each.
+func appendLog(path string, changes []change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, c := range changes {
+		err := encoder.Encode(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buf.Bytes())
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
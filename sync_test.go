@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// vocabState returns the vocab of db, in a form that is the same on every
+// device once they have synced.
+func vocabState(t *testing.T, db *gorm.DB) []string {
+	vocabs := make([]Vocab, 0)
+	require.Nil(t, db.Order("sync_id").Find(&vocabs).Error)
+	state := make([]string, 0, len(vocabs))
+	for _, v := range vocabs {
+		state = append(state, fmt.Sprintf("%s %s -> %s, %d, %s", v.SyncID, v.Term, v.Translation, v.KnowledgeLevel, v.PracticeAt.UTC().Format(time.RFC3339)))
+	}
+	return state
+}
+
+func requireSync(t *testing.T, db *gorm.DB, dir string) *SyncResult {
+	result, err := syncDir(db, noUser, dir)
+	require.Nil(t, err)
+	return result
+}
+
+func findVocab(t *testing.T, db *gorm.DB, term string) Vocab {
+	vocab := Vocab{}
+	require.Nil(t, db.Where("term = ?", term).First(&vocab).Error)
+	return vocab
+}
+
+func Test_Sync(t *testing.T) {
+	dir := t.TempDir()
+	laptop, desktop := memoryDb(t), memoryDb(t)
+	config := DefaultConfig()
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	result := requireSync(t, laptop, dir)
+	require.Equal(t, 0, result.Peers)
+	require.Equal(t, 1, result.Sent)
+	result = requireSync(t, desktop, dir)
+	require.Equal(t, 1, result.Peers)
+	require.Equal(t, 1, result.Merged)
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+
+	// The databases diverge: the laptop edits the vocab while the desktop
+	// practises it and adds more.
+	hund := findVocab(t, desktop, "hund")
+	_, err = NewGormStore(desktop).RecordReview(config, hund.ID, true)
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).CreateVocab("katze", "cat")
+	require.Nil(t, err)
+	hund = findVocab(t, laptop, "hund")
+	_, err = NewGormStore(laptop).UpdateVocab(hund.ID, "hund", "the dog")
+	require.Nil(t, err)
+
+	requireSync(t, desktop, dir)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	hund = findVocab(t, laptop, "hund")
+	require.Equal(t, "the dog", hund.Translation)
+	require.Equal(t, uint(1), hund.KnowledgeLevel)
+	findVocab(t, laptop, "katze")
+
+	var reviews int64
+	require.Nil(t, laptop.Model(&Review{}).Count(&reviews).Error)
+	require.Equal(t, int64(1), reviews)
+
+	// Nothing has changed since.
+	result = requireSync(t, laptop, dir)
+	require.Equal(t, 0, result.Merged)
+	require.Equal(t, 0, result.Sent)
+	result = requireSync(t, desktop, dir)
+	require.Equal(t, 0, result.Merged)
+}
+
+func Test_Sync_LatestReviewWins(t *testing.T) {
+	dir := t.TempDir()
+	laptop, desktop := memoryDb(t), memoryDb(t)
+	config := DefaultConfig()
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	// Both practise the vocab before syncing. The desktop does so last.
+	_, err = NewGormStore(laptop).RecordReview(config, findVocab(t, laptop, "hund").ID, true)
+	require.Nil(t, err)
+	_, err = NewGormStore(desktop).RecordReview(config, findVocab(t, desktop, "hund").ID, false)
+	require.Nil(t, err)
+
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+	requireSync(t, laptop, dir)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Equal(t, uint(0), findVocab(t, laptop, "hund").KnowledgeLevel)
+	var reviews int64
+	require.Nil(t, laptop.Model(&Review{}).Count(&reviews).Error)
+	require.Equal(t, int64(2), reviews)
+}
+
+func Test_Sync_Delete(t *testing.T) {
+	dir := t.TempDir()
+	laptop, desktop := memoryDb(t), memoryDb(t)
+
+	for _, term := range []string{"hund", "katze"} {
+		_, err := NewGormStore(laptop).CreateVocab(term, "bar")
+		require.Nil(t, err)
+	}
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	// The desktop edits hund before the laptop deletes it, so it's
+	// deleted. The desktop edits katze after the laptop deletes it, so it's
+	// kept.
+	_, err := NewGormStore(desktop).UpdateVocab(findVocab(t, desktop, "hund").ID, "hund", "dog")
+	require.Nil(t, err)
+	for _, term := range []string{"hund", "katze"} {
+		found, err := NewGormStore(laptop).DeleteVocab(findVocab(t, laptop, term).ID)
+		require.Nil(t, err)
+		require.True(t, found)
+	}
+	_, err = NewGormStore(desktop).UpdateVocab(findVocab(t, desktop, "katze").ID, "katze", "cat")
+	require.Nil(t, err)
+
+	requireSync(t, desktop, dir)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	state := vocabState(t, laptop)
+	require.Len(t, state, 1)
+	require.Contains(t, state[0], "katze -> cat")
+}
+
+// Vocab restored from the trash is restored on the devices the deletion was
+// synced to, with the reviews of it.
+func Test_Sync_Restore(t *testing.T) {
+	dir := t.TempDir()
+	laptop, desktop := memoryDb(t), memoryDb(t)
+
+	vocab, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	_, err = NewGormStore(laptop).DeleteVocab(vocab.ID)
+	require.Nil(t, err)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+	require.Len(t, vocabState(t, desktop), 0)
+	trashed, err := NewGormStore(desktop).TrashedVocab()
+	require.Nil(t, err)
+	require.Len(t, trashed, 1)
+
+	// The desktop practises it in the trash, e.g. in a session it started
+	// before syncing.
+	_, err = NewGormStore(laptop).RestoreVocab(vocab.ID)
+	require.Nil(t, err)
+	review := Review{UserID: noUser, VocabID: trashed[0].ID, Passed: true}
+	require.Nil(t, desktop.Create(&review).Error)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+	requireSync(t, laptop, dir)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Len(t, vocabState(t, desktop), 1)
+	require.Equal(t, int64(1), countReviews(t, laptop))
+}
+
+// Practice undone after it was synced is undone on the other devices too.
+func Test_Sync_UndoPractice(t *testing.T) {
+	dir := t.TempDir()
+	laptop, desktop := memoryDb(t), memoryDb(t)
+
+	vocab, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	_, err = NewGormStore(laptop).RecordReview(DefaultConfig(), vocab.ID, true)
+	require.Nil(t, err)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+	require.Equal(t, uint(1), findVocab(t, desktop, "hund").KnowledgeLevel)
+
+	_, err = NewGormStore(laptop).UndoPractice()
+	require.Nil(t, err)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	require.Equal(t, vocabState(t, laptop), vocabState(t, desktop))
+	require.Equal(t, uint(0), findVocab(t, desktop, "hund").KnowledgeLevel)
+	// The review is gone everywhere, even from a device that merges the
+	// log with it for the first time.
+	tablet := memoryDb(t)
+	requireSync(t, tablet, dir)
+	requireSync(t, laptop, dir)
+	for _, db := range []*gorm.DB{laptop, desktop, tablet} {
+		require.Equal(t, int64(0), countReviews(t, db))
+	}
+	require.Equal(t, vocabState(t, laptop), vocabState(t, tablet))
+	// Synced devices can't undo the practice of others.
+	_, err = NewGormStore(desktop).UndoPractice()
+	require.Equal(t, ErrNothingToUndo, err)
+}
+
+func Test_Sync_DeleteAll(t *testing.T) {
+	dir := t.TempDir()
+	laptop, desktop := memoryDb(t), memoryDb(t)
+
+	_, err := NewGormStore(laptop).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	require.Nil(t, NewGormStore(laptop).DeleteAllVocab())
+	requireSync(t, laptop, dir)
+	requireSync(t, desktop, dir)
+
+	require.Empty(t, vocabState(t, desktop))
+}
+
+func Test_Sync_Users(t *testing.T) {
+	dir := t.TempDir()
+	db := memoryDb(t)
+	other := memoryDb(t)
+
+	_, err := NewUserStore(db, 1).CreateVocab("hund", "dog")
+	require.Nil(t, err)
+	_, err = syncDir(db, 1, dir)
+	require.Nil(t, err)
+	_, err = syncDir(other, 2, dir)
+	require.Nil(t, err)
+
+	vocabs, err := NewUserStore(other, 2).AllVocab()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 1)
+	vocabs, err = NewUserStore(other, noUser).AllVocab()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 0)
+}
+
+func Test_ReadPeerLogs(t *testing.T) {
+	dir := t.TempDir()
+	db := memoryDb(t)
+	now := time.Now()
+	line := func(syncID string) string {
+		return fmt.Sprintf(`{"type": "delete", "device": "peer", "syncId": "%s", "deletedAt": "%s"}`, syncID, now.Format(time.RFC3339Nano))
+	}
+	// The last line is still being written.
+	log := line("a") + "\n" + line("b") + "\n" + `{"type": "del`
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "peer.jsonl"), []byte(log), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "self.jsonl"), []byte(line("c")+"\n"), 0644))
+
+	peers, changes, err := readPeerLogs(db, noUser, dir, "self")
+	require.Nil(t, err)
+	require.Len(t, peers, 1)
+	require.Equal(t, 2, peers[0].Lines)
+	require.Len(t, changes, 2)
+	require.Equal(t, "b", changes[1].SyncID)
+
+	// Only new lines are read.
+	require.Nil(t, db.Create(&peers[0]).Error)
+	log = line("a") + "\n" + line("b") + "\n" + line("d") + "\n"
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "peer.jsonl"), []byte(log), 0644))
+	peers, changes, err = readPeerLogs(db, noUser, dir, "self")
+	require.Nil(t, err)
+	require.Equal(t, 3, peers[0].Lines)
+	require.Len(t, changes, 1)
+	require.Equal(t, "d", changes[0].SyncID)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "peer.jsonl"), []byte("not json\n"), 0644))
+	_, _, err = readPeerLogs(db, noUser, dir, "self")
+	require.NotNil(t, err)
+}
+
+func Test_LaterEdit_Tie(t *testing.T) {
+	now := time.Now()
+	vocab := Vocab{Term: "hund", Translation: "dog", EditedAt: now}
+	c := change{Term: "hund", Translation: "the dog", EditedAt: &now}
+
+	// Whichever device merges, the same edit wins.
+	require.True(t, laterEdit(c, vocab))
+	require.False(t, laterEdit(change{Term: vocab.Term, Translation: vocab.Translation, EditedAt: &now}, Vocab{Term: c.Term, Translation: c.Translation, EditedAt: now}))
+}
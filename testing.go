@@ -1,22 +1,82 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func memoryDb(t *testing.T) *gorm.DB {
+func memoryDb(t testing.TB) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"))
 	require.Nil(t, err)
-	err = db.AutoMigrate(&Vocab{})
+	// Each connection would have its own database, e.g. for the requests of
+	// a test server.
+	sqlDB, err := db.DB()
+	require.Nil(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	_, err = migrateUp(db, latestVersion())
+	require.Nil(t, err)
+	return db
+}
+
+// postgresDb returns a migrated database in a new schema of the PostgreSQL
+// database at $VOCAB_TEST_POSTGRES_DSN, dropped when the test ends. The test is
+// skipped if $VOCAB_TEST_POSTGRES_DSN isn't set.
+func postgresDb(t testing.TB) *gorm.DB {
+	dsn := os.Getenv("VOCAB_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("$VOCAB_TEST_POSTGRES_DSN not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn))
+	require.Nil(t, err)
+	schema := fmt.Sprintf("vocab_test_%d", time.Now().UnixNano())
+	require.Nil(t, admin.Exec("create schema "+schema).Error)
+
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema)))
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		sqlDb, _ := db.DB()
+		sqlDb.Close()
+		admin.Exec("drop schema " + schema + " cascade")
+		sqlDb, _ = admin.DB()
+		sqlDb.Close()
+	})
+
+	_, err = migrateUp(db, latestVersion())
 	require.Nil(t, err)
 	return db
 }
 
+// withSearchPath adds the search_path parameter to a URL or key/value DSN.
+func withSearchPath(dsn, schema string) string {
+	if strings.Contains(dsn, "://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&search_path=" + schema
+		}
+		return dsn + "?search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
+
+// forEachDb runs the test against SQLite and, if $VOCAB_TEST_POSTGRES_DSN is
+// set, PostgreSQL.
+func forEachDb(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, memoryDb(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, postgresDb(t))
+	})
+}
+
 func inDaysJSON(n int) string {
 	return inDays(n).Format(time.RFC3339)
 }
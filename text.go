@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	defaultTermSeparator = "\t"
+	defaultCardSeparator = "\n"
+)
+
+// Text imports plain text word lists, such as those exported by Quizlet, where
+// cards are separated by CardSeparator and the term and translation within a
+// card are separated by TermSeparator.
+type Text struct {
+	store         Store
+	TermSeparator string
+	CardSeparator string
+}
+
+func NewText(store Store) *Text {
+	return &Text{
+		store:         store,
+		TermSeparator: defaultTermSeparator,
+		CardSeparator: defaultCardSeparator,
+	}
+}
+
+type TextPair struct {
+	Term        string `json:"term"`
+	Translation string `json:"translation"`
+}
+
+// Parse splits the text into term/translation pairs. Blank cards are skipped.
+func (t *Text) Parse(r io.Reader) ([]TextPair, error) {
+	if t.TermSeparator == "" || t.CardSeparator == "" {
+		return nil, ErrBadSeparator{}
+	}
+	if t.TermSeparator == t.CardSeparator {
+		return nil, ErrBadSeparator{}
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := string(b)
+	if t.CardSeparator == "\n" {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+
+	pairs := make([]TextPair, 0)
+	for idx, card := range strings.Split(text, t.CardSeparator) {
+		if strings.TrimSpace(card) == "" {
+			continue
+		}
+		parts := strings.SplitN(card, t.TermSeparator, 2)
+		if len(parts) != 2 {
+			return nil, ErrBadCard{Number: idx + 1}
+		}
+		pair := TextPair{
+			Term:        strings.TrimSpace(parts[0]),
+			Translation: strings.TrimSpace(parts[1]),
+		}
+		if pair.Term == "" || pair.Translation == "" {
+			return nil, ErrBadCard{Number: idx + 1}
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+func (t *Text) Import(r io.Reader) error {
+	pairs, err := t.Parse(r)
+	if err != nil {
+		return err
+	}
+	return t.store.Transaction(func(tx Store) error {
+		return createPairs(tx, pairs)
+	})
+}
+
+func (t *Text) ImportClean(r io.Reader) error {
+	pairs, err := t.Parse(r)
+	if err != nil {
+		return err
+	}
+	return t.store.Transaction(func(tx Store) error {
+		err := tx.DeleteAllVocab()
+		if err != nil {
+			return err
+		}
+		return createPairs(tx, pairs)
+	})
+}
+
+// createPairs adds the pairs as new vocab, due for practice today.
+func createPairs(tx Store, pairs []TextPair) error {
+	vocabs := make([]Vocab, 0, len(pairs))
+	for _, pair := range pairs {
+		vocabs = append(vocabs, Vocab{
+			Term:           pair.Term,
+			Translation:    pair.Translation,
+			KnowledgeLevel: 0,
+			PracticeAt:     inDays(0),
+		})
+	}
+	return tx.AddVocab(vocabs)
+}
+
+type ErrBadSeparator struct{}
+
+func (e ErrBadSeparator) Error() string {
+	return "Bad separator. separators must be non-empty and distinct"
+}
+
+type ErrBadCard struct {
+	Number int
+}
+
+func (e ErrBadCard) Error() string {
+	return fmt.Sprintf("Bad card. number: %d", e.Number)
+}
+
+// unescapeSeparator allows separators such as tabs and newlines to be given
+// on the command line as \t and \n.
+func unescapeSeparator(s string) string {
+	return strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\r`, "\r").Replace(s)
+}
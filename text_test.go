@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Text_Parse(t *testing.T) {
+	cases := []struct {
+		termSeparator string
+		cardSeparator string
+		data          string
+	}{
+		{"\t", "\n", "foo1\tbar1\nfoo2\tbar2\n"},
+		{"\t", "\n", "foo1\tbar1\r\n\r\n  foo2 \t bar2  \r\n"},
+		{" - ", ";", "foo1 - bar1;foo2 - bar2"},
+		{",", "\n\n", "foo1,bar1\n\nfoo2,bar2"},
+	}
+
+	for _, c := range cases {
+		text := NewText(NewGormStore(memoryDb(t)))
+		text.TermSeparator = c.termSeparator
+		text.CardSeparator = c.cardSeparator
+
+		pairs, err := text.Parse(strings.NewReader(c.data))
+		require.Nil(t, err)
+		require.Equal(t, []TextPair{
+			{Term: "foo1", Translation: "bar1"},
+			{Term: "foo2", Translation: "bar2"},
+		}, pairs)
+	}
+}
+
+func Test_Text_Parse_SplitsOnFirstTermSeparator(t *testing.T) {
+	text := NewText(NewGormStore(memoryDb(t)))
+	text.TermSeparator = " - "
+
+	pairs, err := text.Parse(strings.NewReader("foo - bar - baz"))
+	require.Nil(t, err)
+	require.Equal(t, []TextPair{{Term: "foo", Translation: "bar - baz"}}, pairs)
+}
+
+func Test_Text_Parse_ErrBadCard(t *testing.T) {
+	text := NewText(NewGormStore(memoryDb(t)))
+
+	_, err := text.Parse(strings.NewReader("foo1\tbar1\nfoo2\n"))
+	require.ErrorIs(t, err, ErrBadCard{Number: 2})
+
+	_, err = text.Parse(strings.NewReader("foo1\tbar1\n\t bar2\n"))
+	require.ErrorIs(t, err, ErrBadCard{Number: 2})
+}
+
+func Test_Text_Parse_ErrBadSeparator(t *testing.T) {
+	text := NewText(NewGormStore(memoryDb(t)))
+	text.TermSeparator = "\n"
+
+	_, err := text.Parse(strings.NewReader("foo\nbar"))
+	require.ErrorIs(t, err, ErrBadSeparator{})
+}
+
+func Test_Text_Import(t *testing.T) {
+	db := memoryDb(t)
+
+	dbResult := db.Create(&Vocab{
+		Term:           "hello",
+		Translation:    "world",
+		KnowledgeLevel: 1,
+		PracticeAt:     inDays(1),
+	})
+	require.Nil(t, dbResult.Error)
+
+	text := NewText(NewGormStore(db))
+	err := text.Import(strings.NewReader("foo1\tbar1\nfoo2\tbar2\n"))
+	require.Nil(t, err)
+
+	vocabs := make([]Vocab, 0)
+	dbResult = db.Find(&vocabs)
+	require.Nil(t, dbResult.Error)
+	require.Len(t, vocabs, 3)
+
+	require.Equal(t, "foo2", vocabs[2].Term)
+	require.Equal(t, "bar2", vocabs[2].Translation)
+	require.Equal(t, uint(0), vocabs[2].KnowledgeLevel)
+	require.True(t, vocabs[2].PracticeAt.Equal(inDays(0)))
+}
+
+func Test_Text_ImportClean(t *testing.T) {
+	db := memoryDb(t)
+
+	dbResult := db.Create(&Vocab{
+		Term:           "hello",
+		Translation:    "world",
+		KnowledgeLevel: 1,
+		PracticeAt:     inDays(1),
+	})
+	require.Nil(t, dbResult.Error)
+
+	text := NewText(NewGormStore(db))
+	err := text.ImportClean(strings.NewReader("foo1\tbar1\nfoo2\tbar2\n"))
+	require.Nil(t, err)
+
+	var count int64
+	dbResult = db.Model(&Vocab{}).Count(&count)
+	require.Nil(t, dbResult.Error)
+	require.Equal(t, int64(2), count)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// apiTokenPrefix marks API tokens, so they are easy to recognise, e.g. when
+// scanning for leaked secrets.
+const apiTokenPrefix = "vocab_"
+
+// lastUsedResolution limits how often the last use of a token is recorded,
+// so that scripts making many requests don't write to the database each time.
+const lastUsedResolution = time.Minute
+
+var ErrBadToken = errors.New("invalid or revoked token")
+
+// ApiToken lets scripts and integrations use the API. Only the hash of the
+// token is kept; the token itself is shown once, when it's created.
+type ApiToken struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserID     uint `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"uniqueIndex"`
+	LastUsedAt *time.Time
+}
+
+// createApiToken creates a token for the user with the given ID, or noUser
+// for the local collection, returning the token.
+func createApiToken(db *gorm.DB, userID uint, name string) (string, *ApiToken, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := apiTokenPrefix + secret
+
+	apiToken := &ApiToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(token),
+	}
+	dbResult := db.Create(apiToken)
+	if dbResult.Error != nil {
+		return "", nil, dbResult.Error
+	}
+	return token, apiToken, nil
+}
+
+func listApiTokens(db *gorm.DB, userID uint) ([]ApiToken, error) {
+	apiTokens := make([]ApiToken, 0)
+	dbResult := forUser(db, userID).Order("id").Find(&apiTokens)
+	return apiTokens, dbResult.Error
+}
+
+// revokeApiToken deletes the token of the user with the given ID, returning
+// false if the user has no such token.
+func revokeApiToken(db *gorm.DB, userID uint, id uint) (bool, error) {
+	dbResult := forUser(db, userID).Delete(&ApiToken{}, id)
+	if dbResult.Error != nil {
+		return false, dbResult.Error
+	}
+	return dbResult.RowsAffected > 0, nil
+}
+
+// useApiToken returns the API token matching token, recording that it was
+// used.
+func useApiToken(db *gorm.DB, token string, now time.Time) (*ApiToken, error) {
+	apiTokens := make([]ApiToken, 0)
+	dbResult := db.Where("token_hash = ?", hashToken(token)).Limit(1).Find(&apiTokens)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	if len(apiTokens) == 0 {
+		return nil, ErrBadToken
+	}
+	apiToken := &apiTokens[0]
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= lastUsedResolution {
+		apiToken.LastUsedAt = &now
+		dbResult = db.Model(apiToken).Update("last_used_at", now)
+		if dbResult.Error != nil {
+			return nil, dbResult.Error
+		}
+	}
+	return apiToken, nil
+}
+
+func printApiTokens(w io.Writer, apiTokens []ApiToken) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCREATED\tLAST USED")
+	for _, apiToken := range apiTokens {
+		name := apiToken.Name
+		if name == "" {
+			name = "-"
+		}
+		lastUsed := "never"
+		if apiToken.LastUsedAt != nil {
+			lastUsed = apiToken.LastUsedAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", apiToken.ID, name, apiToken.CreatedAt.Local().Format("2006-01-02 15:04"), lastUsed)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_ApiTokens(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		token, apiToken, err := createApiToken(db, noUser, "laptop")
+		require.Nil(t, err)
+		require.True(t, strings.HasPrefix(token, apiTokenPrefix))
+		require.NotEqual(t, token, apiToken.TokenHash)
+		_, _, err = createApiToken(db, 1, "alice")
+		require.Nil(t, err)
+
+		apiTokens, err := listApiTokens(db, noUser)
+		require.Nil(t, err)
+		require.Len(t, apiTokens, 1)
+		require.Equal(t, "laptop", apiTokens[0].Name)
+		require.Nil(t, apiTokens[0].LastUsedAt)
+
+		now := time.Now()
+		used, err := useApiToken(db, token, now)
+		require.Nil(t, err)
+		require.Equal(t, apiToken.ID, used.ID)
+		apiTokens, err = listApiTokens(db, noUser)
+		require.Nil(t, err)
+		require.NotNil(t, apiTokens[0].LastUsedAt)
+
+		_, err = useApiToken(db, token+"x", now)
+		require.Equal(t, ErrBadToken, err)
+
+		// Only the owner can revoke a token.
+		revoked, err := revokeApiToken(db, 1, apiToken.ID)
+		require.Nil(t, err)
+		require.False(t, revoked)
+		revoked, err = revokeApiToken(db, noUser, apiToken.ID)
+		require.Nil(t, err)
+		require.True(t, revoked)
+		_, err = useApiToken(db, token, now)
+		require.Equal(t, ErrBadToken, err)
+	})
+}
+
+func Test_PrintApiTokens(t *testing.T) {
+	used := time.Date(2021, 5, 2, 9, 30, 0, 0, time.Local)
+	var buf bytes.Buffer
+	err := printApiTokens(&buf, []ApiToken{
+		{ID: 1, Name: "laptop", CreatedAt: time.Date(2021, 5, 1, 12, 0, 0, 0, time.Local), LastUsedAt: &used},
+		{ID: 2, CreatedAt: time.Date(2021, 5, 1, 13, 0, 0, 0, time.Local)},
+	})
+	require.Nil(t, err)
+	require.Equal(t, `ID  NAME    CREATED           LAST USED
+1   laptop  2021-05-01 12:00  2021-05-02 09:30
+2   -       2021-05-01 13:00  never
+`, buf.String())
+}
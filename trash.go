@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// purgeTrash deletes for good the vocab of all users that was moved to the
+// trash more than days before now, with its reviews, returning the number of
+// vocab purged. Devices it was synced to still have its tombstone.
+func purgeTrash(db *gorm.DB, days int, now time.Time) (int64, error) {
+	var count int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		cutoff := now.AddDate(0, 0, -days)
+		ids := make([]uint, 0)
+		dbResult := tx.Unscoped().Model(&Vocab{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids)
+		if dbResult.Error != nil || len(ids) == 0 {
+			return dbResult.Error
+		}
+
+		dbResult = tx.Where("vocab_id in ?", ids).Delete(&Review{})
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		dbResult = tx.Unscoped().Where("id in ?", ids).Delete(&Vocab{})
+		count = dbResult.RowsAffected
+		return dbResult.Error
+	})
+	return count, err
+}
+
+// printTrash writes the vocab in the trash as a table.
+func printTrash(w io.Writer, vocabs []Vocab) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTERM\tTRANSLATION\tDELETED")
+	for _, vocab := range vocabs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", vocab.ID, vocab.Term, vocab.Translation, vocab.DeletedAt.Time.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_PurgeTrash(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		config := DefaultConfig()
+		store := NewGormStore(db)
+		for _, term := range []string{"foo1", "foo2", "foo3"} {
+			vocab, err := store.CreateVocab(term, "bar")
+			require.Nil(t, err)
+			_, err = store.RecordReview(config, vocab.ID, true)
+			require.Nil(t, err)
+		}
+		for _, id := range []uint{1, 2} {
+			_, err := store.DeleteVocab(id)
+			require.Nil(t, err)
+		}
+		userStore := NewUserStore(db, 1)
+		vocab, err := userStore.CreateVocab("foo4", "bar")
+		require.Nil(t, err)
+		_, err = userStore.DeleteVocab(vocab.ID)
+		require.Nil(t, err)
+		// foo2 was deleted 10 days ago.
+		require.Nil(t, db.Unscoped().Model(&Vocab{}).Where("id = ?", 2).Update("deleted_at", time.Now().AddDate(0, 0, -10)).Error)
+
+		count, err := purgeTrash(db, 30, time.Now())
+		require.Nil(t, err)
+		require.Equal(t, int64(0), count)
+
+		count, err = purgeTrash(db, 7, time.Now())
+		require.Nil(t, err)
+		require.Equal(t, int64(1), count)
+		trashed, err := store.TrashedVocab()
+		require.Nil(t, err)
+		require.Len(t, trashed, 1)
+		require.Equal(t, "foo1", trashed[0].Term)
+		require.Equal(t, int64(2), countReviews(t, db))
+
+		// The trash of every user is purged.
+		count, err = purgeTrash(db, 7, time.Now().AddDate(0, 0, 8))
+		require.Nil(t, err)
+		require.Equal(t, int64(2), count)
+		require.Equal(t, int64(1), countReviews(t, db))
+		vocabs, err := store.AllVocab()
+		require.Nil(t, err)
+		require.Len(t, vocabs, 1)
+	})
+}
+
+func Test_PrintTrash(t *testing.T) {
+	var buf bytes.Buffer
+	err := printTrash(&buf, []Vocab{
+		{ID: 2, Term: "hund", Translation: "dog", DeletedAt: gorm.DeletedAt{Time: time.Date(2021, 5, 2, 9, 30, 0, 0, time.Local), Valid: true}},
+		{ID: 1, Term: "katze", Translation: "cat", DeletedAt: gorm.DeletedAt{Time: time.Date(2021, 5, 1, 12, 0, 0, 0, time.Local), Valid: true}},
+	})
+	require.Nil(t, err)
+	require.Equal(t, `ID  TERM   TRANSLATION  DELETED
+2   hund   dog          2021-05-02 09:30
+1   katze  cat          2021-05-01 12:00
+`, buf.String())
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// key is a single key press read from the terminal. Printable characters
+// have r set, other keys are identified by name.
+type key struct {
+	r    rune
+	name string
+}
+
+var escapeKeys = map[string]string{
+	"\x1b[A":  "up",
+	"\x1b[B":  "down",
+	"\x1b[C":  "right",
+	"\x1b[D":  "left",
+	"\x1bOA":  "up",
+	"\x1bOB":  "down",
+	"\x1bOC":  "right",
+	"\x1bOD":  "left",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdn",
+}
+
+// parseKeys splits raw terminal input into key presses.
+func parseKeys(b []byte) []key {
+	keys := make([]key, 0)
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			matched := false
+			for seq, name := range escapeKeys {
+				if strings.HasPrefix(string(b), seq) {
+					keys = append(keys, key{name: name})
+					b = b[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				keys = append(keys, key{name: "esc"})
+				b = b[1:]
+			}
+			continue
+		}
+
+		switch b[0] {
+		case '\r', '\n':
+			keys = append(keys, key{name: "enter"})
+		case '\t':
+			keys = append(keys, key{name: "tab"})
+		case 0x7f, 0x08:
+			keys = append(keys, key{name: "backspace"})
+		case 0x03:
+			keys = append(keys, key{name: "ctrl-c"})
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r >= ' ' {
+				keys = append(keys, key{r: r})
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+type tuiMode int
+
+const (
+	modeBrowse tuiMode = iota
+	modeSearch
+	modeForm
+	modeConfirmDelete
+	modePractice
+)
+
+// tui is the state of the interactive terminal UI. Key presses are handled by
+// handleKey and the screen drawn by render, so the UI can be driven without a
+// terminal.
+type tui struct {
+	store  Store
+	config *Config
+	mode   tuiMode
+	height int
+	status string
+	quit   bool
+
+	search   []rune
+	query    VocabQuery
+	vocabs   []Vocab
+	count    int64
+	dueCount int64
+	cursor   int
+
+	form     tuiForm
+	practice tuiPractice
+}
+
+type tuiForm struct {
+	// id is the vocab being edited, or 0 when adding.
+	id     uint
+	fields [2][]rune
+	focus  int
+}
+
+type tuiPractice struct {
+	vocabs   []Vocab
+	idx      int
+	revealed bool
+	// answers are recorded together at the end of the session, as results.
+	answers []Answer
+	results []practiceResult
+}
+
+// Lines used by the header, search bar, pager and footer in browse mode.
+const tuiChromeLines = 8
+
+func newTui(store Store, config *Config, height int) *tui {
+	t := &tui{
+		store:  store,
+		config: config,
+		query:  NewVocabQuery(),
+	}
+	t.resize(height)
+	return t
+}
+
+func (t *tui) resize(height int) {
+	t.height = height
+	t.query.Take = min(max(height-tuiChromeLines, 1), t.config.MaxPageSize)
+}
+
+func (t *tui) load() error {
+	vocabs, count, err := t.store.FindVocab(t.query, t.config.MaxPageSize)
+	if err != nil {
+		return err
+	}
+	t.vocabs, t.count = vocabs, count
+	t.cursor = min(max(t.cursor, 0), max(len(t.vocabs)-1, 0))
+
+	t.dueCount, err = t.store.CountDueVocab()
+	return err
+}
+
+func (t *tui) selected() *Vocab {
+	if t.cursor < len(t.vocabs) {
+		return &t.vocabs[t.cursor]
+	}
+	return nil
+}
+
+func (t *tui) handleKey(k key) error {
+	if k.name == "ctrl-c" {
+		t.quit = true
+		if t.mode == modePractice {
+			return t.recordPractice()
+		}
+		return nil
+	}
+
+	switch t.mode {
+	case modeSearch:
+		return t.handleSearchKey(k)
+	case modeForm:
+		return t.handleFormKey(k)
+	case modeConfirmDelete:
+		return t.handleConfirmDeleteKey(k)
+	case modePractice:
+		return t.handlePracticeKey(k)
+	}
+	return t.handleBrowseKey(k)
+}
+
+func (t *tui) handleBrowseKey(k key) error {
+	t.status = ""
+	switch {
+	case k.r == 'q':
+		t.quit = true
+	case k.name == "up" || k.r == 'k':
+		if t.cursor > 0 {
+			t.cursor--
+		} else if t.query.Skip > 0 {
+			t.cursor = t.query.Take - 1
+			return t.page(-1)
+		}
+	case k.name == "down" || k.r == 'j':
+		if t.cursor < len(t.vocabs)-1 {
+			t.cursor++
+		} else if int64(t.query.Skip+len(t.vocabs)) < t.count {
+			t.cursor = 0
+			return t.page(1)
+		}
+	case k.name == "left" || k.name == "pgup":
+		return t.page(-1)
+	case k.name == "right" || k.name == "pgdn":
+		return t.page(1)
+	case k.r == '/':
+		t.mode = modeSearch
+	case k.r == 'a':
+		t.form = tuiForm{}
+		t.mode = modeForm
+	case k.r == 'e' || k.name == "enter":
+		if vocab := t.selected(); vocab != nil {
+			t.form = tuiForm{
+				id:     vocab.ID,
+				fields: [2][]rune{[]rune(vocab.Term), []rune(vocab.Translation)},
+			}
+			t.mode = modeForm
+		}
+	case k.r == 'd':
+		if t.selected() != nil {
+			t.mode = modeConfirmDelete
+		}
+	case k.r == 'p':
+		return t.startPractice()
+	}
+	return nil
+}
+
+func (t *tui) page(delta int) error {
+	skip := t.query.Skip + delta*t.query.Take
+	if skip < 0 || int64(skip) >= t.count {
+		return nil
+	}
+	t.query.Skip = skip
+	return t.load()
+}
+
+func (t *tui) handleSearchKey(k key) error {
+	switch {
+	case k.name == "enter":
+		t.mode = modeBrowse
+		return nil
+	case k.name == "esc":
+		t.search = nil
+		t.mode = modeBrowse
+	case k.name == "backspace":
+		if len(t.search) > 0 {
+			t.search = t.search[:len(t.search)-1]
+		}
+	case k.r != 0:
+		t.search = append(t.search, k.r)
+	default:
+		return nil
+	}
+
+	t.query.Term = string(t.search)
+	t.query.Translation = string(t.search)
+	t.query.Mode = "or"
+	t.query.Skip = 0
+	t.cursor = 0
+	return t.load()
+}
+
+func (t *tui) handleFormKey(k key) error {
+	field := &t.form.fields[t.form.focus]
+	switch {
+	case k.name == "esc":
+		t.mode = modeBrowse
+	case k.name == "tab" || k.name == "down" || k.name == "up":
+		t.form.focus = 1 - t.form.focus
+	case k.name == "backspace":
+		if len(*field) > 0 {
+			*field = (*field)[:len(*field)-1]
+		}
+	case k.name == "enter":
+		return t.saveForm()
+	case k.r != 0:
+		*field = append(*field, k.r)
+	}
+	return nil
+}
+
+func (t *tui) saveForm() error {
+	term := strings.TrimSpace(string(t.form.fields[0]))
+	translation := strings.TrimSpace(string(t.form.fields[1]))
+	if term == "" || translation == "" {
+		t.status = "term and translation are required"
+		return nil
+	}
+
+	if t.form.id == 0 {
+		_, err := t.store.CreateVocab(term, translation)
+		if err != nil {
+			return err
+		}
+		t.status = fmt.Sprintf("added: %s -> %s", term, translation)
+		// Stay on the form to allow adding several in a row.
+		t.form = tuiForm{}
+		return t.load()
+	}
+
+	_, err := t.store.UpdateVocab(t.form.id, term, translation)
+	if err != nil {
+		return err
+	}
+	t.status = fmt.Sprintf("saved: %s -> %s", term, translation)
+	t.mode = modeBrowse
+	return t.load()
+}
+
+func (t *tui) handleConfirmDeleteKey(k key) error {
+	t.mode = modeBrowse
+	vocab := t.selected()
+	if k.r != 'y' || vocab == nil {
+		t.status = ""
+		return nil
+	}
+
+	_, err := t.store.DeleteVocab(vocab.ID)
+	if err != nil {
+		return err
+	}
+	t.status = fmt.Sprintf("deleted: %s -> %s", vocab.Term, vocab.Translation)
+	if len(t.vocabs) == 1 && t.query.Skip > 0 {
+		t.query.Skip -= t.query.Take
+	}
+	return t.load()
+}
+
+func (t *tui) startPractice() error {
+	vocabs, err := t.store.DueVocab(t.config.SessionSize)
+	if err != nil {
+		return err
+	}
+	if len(vocabs) == 0 {
+		t.status = "nothing to practice"
+		return nil
+	}
+	t.practice = tuiPractice{vocabs: vocabs}
+	t.mode = modePractice
+	return nil
+}
+
+func (t *tui) handlePracticeKey(k key) error {
+	p := &t.practice
+	if p.idx >= len(p.vocabs) || k.name == "esc" {
+		err := t.recordPractice()
+		if err != nil {
+			return err
+		}
+		t.mode = modeBrowse
+		return t.load()
+	}
+
+	if !p.revealed {
+		if k.r == ' ' || k.name == "enter" {
+			p.revealed = true
+		}
+		return nil
+	}
+
+	if k.r != 'y' && k.r != 'n' {
+		return nil
+	}
+	p.answers = append(p.answers, Answer{VocabID: p.vocabs[p.idx].ID, Passed: k.r == 'y'})
+	p.idx++
+	p.revealed = false
+	if p.idx < len(p.vocabs) {
+		return nil
+	}
+	return t.recordPractice()
+}
+
+// recordPractice records the answers given so far.
+func (t *tui) recordPractice() error {
+	p := &t.practice
+	if len(p.answers) == 0 {
+		return nil
+	}
+	updated, err := t.store.RecordReviews(t.config, p.answers)
+	if err != nil {
+		return err
+	}
+	for idx, answer := range p.answers {
+		p.results = append(p.results, practiceResult{
+			Vocab:          updated[idx],
+			Passed:         answer.Passed,
+			KnowledgeLevel: p.vocabs[idx].KnowledgeLevel,
+		})
+	}
+	p.answers = nil
+	return nil
+}
+
+// render returns the lines of the screen.
+func (t *tui) render(width int) []string {
+	lines := make([]string, 0, t.height)
+	title := "vocab"
+	switch t.mode {
+	case modeForm:
+		title = "vocab: add"
+		if t.form.id != 0 {
+			title = "vocab: edit"
+		}
+	case modePractice:
+		title = "vocab: practice"
+	}
+	lines = append(lines, fmt.Sprintf(" %s%*s", title, max(width-len(title)-2, 0), fmt.Sprintf("due: %d ", t.dueCount)), "")
+
+	var help string
+	switch t.mode {
+	case modeBrowse, modeSearch, modeConfirmDelete:
+		lines = append(lines, t.renderBrowse(width)...)
+		help = "↑↓ move  ←→ page  / search  a add  e edit  d delete  p practice  q quit"
+		if t.mode == modeSearch {
+			help = "type to search  enter done  esc clear"
+		} else if t.mode == modeConfirmDelete {
+			help = "delete the selected vocab? y yes  any other key no"
+		}
+	case modeForm:
+		lines = append(lines, t.renderForm()...)
+		help = "tab switch field  enter save  esc back"
+	case modePractice:
+		lines = append(lines, t.renderPractice()...)
+		help = "space reveal  y correct  n wrong  esc stop"
+		if t.practice.idx >= len(t.practice.vocabs) {
+			help = "any key back"
+		}
+	}
+
+	for len(lines) < t.height-2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, " "+t.status, " "+help)
+
+	for idx, line := range lines {
+		lines[idx] = truncate(line, width)
+	}
+	return lines
+}
+
+func (t *tui) renderBrowse(width int) []string {
+	lines := make([]string, 0)
+	if t.mode == modeSearch {
+		lines = append(lines, " search: "+string(t.search)+"_")
+	} else if len(t.search) > 0 {
+		lines = append(lines, " search: "+string(t.search))
+	} else {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "")
+
+	if len(t.vocabs) == 0 {
+		lines = append(lines, "   no vocab")
+	}
+	column := max((width-20)/2, 10)
+	for idx, vocab := range t.vocabs {
+		marker := " "
+		if idx == t.cursor {
+			marker = ">"
+		}
+		lines = append(lines, fmt.Sprintf(" %s %s %s k:%d %3dd",
+			marker,
+			pad(vocab.Term, column),
+			pad(vocab.Translation, column),
+			vocab.KnowledgeLevel,
+			daysUntil(vocab.PracticeAt)))
+	}
+
+	pages := max(int((t.count+int64(t.query.Take)-1)/int64(t.query.Take)), 1)
+	lines = append(lines, "", fmt.Sprintf(" page %d of %d (%d vocab)", t.query.Skip/t.query.Take+1, pages, t.count))
+	return lines
+}
+
+func (t *tui) renderForm() []string {
+	lines := make([]string, 0)
+	for idx, label := range []string{"term:       ", "translation:"} {
+		marker, cursor := " ", ""
+		if idx == t.form.focus {
+			marker, cursor = ">", "_"
+		}
+		lines = append(lines, fmt.Sprintf(" %s %s %s%s", marker, label, string(t.form.fields[idx]), cursor))
+	}
+	return lines
+}
+
+func (t *tui) renderPractice() []string {
+	p := t.practice
+	if p.idx >= len(p.vocabs) {
+		passed := 0
+		for _, result := range p.results {
+			if result.Passed {
+				passed++
+			}
+		}
+		lines := []string{fmt.Sprintf(" you got %d out of %d correct!", passed, len(p.results)), ""}
+		for _, result := range p.results {
+			mark := "x"
+			if result.Passed {
+				mark = "✓"
+			}
+			lines = append(lines, fmt.Sprintf("   %s %s: knowledge %d -> %d", mark, result.Vocab.Term, result.KnowledgeLevel, result.Vocab.KnowledgeLevel))
+		}
+		return lines
+	}
+
+	vocab := p.vocabs[p.idx]
+	lines := []string{
+		fmt.Sprintf(" %d of %d, knowledge: %d", p.idx+1, len(p.vocabs), vocab.KnowledgeLevel),
+		"",
+		"   " + vocab.Term,
+		"",
+	}
+	if p.revealed {
+		lines = append(lines, "   "+vocab.Translation)
+	} else {
+		lines = append(lines, "   ...")
+	}
+	return lines
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:max(width-1, 0)]) + "…"
+}
+
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
+
+// runTui runs the interactive terminal UI until the user quits.
+func runTui(store Store, config *Config, in *os.File, out io.Writer) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("vocab tui must be run in a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	// Use the alternate screen and hide the cursor while running.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return err
+	}
+	t := newTui(store, config, height)
+	err = t.load()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64)
+	for !t.quit {
+		width, height, err = term.GetSize(fd)
+		if err != nil {
+			return err
+		}
+		if height != t.height {
+			t.resize(height)
+			if err = t.load(); err != nil {
+				t.status = err.Error()
+			}
+		}
+
+		screen := "\x1b[H" + strings.Join(t.render(width), "\x1b[K\r\n") + "\x1b[K\x1b[J"
+		_, err = io.WriteString(out, screen)
+		if err != nil {
+			return err
+		}
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			if err = t.handleKey(k); err != nil {
+				t.status = err.Error()
+			}
+		}
+	}
+	return nil
+}
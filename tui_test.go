@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("aé\x1b[A\x1b[B\r\t\x7f\x1b\x03\x1b[6~"))
+	require.Equal(t, []key{
+		{r: 'a'},
+		{r: 'é'},
+		{name: "up"},
+		{name: "down"},
+		{name: "enter"},
+		{name: "tab"},
+		{name: "backspace"},
+		{name: "esc"},
+		{name: "ctrl-c"},
+		{name: "pgdn"},
+	}, keys)
+}
+
+func tuiKeys(t *testing.T, ui *tui, input string) {
+	for _, k := range parseKeys([]byte(input)) {
+		require.Nil(t, ui.handleKey(k))
+	}
+}
+
+func tuiScreen(ui *tui) string {
+	return strings.Join(ui.render(80), "\n")
+}
+
+func Test_Tui_Browse(t *testing.T) {
+	db := memoryDb(t)
+	for _, vocab := range []Vocab{
+		{Term: "foo1", Translation: "bar1", KnowledgeLevel: 1, PracticeAt: inDays(1)},
+		{Term: "foo2", Translation: "bar2", KnowledgeLevel: 2, PracticeAt: inDays(-1)},
+		{Term: "foo3", Translation: "bar3", KnowledgeLevel: 3, PracticeAt: inDays(3)},
+	} {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+
+	ui := newTui(NewGormStore(db), DefaultConfig(), tuiChromeLines+2)
+	require.Nil(t, ui.load())
+	require.Len(t, ui.render(80), tuiChromeLines+2)
+
+	screen := tuiScreen(ui)
+	require.Contains(t, screen, "due: 1")
+	require.Contains(t, screen, "> foo1")
+	require.Contains(t, screen, "  foo2")
+	require.NotContains(t, screen, "foo3")
+	require.Contains(t, screen, "page 1 of 2 (3 vocab)")
+
+	// Moving past the end of the page goes to the next page.
+	tuiKeys(t, ui, "jj")
+	screen = tuiScreen(ui)
+	require.Contains(t, screen, "> foo3")
+	require.Contains(t, screen, "page 2 of 2 (3 vocab)")
+
+	tuiKeys(t, ui, "\x1b[D")
+	require.Contains(t, tuiScreen(ui), "page 1 of 2 (3 vocab)")
+
+	tuiKeys(t, ui, "/bar3")
+	screen = tuiScreen(ui)
+	require.Contains(t, screen, "search: bar3_")
+	require.Contains(t, screen, "> foo3")
+	require.Contains(t, screen, "page 1 of 1 (1 vocab)")
+
+	tuiKeys(t, ui, "\x1b")
+	require.Contains(t, tuiScreen(ui), "(3 vocab)")
+
+	tuiKeys(t, ui, "q")
+	require.True(t, ui.quit)
+}
+
+func Test_Tui_AddEditDelete(t *testing.T) {
+	db := memoryDb(t)
+	ui := newTui(NewGormStore(db), DefaultConfig(), 20)
+	require.Nil(t, ui.load())
+
+	tuiKeys(t, ui, "afoo\r")
+	require.Contains(t, tuiScreen(ui), "term and translation are required")
+
+	tuiKeys(t, ui, "\tbar\r")
+	require.Contains(t, tuiScreen(ui), "added: foo -> bar")
+	require.Equal(t, modeForm, ui.mode)
+
+	tuiKeys(t, ui, "\x1b")
+	require.Contains(t, tuiScreen(ui), "> foo")
+
+	tuiKeys(t, ui, "e\x7f\x7f\x7fbaz\r")
+	require.Contains(t, tuiScreen(ui), "saved: baz -> bar")
+
+	v := Vocab{}
+	dbResult := db.First(&v, 1)
+	require.Nil(t, dbResult.Error)
+	require.Equal(t, "baz", v.Term)
+	require.Equal(t, "bar", v.Translation)
+
+	tuiKeys(t, ui, "dn")
+	require.Equal(t, int64(1), ui.count)
+
+	tuiKeys(t, ui, "dy")
+	require.Equal(t, int64(0), ui.count)
+	require.Contains(t, tuiScreen(ui), "deleted: baz -> bar")
+}
+
+func Test_Tui_Practice(t *testing.T) {
+	db := memoryDb(t)
+
+	ui := newTui(NewGormStore(db), DefaultConfig(), 20)
+	require.Nil(t, ui.load())
+	tuiKeys(t, ui, "p")
+	require.Contains(t, tuiScreen(ui), "nothing to practice")
+
+	for _, vocab := range []Vocab{
+		{Term: "foo1", Translation: "bar1", KnowledgeLevel: 1, PracticeAt: inDays(-1)},
+		{Term: "foo2", Translation: "bar2", KnowledgeLevel: 2, PracticeAt: inDays(0)},
+	} {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+
+	tuiKeys(t, ui, "p")
+	screen := tuiScreen(ui)
+	require.Contains(t, screen, "1 of 2, knowledge: 1")
+	require.Contains(t, screen, "foo1")
+	require.NotContains(t, screen, "bar1")
+
+	// Answers are ignored until the translation is revealed.
+	tuiKeys(t, ui, "y ")
+	require.Contains(t, tuiScreen(ui), "bar1")
+
+	tuiKeys(t, ui, "y n")
+	screen = tuiScreen(ui)
+	require.Contains(t, screen, "you got 1 out of 2 correct!")
+	require.Contains(t, screen, "✓ foo1: knowledge 1 -> 2")
+	require.Contains(t, screen, "x foo2: knowledge 2 -> 1")
+
+	tuiKeys(t, ui, " ")
+	require.Equal(t, modeBrowse, ui.mode)
+	require.Equal(t, int64(0), ui.dueCount)
+
+	// The session is undone as a whole.
+	vocabs, err := NewGormStore(db).UndoPractice()
+	require.Nil(t, err)
+	require.Len(t, vocabs, 2)
+}
+
+// Quitting in the middle of practice keeps the answers given so far.
+func Test_Tui_PracticeQuit(t *testing.T) {
+	db := memoryDb(t)
+	for _, vocab := range []Vocab{
+		{Term: "foo1", Translation: "bar1", KnowledgeLevel: 1, PracticeAt: inDays(-1)},
+		{Term: "foo2", Translation: "bar2", KnowledgeLevel: 2, PracticeAt: inDays(0)},
+	} {
+		dbResult := db.Create(&vocab)
+		require.Nil(t, dbResult.Error)
+	}
+
+	ui := newTui(NewGormStore(db), DefaultConfig(), 20)
+	require.Nil(t, ui.load())
+	tuiKeys(t, ui, "p y\x03")
+	require.True(t, ui.quit)
+
+	var reviews []Review
+	dbResult := db.Find(&reviews)
+	require.Nil(t, dbResult.Error)
+	require.Len(t, reviews, 1)
+	require.True(t, reviews[0].Passed)
+	var vocab Vocab
+	dbResult = db.First(&vocab, 1)
+	require.Nil(t, dbResult.Error)
+	require.Equal(t, uint(2), vocab.KnowledgeLevel)
+}
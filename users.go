@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// noUser is the owner of the local collection: the vocab the CLI works on,
+// and the web application when accounts are off.
+const noUser = 0
+
+const (
+	minPasswordLength = 8
+	// bcrypt only uses the first 72 bytes.
+	maxPasswordLength = 72
+	maxUsernameLength = 50
+	sessionDuration   = 30 * 24 * time.Hour
+)
+
+var (
+	ErrUsernameTaken = errors.New("username is taken")
+	ErrBadLogin      = errors.New("wrong username or password")
+	ErrNoSession     = errors.New("not logged in")
+)
+
+// User is an account on a shared server. Each user has their own collection
+// of vocab.
+type User struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"-"`
+	Username     string    `gorm:"uniqueIndex" json:"username"`
+	PasswordHash string    `json:"-"`
+}
+
+// Session is a login. The session cookie holds the token, of which only the
+// hash is kept, so the sessions table can't be used to log in.
+type Session struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex"`
+	UserID    uint   `gorm:"index"`
+	ExpiresAt time.Time
+}
+
+// forUser returns db with every query limited to the rows belonging to the
+// user with the given ID. Every table it's used with must have a user_id
+// column.
+func forUser(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Where("user_id = ?", userID).Session(&gorm.Session{})
+}
+
+func validateCredentials(username, password string) error {
+	if username == "" {
+		return ErrInvalid{Field: "username", Message: "is required"}
+	}
+	if len(username) > maxUsernameLength {
+		return ErrInvalid{Field: "username", Message: fmt.Sprintf("must be at most %d characters", maxUsernameLength)}
+	}
+	if strings.TrimSpace(username) != username {
+		return ErrInvalid{Field: "username", Message: "must not start or end with a space"}
+	}
+	if len(password) < minPasswordLength {
+		return ErrInvalid{Field: "password", Message: fmt.Sprintf("must be at least %d characters", minPasswordLength)}
+	}
+	if len(password) > maxPasswordLength {
+		return ErrInvalid{Field: "password", Message: fmt.Sprintf("must be at most %d bytes", maxPasswordLength)}
+	}
+	return nil
+}
+
+func registerUser(db *gorm.DB, username, password string) (*User, error) {
+	err := validateCredentials(username, password)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{Username: username, PasswordHash: string(hash)}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		dbResult := tx.Model(&User{}).Where("username = ?", username).Count(&count)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		if count > 0 {
+			return ErrUsernameTaken
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// findUser returns the user with the given username, or nil if there is
+// none.
+func findUser(db *gorm.DB, username string) (*User, error) {
+	users := make([]User, 0)
+	dbResult := db.Where("username = ?", username).Limit(1).Find(&users)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return &users[0], nil
+}
+
+func authenticate(db *gorm.DB, username, password string) (*User, error) {
+	user, err := findUser(db, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrBadLogin
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return nil, ErrBadLogin
+	}
+	return user, nil
+}
+
+// createSession logs the user in, returning the token for the session
+// cookie.
+func createSession(db *gorm.DB, userID uint, now time.Time) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	dbResult := db.Create(&Session{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		ExpiresAt: now.Add(sessionDuration),
+	})
+	if dbResult.Error != nil {
+		return "", dbResult.Error
+	}
+	return token, nil
+}
+
+// sessionUser returns the user logged in with the given token.
+func sessionUser(db *gorm.DB, token string, now time.Time) (*User, error) {
+	if token == "" {
+		return nil, ErrNoSession
+	}
+	users := make([]User, 0)
+	dbResult := db.
+		Joins("join sessions on sessions.user_id = users.id").
+		Where("sessions.token_hash = ? and sessions.expires_at > ?", hashToken(token), now).
+		Limit(1).
+		Find(&users)
+	if dbResult.Error != nil {
+		return nil, dbResult.Error
+	}
+	if len(users) == 0 {
+		return nil, ErrNoSession
+	}
+	return &users[0], nil
+}
+
+// deleteSession logs out the session with the given token, and clears out
+// expired sessions.
+func deleteSession(db *gorm.DB, token string, now time.Time) error {
+	dbResult := db.Where("token_hash = ? or expires_at <= ?", hashToken(token), now).Delete(&Session{})
+	return dbResult.Error
+}
+
+// randomToken returns a secret that can't be guessed, for a session or API
+// token.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken hashes a token for keeping in the database. The tokens are
+// random, so unlike passwords they don't need a slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_RegisterUser(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		user, err := registerUser(db, "alice", "password1")
+		require.Nil(t, err)
+		require.Equal(t, "alice", user.Username)
+		require.NotEqual(t, "password1", user.PasswordHash)
+
+		_, err = registerUser(db, "alice", "password2")
+		require.Equal(t, ErrUsernameTaken, err)
+
+		_, err = registerUser(db, "bob", "short")
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "at least 8 characters")
+
+		_, err = registerUser(db, " bob", "password1")
+		require.NotNil(t, err)
+	})
+}
+
+func Test_Authenticate(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		registered, err := registerUser(db, "alice", "password1")
+		require.Nil(t, err)
+
+		user, err := authenticate(db, "alice", "password1")
+		require.Nil(t, err)
+		require.Equal(t, registered.ID, user.ID)
+
+		_, err = authenticate(db, "alice", "password2")
+		require.Equal(t, ErrBadLogin, err)
+		_, err = authenticate(db, "bob", "password1")
+		require.Equal(t, ErrBadLogin, err)
+	})
+}
+
+func Test_Sessions(t *testing.T) {
+	forEachDb(t, func(t *testing.T, db *gorm.DB) {
+		alice, err := registerUser(db, "alice", "password1")
+		require.Nil(t, err)
+		now := time.Now()
+
+		token, err := createSession(db, alice.ID, now)
+		require.Nil(t, err)
+
+		user, err := sessionUser(db, token, now)
+		require.Nil(t, err)
+		require.Equal(t, "alice", user.Username)
+
+		// Only the hash of the token is kept.
+		var session Session
+		require.Nil(t, db.First(&session).Error)
+		require.NotEqual(t, token, session.TokenHash)
+
+		_, err = sessionUser(db, "nope", now)
+		require.Equal(t, ErrNoSession, err)
+		_, err = sessionUser(db, token, now.Add(sessionDuration))
+		require.Equal(t, ErrNoSession, err)
+
+		// Logging out also clears out expired sessions.
+		_, err = createSession(db, alice.ID, now.Add(-sessionDuration))
+		require.Nil(t, err)
+		require.Nil(t, deleteSession(db, token, now))
+		_, err = sessionUser(db, token, now)
+		require.Equal(t, ErrNoSession, err)
+		var count int64
+		require.Nil(t, db.Model(&Session{}).Count(&count).Error)
+		require.Equal(t, int64(0), count)
+	})
+}
@@ -0,0 +1,94 @@
+//go:build ignore
+// +build ignore
+
+// vendor_www downloads the JavaScript libraries of the web application into
+// www/vendor, which is embedded in the binary so the web application works
+// offline, and points www/index.html at them with their integrity hashes.
+// Run it with go generate after changing a version.
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var libraries = []struct {
+	name    string
+	version string
+	file    string
+}{
+	{"vue", "3.2.47", "dist/vue.global.prod.js"},
+	{"vue-router", "4.1.6", "dist/vue-router.global.prod.js"},
+	{"vuex", "4.1.0", "dist/vuex.global.prod.js"},
+}
+
+const (
+	vendorDir = "www/vendor"
+	indexPath = "www/index.html"
+	// The script tags between the markers are replaced.
+	startMarker = "<!-- vendored, see vendor_www.go -->"
+	endMarker   = "<!-- end vendored -->"
+)
+
+func main() {
+	err := os.RemoveAll(vendorDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.MkdirAll(vendorDir, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tags := make([]string, 0, len(libraries))
+	for _, lib := range libraries {
+		b, err := download(fmt.Sprintf("https://unpkg.com/%s@%s/%s", lib.name, lib.version, lib.file))
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Named by version, so they can be cached for good.
+		name := fmt.Sprintf("%s-%s.js", lib.name, lib.version)
+		err = ioutil.WriteFile(filepath.Join(vendorDir, name), b, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sum := sha512.Sum384(b)
+		tags = append(tags, fmt.Sprintf(`<script src="/vendor/%s" integrity="sha384-%s"></script>`, name, base64.StdEncoding.EncodeToString(sum[:])))
+	}
+
+	b, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	index := string(b)
+	start := strings.Index(index, startMarker)
+	end := strings.Index(index, endMarker)
+	if start < 0 || end < start {
+		log.Fatalf("%s must have the markers %q and %q", indexPath, startMarker, endMarker)
+	}
+	indent := index[strings.LastIndex(index[:start], "\n")+1 : start]
+	index = index[:start+len(startMarker)] + "\n" + indent + strings.Join(tags, "\n"+indent) + "\n" + indent + index[end:]
+	err = ioutil.WriteFile(indexPath, []byte(index), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func download(url string) ([]byte, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const defaultVocabPageSize = 10
+
+// VocabQuery filters, orders and pages the vocab list. It is shared by the
+// API and the CLI so both behave the same.
+type VocabQuery struct {
+	Term        string
+	Translation string
+	// Mode is "or" to match either the term or the translation, otherwise
+	// both must match.
+	Mode string
+	// OrderBy is one of "", "knowledge_level", "knowledge_level_desc",
+	// "practice_at" or "practice_at_desc". Ties are ordered by term.
+	OrderBy string
+	Skip    int
+	Take    int
+}
+
+func NewVocabQuery() VocabQuery {
+	return VocabQuery{
+		Take: defaultVocabPageSize,
+	}
+}
+
+// printVocab writes a page of vocab as a table, or as JSON in the same shape
+// as the API.
+func printVocab(w io.Writer, vocabs []Vocab, count int64, skip int, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": count,
+			"items": vocabs,
+		})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTERM\tTRANSLATION\tKNOWLEDGE\tPRACTICE NEXT")
+	for _, vocab := range vocabs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d days\n",
+			vocab.ID, vocab.Term, vocab.Translation, vocab.KnowledgeLevel, daysUntil(vocab.PracticeAt))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	if len(vocabs) > 0 {
+		_, err = fmt.Fprintf(w, "\n%d-%d of %d\n", skip+1, skip+len(vocabs), count)
+	} else {
+		_, err = fmt.Fprintf(w, "\n0 of %d\n", count)
+	}
+	return err
+}
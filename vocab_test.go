@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PrintVocab(t *testing.T) {
+	vocabs := []Vocab{
+		{ID: 4, Term: "guten tag", Translation: "good day", KnowledgeLevel: 2, PracticeAt: inDays(3)},
+		{ID: 12, Term: "apfel", Translation: "apple", KnowledgeLevel: 0, PracticeAt: inDays(0)},
+	}
+
+	var buf bytes.Buffer
+	err := printVocab(&buf, vocabs, 7, 2, false)
+	require.Nil(t, err)
+	require.Equal(t, `ID  TERM       TRANSLATION  KNOWLEDGE  PRACTICE NEXT
+4   guten tag  good day     2          3 days
+12  apfel      apple        0          0 days
+
+3-4 of 7
+`, buf.String())
+
+	buf.Reset()
+	err = printVocab(&buf, vocabs[:1], 1, 0, true)
+	require.Nil(t, err)
+	require.JSONEq(t, fmt.Sprintf(`{
+		"count": 1,
+		"items": [
+			{
+				"id": 4,
+				"term": "guten tag",
+				"translation": "good day",
+				"knowledgeLevel": 2,
+				"practiceAt": "%s"
+			}
+		]
+	}`, inDaysJSON(3)), buf.String())
+}
@@ -1,12 +1,50 @@
 const vocabPageSize = 10;
 
+// errorMessage reads the message of an error response of the API.
+function errorMessage(res) {
+  return res.json().then(
+    (error) => error.message,
+    () => res.statusText
+  );
+}
+
+// deleteVocab moves vocab to the trash, offering to undo it, and calls
+// refresh once the vocab is deleted or restored.
+function deleteVocab(store, vocab, refresh) {
+  return fetch(`/api/vocab/${vocab.id}`, { method: "delete" })
+    .then(() => {
+      store.dispatch("notification", {
+        text: `deleted: ${vocab.term} -> ${vocab.translation}`,
+        action: {
+          label: "undo",
+          run: () =>
+            fetch(`/api/vocab/${vocab.id}/restore`, { method: "post" })
+              .then(refresh)
+              .catch((e) => {
+                console.error(e);
+              }),
+        },
+      });
+      refresh();
+    })
+    .catch((e) => {
+      console.error(e);
+    });
+}
+
 const VocabPage = {
   template: `
 <h1 class="heading">vocab</h1>
 
 <div class="home-links">
   <router-link to="/add">add</router-link>
+  <router-link to="/paste">paste list</router-link>
+  <router-link to="/stats">stats</router-link>
+  <router-link to="/trash">trash</router-link>
   <router-link to="/practice" v-if="practiceCount">practice ({{ practiceCount }})</router-link>
+  <a href="/api/export?format=html&group_by=letter" target="_blank">print</a>
+  <a href="/api/export?format=pdf">flashcards</a>
+  <a href="#" v-if="user" @click.prevent="logout">log out ({{ user.username }})</a>
 </div>
 
 <div class="search-bar">
@@ -57,10 +95,23 @@ const VocabPage = {
       practiceCount: 0,
     };
   },
+  computed: {
+    user() {
+      return this.$store.state.session.user;
+    },
+  },
   methods: {
     days(dateString) {
       return Math.ceil((new Date(dateString) - new Date()) / 86400000);
     },
+    logout() {
+      fetch("/api/logout", { method: "post" })
+        .then(() => this.$store.dispatch("fetchSession"))
+        .then(() => this.$router.push("/login"))
+        .catch((e) => {
+          console.error(e);
+        });
+    },
     scrollTop() {
       window.scrollTo({ top: 0 });
     },
@@ -100,23 +151,13 @@ const VocabPage = {
       this.fetchVocab();
     },
     deleteVocab(vocab) {
-      if (
-        window.confirm(
-          `Do you really want to delete this vocab?\n\nterm: ${vocab.term}\ntranslation: ${vocab.translation}`
-        )
-      ) {
-        fetch(`/api/vocab/${vocab.id}`, { method: "delete" })
-          .catch((e) => {
-            console.error(e);
-          })
-          .then(() => {
-            if (this.vocabs.length == 1) {
-              this.page = this.page - 1;
-            }
-            this.fetchVocab();
-            this.fetchPracticeCount();
-          });
+      if (this.vocabs.length == 1) {
+        this.page = Math.max(this.page - 1, 1);
       }
+      deleteVocab(this.$store, vocab, () => {
+        this.fetchVocab();
+        this.fetchPracticeCount();
+      });
     },
   },
   mounted() {
@@ -198,7 +239,12 @@ const AddPage = {
           translation: this.translation.trim(),
         }),
       })
-        .then(() => {
+        .then((res) => {
+          if (!res.ok) {
+            return errorMessage(res).then((message) => {
+              this.$store.dispatch("notification", message);
+            });
+          }
           this.$store.dispatch(
             "notification",
             `added: ${this.term.trim()} -> ${this.translation.trim()}`
@@ -225,19 +271,7 @@ const AddPage = {
         });
     },
     deleteVocab(vocab) {
-      if (
-        window.confirm(
-          `Do you really want to delete this vocab?\n\nterm: ${vocab.term}\ntranslation: ${vocab.translation}`
-        )
-      ) {
-        fetch(`/api/vocab/${vocab.id}`, { method: "delete" })
-          .catch((e) => {
-            console.error(e);
-          })
-          .then(() => {
-            this.fetchSimilarVocab();
-          });
-      }
+      deleteVocab(this.$store, vocab, () => this.fetchSimilarVocab());
     },
   },
   watch: {
@@ -260,6 +294,135 @@ const AddPage = {
   },
 };
 
+const pasteSeparators = {
+  term: [
+    { label: "tab", value: "\t" },
+    { label: "comma", value: "," },
+    { label: "dash", value: " - " },
+  ],
+  card: [
+    { label: "new line", value: "\n" },
+    { label: "semicolon", value: ";" },
+    { label: "blank line", value: "\n\n" },
+  ],
+};
+
+const PastePage = {
+  template: `
+<h1 class="heading">vocab|paste</h1>
+
+<form @submit.prevent="handleSubmit" class="paste-form">
+  <textarea v-focus v-model="text" rows="10" placeholder="paste a list, e.g. exported from quizlet"></textarea>
+  <div class="paste-separators">
+    <label>
+      between term and translation
+      <select v-model="termSeparator">
+        <option v-for="sep in separators.term" :value="sep.value">{{ sep.label }}</option>
+      </select>
+    </label>
+    <label>
+      between cards
+      <select v-model="cardSeparator">
+        <option v-for="sep in separators.card" :value="sep.value">{{ sep.label }}</option>
+      </select>
+    </label>
+  </div>
+  <div class="vocab-add-submit-bar">
+    <button type="submit" :disabled="!pairs.length">save {{ pairs.length }}</button>
+    <router-link to="/">home</router-link>
+  </div>
+</form>
+
+<hr/>
+
+<h2 class="heading-similar">preview:</h2>
+<p v-if="error" class="paste-error">{{ error }}</p>
+<div class="vocab-list">
+  <div v-for="(pair, idx) in pairs" :key="idx" class="vocab-item">
+    <p class="vocab-item-term">{{ pair.term }}</p>
+    <p class="vocab-item-translation">{{ pair.translation }}</p>
+  </div>
+</div>`,
+  data() {
+    return {
+      text: "",
+      termSeparator: pasteSeparators.term[0].value,
+      cardSeparator: pasteSeparators.card[0].value,
+      pairs: [],
+      error: "",
+    };
+  },
+  computed: {
+    separators() {
+      return pasteSeparators;
+    },
+  },
+  methods: {
+    requestBody() {
+      return JSON.stringify({
+        text: this.text,
+        termSeparator: this.termSeparator,
+        cardSeparator: this.cardSeparator,
+      });
+    },
+    fetchPreview() {
+      fetch("/api/import/text/preview", {
+        method: "post",
+        body: this.requestBody(),
+      })
+        .then((res) => {
+          if (!res.ok) {
+            return errorMessage(res).then((message) => {
+              throw new Error(message);
+            });
+          }
+          return res.json();
+        })
+        .then((data) => {
+          this.pairs = data;
+          this.error = "";
+        })
+        .catch((e) => {
+          this.pairs = [];
+          this.error = e.message;
+        });
+    },
+    handleSubmit() {
+      fetch("/api/import/text", {
+        method: "post",
+        body: this.requestBody(),
+      })
+        .then((res) => res.json())
+        .then((data) => {
+          this.$store.dispatch("notification", `added ${data.count} vocab`);
+          this.$router.push("/");
+        })
+        .catch((e) => {
+          console.error(e);
+        });
+    },
+    schedulePreview() {
+      if (this.previewDebounce) {
+        clearTimeout(this.previewDebounce);
+      }
+      this.previewDebounce = setTimeout(() => {
+        this.fetchPreview();
+      }, 300);
+    },
+  },
+  watch: {
+    text() {
+      this.schedulePreview();
+    },
+    termSeparator() {
+      this.schedulePreview();
+    },
+    cardSeparator() {
+      this.schedulePreview();
+    },
+  },
+};
+
 const PracticePage = {
   template: `
 <div class="practice-heading-bar">
@@ -289,8 +452,9 @@ const PracticePage = {
 
 <template v-if="state == 'done'">
   <p>you got {{ results.filter(r => r.passed).length }} out of {{ results.length }} correct!</p>
-  <div>
+  <div class="practice-done-bar">
     <router-link v-focus to="/">home</router-link>
+    <button type="button" @click="undo">undo</button>
   </div>
 </template>
 `,
@@ -303,20 +467,46 @@ const PracticePage = {
     };
   },
   mounted() {
-    fetch("/api/practice")
-      .then((res) => res.json())
-      .then((data) => {
-        if (!data.length) {
-          this.$store.dispatch("notification", "nothing to practice");
-          this.$router.push("/");
-          return;
-        }
-        this.vocabs = data;
-        this.state = "practice.input";
-      })
-      .catch((e) => console.error(e));
+    this.start();
   },
   methods: {
+    start() {
+      fetch("/api/practice")
+        .then((res) => res.json())
+        .then((data) => {
+          if (!data.length) {
+            this.$store.dispatch("notification", "nothing to practice");
+            this.$router.push("/");
+            return;
+          }
+          this.vocabs = data;
+          this.results = [];
+          this.state = "practice.input";
+        })
+        .catch((e) => console.error(e));
+    },
+    // undo undoes the results just sent, e.g. after a typo, and practices
+    // the vocab again.
+    undo() {
+      fetch("/api/practice/undo", { method: "post" })
+        .then((res) => {
+          if (!res.ok) {
+            return errorMessage(res).then((message) => {
+              this.$store.dispatch("notification", message);
+            });
+          }
+          return res.json().then((vocabs) => {
+            this.$store.dispatch(
+              "notification",
+              `undid the practice of ${vocabs.length} vocab`
+            );
+            this.start();
+          });
+        })
+        .catch((e) => {
+          console.error(e);
+        });
+    },
     makeGuess() {
       this.state = "practice.result";
     },
@@ -350,39 +540,296 @@ const PracticePage = {
   },
 };
 
+const StatsPage = {
+  template: `
+<h1 class="heading">vocab|stats</h1>
+
+<template v-if="stats">
+  <table class="stats-table">
+    <tr><th>total</th><td>{{ stats.total }}</td></tr>
+    <tr><th>due today</th><td>{{ stats.dueToday }}</td></tr>
+    <tr><th>due this week</th><td>{{ stats.dueThisWeek }}</td></tr>
+    <tr><th>streak</th><td>{{ stats.streak }} days</td></tr>
+  </table>
+
+  <table class="stats-table">
+    <tr><th>reviews</th><th>count</th><th>accuracy</th></tr>
+    <tr><td>last 7 days</td><td>{{ stats.last7Days.reviews }}</td><td>{{ percent(stats.last7Days.accuracy) }}</td></tr>
+    <tr><td>last 30 days</td><td>{{ stats.last30Days.reviews }}</td><td>{{ percent(stats.last30Days.accuracy) }}</td></tr>
+  </table>
+
+  <table class="stats-table">
+    <tr><th>knowledge</th><th>count</th><th></th></tr>
+    <tr v-for="(count, level) in stats.knowledgeLevels" :key="level">
+      <td>{{ level }}</td>
+      <td>{{ count }}</td>
+      <td><div class="stats-bar" :style="{ width: barWidth(count) }"></div></td>
+    </tr>
+  </table>
+</template>
+
+<router-link to="/">home</router-link>`,
+  data() {
+    return {
+      stats: null,
+    };
+  },
+  mounted() {
+    fetch("/api/stats")
+      .then((res) => res.json())
+      .then((data) => {
+        this.stats = data;
+      })
+      .catch((e) => console.error(e));
+  },
+  methods: {
+    percent(ratio) {
+      return `${Math.round(ratio * 100)}%`;
+    },
+    barWidth(count) {
+      const most = Math.max(...this.stats.knowledgeLevels, 1);
+      return `${(count / most) * 100}%`;
+    },
+  },
+};
+
+const LoginPage = {
+  template: `
+<h1 class="heading">vocab|log in</h1>
+
+<form @submit.prevent="login" class="login-form">
+  <input v-focus type="text" v-model="username" placeholder="username" autocomplete="username"/>
+  <input type="password" v-model="password" placeholder="password" autocomplete="current-password"/>
+  <p v-if="error" class="login-error">{{ error }}</p>
+  <div class="login-submit-bar">
+    <button type="submit" :disabled="!canSubmit">log in</button>
+    <button type="button" :disabled="!canSubmit" @click="register">register</button>
+  </div>
+</form>`,
+  data() {
+    return {
+      username: "",
+      password: "",
+      error: "",
+    };
+  },
+  computed: {
+    canSubmit() {
+      return !!this.username.trim() && !!this.password;
+    },
+  },
+  methods: {
+    login() {
+      this.submit("/api/login");
+    },
+    register() {
+      this.submit("/api/register");
+    },
+    submit(url) {
+      this.error = "";
+      fetch(url, {
+        method: "post",
+        body: JSON.stringify({
+          username: this.username.trim(),
+          password: this.password,
+        }),
+      })
+        .then((res) => {
+          if (!res.ok) {
+            return errorMessage(res).then((message) => {
+              this.error = message;
+            });
+          }
+          return this.$store
+            .dispatch("fetchSession")
+            .then(() => this.$router.push("/"));
+        })
+        .catch((e) => {
+          console.error(e);
+        });
+    },
+  },
+};
+
+const TokenPage = {
+  template: `
+<h1 class="heading">vocab|token</h1>
+
+<form @submit.prevent="submit" class="login-form">
+  <p>This server needs an API token. Create one with <code>vocab token create</code>.</p>
+  <input v-focus type="password" v-model="token" placeholder="token" autocomplete="off"/>
+  <p v-if="error" class="login-error">{{ error }}</p>
+  <div class="login-submit-bar">
+    <button type="submit" :disabled="!token.trim()">continue</button>
+  </div>
+</form>`,
+  data() {
+    return {
+      token: "",
+      error: "",
+    };
+  },
+  methods: {
+    submit() {
+      this.error = "";
+      fetch("/api/token", {
+        method: "post",
+        body: JSON.stringify({ token: this.token.trim() }),
+      })
+        .then((res) => {
+          if (!res.ok) {
+            return errorMessage(res).then((message) => {
+              this.error = message;
+            });
+          }
+          return this.$store
+            .dispatch("fetchSession")
+            .then(() => this.$router.push("/"));
+        })
+        .catch((e) => {
+          console.error(e);
+        });
+    },
+  },
+};
+
+const TrashPage = {
+  template: `
+<h1 class="heading">vocab|trash</h1>
+
+<p v-if="loaded && !vocabs.length">the trash is empty</p>
+<div class="vocab-list">
+  <div v-for="vocab in vocabs" :key="vocab.id" class="vocab-item">
+    <p class="vocab-item-term">{{ vocab.term }}</p>
+    <p class="vocab-item-translation">{{ vocab.translation }}</p>
+    <div class="vocab-item-meta">
+      <div>
+        <span><span class="vocab-item-meta-key">deleted:</span> {{ new Date(vocab.deletedAt).toLocaleString() }}</span>
+      </div>
+      <div>
+        <button type="button" @click="restoreVocab(vocab)">restore</button>
+      </div>
+    </div>
+  </div>
+</div>`,
+  data() {
+    return {
+      vocabs: [],
+      loaded: false,
+    };
+  },
+  mounted() {
+    this.fetchTrash();
+  },
+  methods: {
+    fetchTrash() {
+      fetch("/api/trash")
+        .then((res) => res.json())
+        .then((vocabs) => {
+          this.vocabs = vocabs;
+          this.loaded = true;
+        })
+        .catch((e) => {
+          console.error(e);
+        });
+    },
+    restoreVocab(vocab) {
+      fetch(`/api/vocab/${vocab.id}/restore`, { method: "post" })
+        .then(() => {
+          this.$store.dispatch(
+            "notification",
+            `restored: ${vocab.term} -> ${vocab.translation}`
+          );
+          this.fetchTrash();
+        })
+        .catch((e) => {
+          console.error(e);
+        });
+    },
+  },
+};
+
 const router = VueRouter.createRouter({
   history: VueRouter.createWebHistory(),
   routes: [
     { path: "/practice", component: PracticePage },
     { path: "/add", component: AddPage },
+    { path: "/paste", component: PastePage },
+    { path: "/stats", component: StatsPage },
+    { path: "/trash", component: TrashPage },
+    { path: "/login", component: LoginPage },
+    { path: "/token", component: TokenPage },
     { path: "/", component: VocabPage },
   ],
 });
 
+// With accounts on, every page but the login page needs a user. With tokens
+// required, every page but the token page needs a token.
+router.beforeEach((to) => {
+  const session = store.state.session;
+  const loaded = session
+    ? Promise.resolve(session)
+    : store.dispatch("fetchSession");
+  return loaded.then((session) => {
+    if (session.tokenRequired) {
+      return to.path == "/token" ? undefined : "/token";
+    }
+    if (session.accounts && !session.user) {
+      return to.path == "/login" ? undefined : "/login";
+    }
+    if (to.path == "/login" || to.path == "/token") {
+      return "/";
+    }
+  });
+});
+
 let nextNotificationId = 1;
 
 const store = Vuex.createStore({
   state() {
     return {
       notifications: {},
+      session: null,
     };
   },
   mutations: {
-    addNotification(state, { id, text }) {
-      state.notifications = { ...state.notifications, [id]: { id, text } };
+    setSession(state, session) {
+      state.session = session;
+    },
+    addNotification(state, { id, text, action }) {
+      state.notifications = {
+        ...state.notifications,
+        [id]: { id, text, action },
+      };
     },
     deleteNotification(state, { id }) {
       delete state.notifications[id];
     },
   },
   actions: {
-    notification(context, text) {
+    fetchSession(context) {
+      return fetch("/api/session")
+        .then((res) => res.json())
+        .then((session) => {
+          context.commit("setSession", session);
+          return session;
+        });
+    },
+    // notification shows a message, either text or { text, action } where
+    // action is a { label, run } button, e.g. to undo. Notifications with an
+    // action stay longer, to give time to click it.
+    notification(context, notification) {
       const id = nextNotificationId;
       nextNotificationId += 1;
-      context.commit("addNotification", { id, text });
-      setTimeout(() => {
-        context.commit("deleteNotification", { id });
-      }, 3000);
+      const { text, action } =
+        typeof notification == "string" ? { text: notification } : notification;
+      context.commit("addNotification", { id, text, action });
+      setTimeout(
+        () => {
+          context.commit("deleteNotification", { id });
+        },
+        action ? 8000 : 3000
+      );
     },
   },
 });
@@ -390,7 +837,10 @@ const store = Vuex.createStore({
 const vm = Vue.createApp({
   template: `
 <div class="notifications">
-  <div v-for="notification in Object.values(notifications).reverse()" :key="notification.id">{{ notification.text }}</div>
+  <div v-for="notification in Object.values(notifications).reverse()" :key="notification.id">
+    <span>{{ notification.text }}</span>
+    <button v-if="notification.action" type="button" @click="runAction(notification)">{{ notification.action.label }}</button>
+  </div>
 </div>
 <router-view></router-view>`,
   computed: {
@@ -398,6 +848,12 @@ const vm = Vue.createApp({
       return this.$store.state.notifications;
     },
   },
+  methods: {
+    runAction(notification) {
+      this.$store.commit("deleteNotification", notification);
+      notification.action.run();
+    },
+  },
 })
   .directive("focus", {
     mounted(el) {